@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/spec"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newApplyCmd() *cobra.Command {
+	var specPath string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "apply -f <workspace.yaml>",
+		Short:        "Create or reconcile a workspace from a spec file",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ws, err := spec.Load(specPath)
+			if err != nil {
+				return err
+			}
+
+			workspaceName := ws.Metadata.Name
+			gitopsConfig := home.Path("workspaces", workspaceName)
+			if _, err := os.Stat(gitopsConfig); os.IsNotExist(err) {
+				fmt.Printf("Workspace %s does not exist, creating it...\n", workspaceName)
+				o := initOptionsFromSpec(ws)
+				o.verbose = verbose
+				return o.run(cmd, []string{workspaceName})
+			}
+
+			// init takes the lock itself, reconciling an existing workspace is locked here
+			unlock, err := lockWorkspaces(workspaceName)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			fmt.Printf("Workspace %s exists, reconciling it...\n", workspaceName)
+			if err := reconcileWorkspace(ws, gitopsConfig); err != nil {
+				return fmt.Errorf("error reconciling workspace: %w", err)
+			}
+			fmt.Printf("Workspace %s is up to date with %s\n", workspaceName, specPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&specPath, "file", "f", "", "Workspace spec file (- reads from stdin)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func initOptionsFromSpec(ws *spec.Workspace) *initOptions {
+	o := defaultInitOptions()
+	o.remoteRepo = ws.Spec.Remote
+	o.domain = ws.Spec.Domain
+	o.certsDir = ws.Spec.Certs.Dir
+	o.mkCerts = ws.Spec.Certs.Mkcert
+	o.setHosts = ws.Spec.SetHosts
+	o.local = ws.Spec.Local
+	o.noIde = !ws.Spec.EditorEnabled()
+	o.gitopsImage = ws.Spec.Images.Gitops
+	o.editorImage = ws.Spec.Images.Editor
+	if ws.Spec.Images.Channel != "" {
+		o.channel = ws.Spec.Images.Channel
+	}
+	o.limits = limitsFromSpec(ws.Spec.Resources)
+	return o
+}
+
+func limitsFromSpec(r spec.Resources) dockercompose.Limits {
+	convert := func(l spec.Limits) dockercompose.Resources {
+		return dockercompose.Resources{CPUs: l.CPUs, Memory: l.Memory, PidsLimit: l.PidsLimit, Restart: l.Restart}
+	}
+	return dockercompose.Limits{
+		Gitops:      convert(r.Gitops),
+		Editor:      convert(r.Editor),
+		Automations: convert(r.Automations),
+	}
+}
+
+// reconcileWorkspace brings an existing workspace in line with the spec. Services are
+// only restarted when images, limits or the editor setting changed, and the Caddy routes
+// only replaced when the editor setting or the certificates changed, so applying the
+// same spec twice is a no-op.
+func reconcileWorkspace(ws *spec.Workspace, gitopsConfig string) error {
+	workspaceName := ws.Metadata.Name
+
+	metadata, err := workspace.New(workspaceName).ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	if metadata.Domain != ws.Domain() {
+		return fmt.Errorf("changing the domain of an existing workspace is not supported (%s -> %s)", metadata.Domain, ws.Domain())
+	}
+
+	// A spec without a channel keeps the channel of the workspace
+	channel := ws.Spec.Images.Channel
+	if channel == "" {
+		channel = metadata.Channel
+	}
+
+	noIde := !ws.Spec.EditorEnabled()
+	editorChanged := (metadata.EditorURL == nil) != noIde
+	gitopsImage, editorImage, err := resolveImages(channel, ws.Spec.Images.Gitops, ws.Spec.Images.Editor)
+	if err != nil {
+		return err
+	}
+
+	currentImages, err := getComposeImages(gitopsConfig)
+	if err != nil {
+		return err
+	}
+
+	limits := limitsFromSpec(ws.Spec.Resources)
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	var currentLimits dockercompose.Limits
+	if metadata.Limits != nil {
+		currentLimits = *metadata.Limits
+	}
+
+	upToDate := currentImages["bitswan-gitops"] == gitopsImage &&
+		(metadata.EditorURL == nil) == noIde &&
+		(noIde || currentImages["bitswan-editor"] == editorImage) &&
+		currentLimits == limits
+
+	if upToDate {
+		fmt.Println("Images and services are up to date.")
+	} else {
+		fmt.Printf("Updating workspace %s...\n", workspaceName)
+		if err := updateGitops(workspaceName, &updateOptions{
+			gitopsImage: gitopsImage,
+			editorImage: editorImage,
+			channel:     channel,
+			noIde:       &noIde,
+			setLimits:   func(l *dockercompose.Limits) { *l = limits },
+		}); err != nil {
+			return err
+		}
+	}
+
+	certsChanged := false
+	if ws.Spec.Certs.Dir != "" {
+		err := withGlobalLock(func() error {
+			var err error
+			certsChanged, err = copyCerts(ws.Spec.Certs.Dir, metadata.Domain)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !editorChanged && !certsChanged {
+		return nil
+	}
+	// A stopped workspace gets its routes back when it is started
+	stopped, err := readStoppedState(gitopsConfig)
+	if err != nil {
+		return err
+	}
+	if stopped != nil {
+		fmt.Println("Workspace is stopped, its Caddy routes are registered when it is started.")
+		return nil
+	}
+	return registerCaddyRoutes(workspaceName, metadata.Domain, noIde)
+}
+
+// getComposeImages returns the images of the services in the workspace docker-compose file
+func getComposeImages(gitopsConfig string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(gitopsConfig, "deployment", workspace.ComposeFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading docker-compose file: %w", err)
+	}
+
+	var compose Compose
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("error unmarshalling docker-compose file: %w", err)
+	}
+
+	images := map[string]string{}
+	for name, service := range compose.Services {
+		images[name] = service.Image
+	}
+
+	return images, nil
+}
+
+// copyCerts copies certificates into the Caddy certs directory of the domain and
+// reports whether any of them changed
+func copyCerts(certsDir, domain string) (bool, error) {
+	targetDir := home.Path("caddy", "certs", domain)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create certs directory: %w", err)
+	}
+
+	certs, err := os.ReadDir(certsDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to read certs directory: %w", err)
+	}
+
+	changed := false
+	for _, cert := range certs {
+		if cert.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(certsDir, cert.Name()))
+		if err != nil {
+			return false, fmt.Errorf("failed to read cert file: %w", err)
+		}
+
+		target := filepath.Join(targetDir, cert.Name())
+		if current, err := os.ReadFile(target); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := os.WriteFile(target, data, 0755); err != nil {
+			return false, fmt.Errorf("failed to copy cert file: %w", err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// registerCaddyRoutes replaces the Caddy routes (and TLS certificates when the
+// workspace has its own) of a workspace, so it can be called repeatedly
+func registerCaddyRoutes(workspaceName, domain string, noIde bool) error {
+	return withGlobalLock(func() error {
+		fmt.Println("Registering Caddy routes...")
+
+		certsDir := home.Path("caddy", "certs", domain)
+		if _, err := os.Stat(certsDir); err == nil {
+			for _, id := range []string{"tlspolicy", "tlscerts"} {
+				if err := caddyapi.UnregisterCaddyService(id, workspaceName); err != nil {
+					return err
+				}
+			}
+			if err := caddyapi.InstallTLSCerts(workspaceName, domain); err != nil {
+				return fmt.Errorf("failed to install caddy certs: %w", err)
+			}
+		}
+
+		services := map[string]string{
+			"gitops": fmt.Sprintf("%s-gitops:8079", workspaceName),
+		}
+		if !noIde {
+			services["editor"] = fmt.Sprintf("%s-editor:9999", workspaceName)
+		}
+
+		for _, service := range []string{"gitops", "editor"} {
+			if err := caddyapi.UnregisterCaddyService(service, workspaceName); err != nil {
+				return err
+			}
+
+			upstream, ok := services[service]
+			if !ok {
+				continue
+			}
+			if err := caddyapi.RegisterServiceWithCaddy(service, workspaceName, domain, upstream); err != nil {
+				return fmt.Errorf("failed to register %s service with caddy: %w", service, err)
+			}
+		}
+
+		fmt.Println("Caddy routes registered!")
+		return nil
+	})
+}
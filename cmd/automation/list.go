@@ -7,27 +7,34 @@ import (
 
 	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
 	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
 )
 
 func newListCmd() *cobra.Command {
+	var format string
+
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List available bitswan workspace automations",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
 			workspaceName, err := config.GetWorkspaceName()
 			if err != nil {
 				return fmt.Errorf("failed to get active workspace from config.toml: %v", err)
 			}
-			_, err = automations.GetListAutomations(workspaceName)
+			automationSet, err := automations.GetAutomations(workspaceName)
 			if err != nil {
 				return fmt.Errorf("failed to list automations: %v", err)
 			}
-			return nil
+			return output.Write(cmd.OutOrStdout(), format, automationSet, automations.Columns)
 		},
 	}
 
-	// Add subcommands to workspace
+	output.AddFlag(cmd, &format)
 
 	return cmd
 }
@@ -3,26 +3,36 @@ package automation
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 
 	"github.com/bitswan-space/bitswan-workspaces/internal/ansi"
 	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
 	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
 	"github.com/spf13/cobra"
 )
 
 type AutomationLog struct {
-	Status string   `json:"status"`
-	Logs   []string `json:"logs"`
+	Automation string   `json:"automation" yaml:"automation"`
+	Status     string   `json:"status" yaml:"status"`
+	Logs       []string `json:"logs" yaml:"logs"`
 }
 
 func newLogsCmd() *cobra.Command {
+	var format string
+
 	cmd := &cobra.Command{
 		Use:   "logs",
 		Short: "Get logs for automation",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
 			workspaceName, err := config.GetWorkspaceName()
 			automationDeploymentId := args[0]
 			if err != nil {
@@ -34,60 +44,68 @@ func newLogsCmd() *cobra.Command {
 				return fmt.Errorf("failed to parse lines flag: %v", err)
 			}
 
-			err = getLogsFromAutomation(workspaceName, automationDeploymentId, lines)
+			automationLog, err := getLogsFromAutomation(workspaceName, automationDeploymentId, lines)
 			if err != nil {
 				return fmt.Errorf("failed to get logs from an automation: %v", err)
 			}
-			return nil
+			return output.WriteObject(cmd.OutOrStdout(), format, automationLog, func(w io.Writer, wide bool) error {
+				writeLogs(w, automationLog)
+				return nil
+			})
 		},
 	}
 
 	cmd.Flags().IntP("lines", "l", 0, "Number of log lines to show (default 0 for all logs)")
+	output.AddFlag(cmd, &format)
 
 	return cmd
 }
 
-func getLogsFromAutomation(workspaceName string, automationDeploymentId string, lines int) error {
-	metadata := config.GetWorkspaceMetadata(workspaceName)
+func getLogsFromAutomation(workspaceName string, automationDeploymentId string, lines int) (*AutomationLog, error) {
+	metadata, err := config.GetWorkspaceMetadata(workspaceName)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("Fetching automations logs...")
+	fmt.Fprintln(os.Stderr, "Fetching automations logs...")
 
 	// Create a new GET request
-	url := fmt.Sprintf("%s/automations/%s/logs", metadata.GitOpsURL, automationDeploymentId)
+	url := fmt.Sprintf("%s/automations/%s/logs", metadata.GitopsURL, automationDeploymentId)
 	if lines > 0 {
 		url += fmt.Sprintf("?lines=%d", lines)
 	}
-	resp, err := automations.SendAutomationRequest("GET", url, metadata.GitOpsSecret)
+	resp, err := automations.SendAutomationRequest("GET", url, metadata.GitopsSecret)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to get logs from automation: %s", resp.Status)
+		return nil, fmt.Errorf("failed to get logs from automation: %s", resp.Status)
 	}
 
-	var automationLog AutomationLog
+	automationLog := AutomationLog{Automation: automationDeploymentId}
 	body, _ := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal([]byte(body), &automationLog)
 	if err != nil {
-		return fmt.Errorf("error decoding JSON: %w", err)
+		return nil, fmt.Errorf("error decoding JSON: %w", err)
 	}
 
-	fmt.Printf("Automation %s logs fetched successfully.\n", automationDeploymentId)
-	fmt.Println("=========================================")
+	fmt.Fprintf(os.Stderr, "Automation %s logs fetched successfully.\n", automationDeploymentId)
+	return &automationLog, nil
+}
+
+func writeLogs(w io.Writer, automationLog *AutomationLog) {
+	fmt.Fprintln(w, "=========================================")
 	if automationLog.Status != "success" {
-		fmt.Printf("Status: %s\n", ansi.RedCheck)
-		fmt.Println("No logs available => check name of the automation or if it is running")
-		return nil
-	} else {
-		fmt.Printf("Status: %s\n", ansi.GreenCheck)
+		fmt.Fprintf(w, "Status: %s\n", ansi.RedCheck)
+		fmt.Fprintln(w, "No logs available => check name of the automation or if it is running")
+		return
 	}
-	fmt.Println("Logs:")
+	fmt.Fprintf(w, "Status: %s\n", ansi.GreenCheck)
+	fmt.Fprintln(w, "Logs:")
 	for _, log := range automationLog.Logs {
-		fmt.Printf("  %s\n", log)
+		fmt.Fprintf(w, "  %s\n", log)
 	}
-
-	return nil
 }
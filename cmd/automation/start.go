@@ -34,12 +34,15 @@ func newStartCmd() *cobra.Command {
 }
 
 func startAutomation(workspaceName, automationDeploymentId string) error {
-	metadata := config.GetWorkspaceMetadata(workspaceName)
+	metadata, err := config.GetWorkspaceMetadata(workspaceName)
+	if err != nil {
+		return err
+	}
 	// Construct the URL for stopping the automation
-	url := fmt.Sprintf("%s/automations/%s/start", metadata.GitOpsURL, automationDeploymentId)
+	url := fmt.Sprintf("%s/automations/%s/start", metadata.GitopsURL, automationDeploymentId)
 
 	// Send the request to stop the automation
-	resp, err := automations.SendAutomationRequest("POST", url, metadata.GitOpsSecret)
+	resp, err := automations.SendAutomationRequest("POST", url, metadata.GitopsSecret)
 	if err != nil {
 		return fmt.Errorf("failed to send request to start automation: %w", err)
 	}
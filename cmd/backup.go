@@ -0,0 +1,559 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/cmd/caddy"
+	"github.com/bitswan-space/bitswan-workspaces/internal/backup"
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/journal"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secretbox"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// passphraseEnv can hold the backup passphrase for non-interactive use
+const passphraseEnv = "BITSWAN_BACKUP_PASSPHRASE"
+
+// archiveExt is the archive format the usage suggests and multi-workspace backups use
+const archiveExt = ".tar.zst"
+
+func newBackupCmd() *cobra.Command {
+	var output, passphraseFile, selector string
+	var encrypt bool
+
+	cmd := &cobra.Command{
+		Use:          "backup <workspace-name> -o <file" + archiveExt + "> | backup <workspace-name>... -o <dir>",
+		Short:        "Back up a workspace into a single archive",
+		Long:         "Back up a workspace into a single archive. When several workspaces are given, or selected with --selector, the output is a directory that receives a <workspace-name>" + archiveExt + " archive per workspace.",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && selector == "" {
+				return fmt.Errorf("specify a workspace name or --selector")
+			}
+			workspaceNames, err := selectWorkspaces(args, false, selector)
+			if err != nil {
+				return err
+			}
+
+			var passphrase string
+			if encrypt {
+				var err error
+				if passphrase, err = readPassphrase(passphraseFile, true); err != nil {
+					return err
+				}
+			}
+
+			// A single workspace goes to the output file, several into the output directory
+			multiple := selector != "" || len(workspaceNames) > 1
+			if multiple {
+				if err := os.MkdirAll(output, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+			}
+
+			return forEachWorkspace(workspaceNames, func(workspaceName string) error {
+				archive := output
+				if multiple {
+					archive = filepath.Join(output, workspaceName+archiveExt)
+				}
+
+				fmt.Printf("Backing up workspace %s...\n", workspaceName)
+				if err := backupWorkspace(workspaceName, archive, encrypt, passphrase); err != nil {
+					os.Remove(archive)
+					return fmt.Errorf("error backing up workspace: %w", err)
+				}
+				fmt.Printf("Workspace %s backed up to %s\n", workspaceName, archive)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Archive to write (.tar.zst, .tar.gz or .tar)")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt secrets, metadata and private keys with a passphrase")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the passphrase from a file instead of prompting (or set "+passphraseEnv+")")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Back up all workspaces matching the label selector, e.g. env=prod")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+func newRestoreCmd() *cobra.Command {
+	var passphraseFile string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "restore <file" + archiveExt + ">",
+		Short:        "Restore a workspace from a backup archive",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			archiveName, err := archiveWorkspace(args[0])
+			if err != nil {
+				return fmt.Errorf("error restoring workspace: %w", err)
+			}
+			// Held until a failed restore is rolled back
+			unlock, err := lockWorkspaces(archiveName)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			j := journal.New()
+			defer func() {
+				if err != nil {
+					fmt.Println("Restore failed, rolling back...")
+					if rbErr := j.Rollback(); rbErr != nil {
+						fmt.Printf("Warning: rollback incomplete: %v\n", rbErr)
+					}
+				}
+			}()
+
+			workspaceName, err := restoreWorkspace(args[0], passphraseFile, verbose, j)
+			if err != nil {
+				return fmt.Errorf("error restoring workspace: %w", err)
+			}
+			fmt.Printf("Workspace %s restored successfully!\n", workspaceName)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the passphrase from a file instead of prompting (or set "+passphraseEnv+")")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+// readPassphrase reads the passphrase from a file, the environment or the terminal
+func readPassphrase(passphraseFile string, confirm bool) (string, error) {
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	prompt := promptui.Prompt{Label: "Passphrase", Mask: '*'}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+
+	if confirm {
+		prompt = promptui.Prompt{Label: "Repeat passphrase", Mask: '*'}
+		repeated, err := prompt.Run()
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if repeated != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func backupWorkspace(workspaceName, output string, encrypt bool, passphrase string) error {
+	bitswanConfig := home.Dir()
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	// The archive has to be a consistent snapshot, no other command may change the workspace meanwhile
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+	// The archive holds the secrets decrypted, the local key does not travel with it
+	metadataData, err := metadata.Marshal()
+	if err != nil {
+		return err
+	}
+
+	images, err := getComposeImages(gitopsConfig)
+	if err != nil {
+		return err
+	}
+
+	// Only the user may read the archive, it holds the secrets decrypted
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer f.Close()
+
+	cw, err := backup.Compress(f, output)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	manifest := backup.Manifest{
+		Version:      backup.ManifestVersion,
+		Workspace:    workspaceName,
+		Domain:       metadata.Domain,
+		CreatedAt:    time.Now().UTC(),
+		Images:       images,
+		WorkspaceDir: gitopsConfig,
+		Home:         os.Getenv("HOME"),
+		Encrypted:    encrypt,
+	}
+	if err := backup.WriteManifest(tw, manifest); err != nil {
+		return err
+	}
+
+	// Sensitive files go to a nested archive that is encrypted as a whole
+	var secrets bytes.Buffer
+	secretsTw := tar.NewWriter(&secrets)
+	metadataName := backup.WorkspacePrefix + config.MetadataFile
+	choose := func(name string) *tar.Writer {
+		if name == metadataName {
+			return nil
+		}
+		if encrypt && backup.IsSensitive(name) {
+			return secretsTw
+		}
+		return tw
+	}
+
+	fmt.Println("Archiving workspace directory...")
+	if err := backup.WriteTree(gitopsConfig, backup.WorkspacePrefix, choose); err != nil {
+		return fmt.Errorf("failed to archive workspace directory: %w", err)
+	}
+	metadataTw := tw
+	if encrypt {
+		metadataTw = secretsTw
+	}
+	if err := backup.WriteFile(metadataTw, metadataName, metadataData, 0600); err != nil {
+		return err
+	}
+
+	certsDir := filepath.Join(bitswanConfig, "caddy", "certs", metadata.Domain)
+	if _, err := os.Stat(certsDir); err == nil {
+		fmt.Println("Archiving TLS certificates...")
+		if err := backup.WriteTree(certsDir, backup.CertsPrefix, choose); err != nil {
+			return fmt.Errorf("failed to archive certificates: %w", err)
+		}
+	}
+
+	if encrypt {
+		if err := secretsTw.Close(); err != nil {
+			return err
+		}
+		fmt.Println("Encrypting secrets...")
+		sealed, err := secretbox.Seal(secrets.Bytes(), passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt secrets: %w", err)
+		}
+		if err := backup.WriteFile(tw, backup.SecretsName, sealed, 0600); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return f.Close()
+}
+
+// archiveWorkspace returns the name of the workspace in a backup archive
+func archiveWorkspace(archivePath string) (string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := backup.Decompress(f, archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	manifest, err := backup.ReadManifest(tar.NewReader(r))
+	if err != nil {
+		return "", err
+	}
+	return manifest.Workspace, nil
+}
+
+func restoreWorkspace(archivePath, passphraseFile string, verbose bool, j *journal.Journal) (string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := backup.Decompress(f, archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	manifest, err := backup.ReadManifest(tr)
+	if err != nil {
+		return "", err
+	}
+
+	workspaceName := manifest.Workspace
+	if workspaceName == "" || workspaceName != filepath.Base(workspaceName) || strings.HasPrefix(workspaceName, ".") {
+		return "", fmt.Errorf("invalid workspace name %q in manifest", workspaceName)
+	}
+	fmt.Printf("Restoring workspace %s (backed up %s)...\n", workspaceName, manifest.CreatedAt.Local().Format(time.RFC1123))
+
+	bitswanConfig := home.Dir()
+	gitopsConfig := filepath.Join(bitswanConfig, "workspaces", workspaceName)
+	if _, err := os.Stat(gitopsConfig); !os.IsNotExist(err) {
+		return "", fmt.Errorf("workspace %s already exists", workspaceName)
+	}
+
+	if err := os.MkdirAll(gitopsConfig, 0755); err != nil {
+		return "", fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	j.Record("create workspace directory "+gitopsConfig, func() error {
+		return removeDirectory(gitopsConfig)
+	})
+
+	certsDir := filepath.Join(bitswanConfig, "caddy", "certs", manifest.Domain)
+	if _, err := os.Stat(certsDir); os.IsNotExist(err) {
+		j.Record("create certs directory "+certsDir, func() error {
+			return os.RemoveAll(certsDir)
+		})
+	}
+
+	var extract func(hdr *tar.Header, r io.Reader) error
+	extract = func(hdr *tar.Header, r io.Reader) error {
+		entry := *hdr
+		switch {
+		case strings.HasPrefix(hdr.Name, backup.WorkspacePrefix):
+			entry.Name = strings.TrimPrefix(hdr.Name, backup.WorkspacePrefix)
+			return backup.Extract(&entry, r, gitopsConfig)
+		case strings.HasPrefix(hdr.Name, backup.CertsPrefix):
+			entry.Name = strings.TrimPrefix(hdr.Name, backup.CertsPrefix)
+			return backup.Extract(&entry, r, certsDir)
+		case hdr.Name == backup.SecretsName:
+			sealed, err := io.ReadAll(r)
+			if err != nil {
+				return fmt.Errorf("failed to read encrypted secrets: %w", err)
+			}
+			passphrase, err := readPassphrase(passphraseFile, false)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Decrypting secrets...")
+			secrets, err := secretbox.Open(sealed, passphrase)
+			if err != nil {
+				return err
+			}
+			return backup.ExtractAll(secrets, extract)
+		}
+		return fmt.Errorf("unexpected entry %s in archive", hdr.Name)
+	}
+
+	fmt.Println("Extracting archive...")
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read archive: %w", err)
+		}
+		if err := extract(hdr, tr); err != nil {
+			return "", err
+		}
+	}
+
+	if err := fixWorkspacePaths(manifest, gitopsConfig); err != nil {
+		return "", err
+	}
+
+	gitopsWorktree := filepath.Join(gitopsConfig, "gitops")
+	safeDirCom := exec.Command("git", "config", "--global", "--add", "safe.directory", gitopsWorktree)
+	if err := runCommandVerbose(safeDirCom, verbose); err != nil {
+		return "", fmt.Errorf("failed to add safe directory: %w", err)
+	}
+	j.Record("add safe.directory "+gitopsWorktree, func() error {
+		unsetCom := exec.Command("git", "config", "--global", "--unset-all", "safe.directory", "^"+regexp.QuoteMeta(gitopsWorktree)+"$")
+		return runCommandVerbose(unsetCom, verbose)
+	})
+
+	ws := workspace.New(workspaceName)
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return "", err
+	}
+	// Encrypt the secrets again with the key of this machine
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return "", err
+	}
+	noIde := metadata.EditorURL == nil
+
+	if !noIde && runtime.GOOS == "linux" {
+		for _, dir := range []string{"secrets", "codeserver-config", "workspace"} {
+			chownCom := exec.Command("sudo", "chown", "-R", "1000:1000", filepath.Join(gitopsConfig, dir))
+			if err := runCommandVerbose(chownCom, verbose); err != nil {
+				return "", fmt.Errorf("failed to change ownership of %s folder: %w", dir, err)
+			}
+		}
+	}
+
+	err = withGlobalLock(func() error {
+		return ensureSharedServices(manifest.Domain, verbose)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	projectName := workspaceName + "-site"
+	deploymentDir := filepath.Join(gitopsConfig, "deployment")
+	j.Record("start docker compose project "+projectName, func() error {
+		downCom := exec.Command("docker", "compose", "-p", projectName, "down", "--volumes")
+		downCom.Dir = deploymentDir
+		return runCommandVerbose(downCom, verbose)
+	})
+
+	fmt.Println("Launching BitSwan Workspace services...")
+	upCom := exec.Command("docker", "compose", "-p", projectName, "up", "-d")
+	upCom.Dir = deploymentDir
+	if err := runCommandVerbose(upCom, true); err != nil {
+		return "", fmt.Errorf("failed to start docker-compose: %w", err)
+	}
+
+	if err := registerCaddyRoutes(workspaceName, manifest.Domain, noIde); err != nil {
+		return "", err
+	}
+
+	return workspaceName, nil
+}
+
+// fixWorkspacePaths rewrites the absolute paths git worktrees and the
+// docker-compose file store, in case the backup was taken in another location
+func fixWorkspacePaths(manifest *backup.Manifest, gitopsConfig string) error {
+	fmt.Println("Fixing up worktree paths...")
+	if err := fixWorktreePaths(gitopsConfig); err != nil {
+		return err
+	}
+
+	var oldnew []string
+	for _, pair := range [][2]string{{manifest.WorkspaceDir, gitopsConfig}, {manifest.Home, os.Getenv("HOME")}} {
+		if pair[0] != "" && pair[0] != pair[1] {
+			oldnew = append(oldnew, pair[0], pair[1])
+		}
+	}
+	replacer := strings.NewReplacer(oldnew...)
+
+	deploymentDir := filepath.Join(gitopsConfig, "deployment")
+	h, err := history.Load(deploymentDir)
+	if err != nil {
+		return err
+	}
+
+	// The revision history and the overlay hold docker-compose files with the same paths
+	composePaths := append(h.Files(), filepath.Join(deploymentDir, "docker-compose.yml"))
+	if _, err := os.Stat(filepath.Join(deploymentDir, dockercompose.OverrideFile)); err == nil {
+		composePaths = append(composePaths, filepath.Join(deploymentDir, dockercompose.OverrideFile))
+	}
+	for _, composePath := range composePaths {
+		compose, err := os.ReadFile(composePath)
+		if err != nil {
+			return fmt.Errorf("error reading docker-compose file: %w", err)
+		}
+		if err := workspace.WriteFile(composePath, []byte(replacer.Replace(string(compose))), 0755); err != nil {
+			return fmt.Errorf("failed to write docker-compose file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// fixWorktreePaths points the workspace repository and the gitops worktree at each
+// other again after they moved, git stores absolute paths for worktrees
+func fixWorktreePaths(gitopsConfig string) error {
+	gitdirPath := filepath.Join(gitopsConfig, "workspace", ".git", "worktrees", "gitops", "gitdir")
+	if err := os.WriteFile(gitdirPath, []byte(filepath.Join(gitopsConfig, "gitops", ".git")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite worktree gitdir: %w", err)
+	}
+
+	worktreeGit := "gitdir: " + filepath.Join(gitopsConfig, "workspace", ".git", "worktrees", "gitops") + "\n"
+	if err := os.WriteFile(filepath.Join(gitopsConfig, "gitops", ".git"), []byte(worktreeGit), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite gitops worktree .git file: %w", err)
+	}
+
+	return dockercompose.RewriteWorktreeGitdir(gitopsConfig)
+}
+
+// ensureSharedServices makes sure the BitSwan network and Caddy are running, which is
+// not the case when a workspace is restored on a fresh machine
+func ensureSharedServices(domain string, verbose bool) error {
+	networkName := home.NetworkName()
+	exists, err := checkNetworkExists(networkName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fmt.Println("Creating BitSwan Docker network...")
+		createCom := exec.Command("docker", "network", "create", networkName)
+		if err := runCommandVerbose(createCom, verbose); err != nil {
+			return fmt.Errorf("failed to create BitSwan Docker network: %w", err)
+		}
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(caddyapi.AdminURL)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	if err := registry.LoginAll(conf.Registry); err != nil {
+		return err
+	}
+
+	if err := caddy.InitCaddy(domain, verbose); err != nil {
+		return fmt.Errorf("failed to initialize Caddy: %w", err)
+	}
+	return nil
+}
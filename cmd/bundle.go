@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/bundle"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockerhub"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
+)
+
+type bundleOptions struct {
+	output      string
+	channel     string
+	gitopsImage string
+	editorImage string
+	verbose     bool
+}
+
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Manage offline bundles for air-gapped installs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(newBundleCreateCmd())
+
+	return cmd
+}
+
+func newBundleCreateCmd() *cobra.Command {
+	o := &bundleOptions{}
+	cmd := &cobra.Command{
+		Use:          "create",
+		Short:        "Create a bundle with the images and examples needed to install without internet",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := createBundle(o); err != nil {
+				return fmt.Errorf("failed to create bundle: %w", err)
+			}
+			fmt.Printf("Bundle written to %s\n", o.output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.output, "output", "o", "bitswan-bundle.tar.gz", "Bundle file, .tar.zst, .tar.gz or .tar")
+	cmd.Flags().StringVar(&o.channel, "channel", dockerhub.Stable, "Release channel of the images: stable, beta or a version prefix such as 2025")
+	cmd.Flags().StringVar(&o.gitopsImage, "gitops-image", "", "Custom image for the gitops")
+	cmd.Flags().StringVar(&o.editorImage, "editor-image", "", "Custom image for the editor")
+	cmd.Flags().BoolVarP(&o.verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func createBundle(o *bundleOptions) error {
+	bitswanConfig := home.Dir()
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	if err := registry.LoginAll(conf.Registry); err != nil {
+		return err
+	}
+
+	gitopsImage, editorImage, err := resolveImages(o.channel, o.gitopsImage, o.editorImage)
+	if err != nil {
+		return err
+	}
+
+	manifest := bundle.Manifest{
+		Version:     bundle.ManifestVersion,
+		CreatedAt:   time.Now().UTC(),
+		Channel:     o.channel,
+		GitopsImage: gitopsImage,
+		EditorImage: editorImage,
+		CaddyImage:  conf.Registry.Image(dockercompose.CaddyImage),
+	}
+
+	for _, image := range manifest.Images() {
+		fmt.Printf("Pulling %s...\n", image)
+		if err := runCommandVerbose(exec.Command("docker", "pull", image), o.verbose); err != nil {
+			return fmt.Errorf("failed to pull %s: %w", image, err)
+		}
+	}
+
+	fmt.Println("Ensuring examples are up to date...")
+	if err := EnsureExamples(bitswanConfig, o.verbose); err != nil {
+		return fmt.Errorf("failed to download examples: %w", err)
+	}
+	examplesDir := filepath.Join(bitswanConfig, "bitswan-src")
+
+	revParse := exec.Command("git", "rev-parse", "HEAD")
+	revParse.Dir = examplesDir
+	if out, err := revParse.Output(); err == nil {
+		manifest.ExamplesCommit = strings.TrimSpace(string(out))
+	}
+
+	return bundle.Create(o.output, manifest, examplesDir, o.verbose)
+}
+
+// useBundle loads the images of an offline bundle and installs its examples, so
+// that a workspace can be set up without network access
+func useBundle(path string, verbose bool) (*bundle.Manifest, error) {
+	b, err := bundle.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Loading images from bundle %s...\n", path)
+	if err := b.LoadImages(verbose); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Installing examples from bundle...")
+	bitswanConfig := home.Dir()
+	if err := os.MkdirAll(bitswanConfig, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create BitSwan config directory: %w", err)
+	}
+	if err := b.InstallExamples(filepath.Join(bitswanConfig, "bitswan-src")); err != nil {
+		return nil, err
+	}
+
+	return b.Manifest, nil
+}
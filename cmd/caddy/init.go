@@ -9,13 +9,19 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bitswan-space/bitswan-workspaces/internal/bundle"
 	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
 func newInitCmd() *cobra.Command {
 	var domain string
+	var bundlePath string
 	var verbose bool
 
 	cmd := &cobra.Command{
@@ -23,6 +29,30 @@ func newInitCmd() *cobra.Command {
 		Short: "Initializes a Caddy",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := config.GetConfig()
+			if err != nil {
+				return err
+			}
+
+			if bundlePath != "" {
+				b, err := bundle.Open(bundlePath)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Loading images from bundle %s...\n", bundlePath)
+				if err := b.LoadImages(verbose); err != nil {
+					return err
+				}
+			} else if err := registry.LoginAll(conf.Registry); err != nil {
+				return err
+			}
+
+			lock, err := workspace.LockGlobal(cmd.CommandPath(), lockTimeout(cmd))
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
+
 			if err := InitCaddy(domain, verbose); err != nil {
 				return fmt.Errorf("failed to initialize Caddy: %w", err)
 			}
@@ -31,6 +61,7 @@ func newInitCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&domain, "domain", "", "The domain to use for the Caddyfile")
+	cmd.Flags().StringVar(&bundlePath, "bundle", "", "Load the Caddy image from an offline bundle instead of pulling it")
 	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 
 	cmd.MarkFlagRequired("domain")
@@ -38,6 +69,14 @@ func newInitCmd() *cobra.Command {
 	return cmd
 }
 
+// lockTimeout returns --lock-timeout of the root command
+func lockTimeout(cmd *cobra.Command) time.Duration {
+	if timeout, err := cmd.Flags().GetDuration("lock-timeout"); err == nil {
+		return timeout
+	}
+	return workspace.DefaultLockTimeout
+}
+
 func runCommandVerbose(cmd *exec.Cmd, verbose bool) error {
 	var stdoutBuf, stderrBuf bytes.Buffer
 
@@ -107,8 +146,7 @@ func runCommandVerbose(cmd *exec.Cmd, verbose bool) error {
 }
 
 func InitCaddy(domain string, verbose bool) error {
-	bitswanConfig := os.Getenv("HOME") + "/.config/bitswan/"
-	caddyConfig := bitswanConfig + "caddy"
+	caddyConfig := home.Path("caddy")
 	caddyCertsDir := caddyConfig + "/certs"
 
 	fmt.Println("Setting up Caddy...")
@@ -128,7 +166,12 @@ func InitCaddy(domain string, verbose bool) error {
 		panic(fmt.Errorf("failed to write Caddyfile: %w", err))
 	}
 
-	caddyDockerCompose, err := dockercompose.CreateCaddyDockerComposeFile(caddyConfig, domain)
+	conf, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	caddyDockerCompose, err := dockercompose.CreateCaddyDockerComposeFile(caddyConfig, domain, conf.Registry.Image(dockercompose.CaddyImage), conf.Caddy.Ports())
 	if err != nil {
 		panic(fmt.Errorf("failed to create Caddy docker-compose file: %w", err))
 	}
@@ -143,7 +186,7 @@ func InitCaddy(domain string, verbose bool) error {
 		panic(fmt.Errorf("failed to change directory to Caddy config: %w", err))
 	}
 
-	caddyProjectName := "bitswan-caddy"
+	caddyProjectName := home.CaddyProject()
 	caddyDockerComposeCom := exec.Command("docker", "compose", "-p", caddyProjectName, "up", "-d")
 
 	// Capture both stdout and stderr
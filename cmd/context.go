@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
+	"github.com/bitswan-space/bitswan-workspaces/internal/remote"
+)
+
+// ContextEnv selects the context, --context takes precedence
+const ContextEnv = "BITSWAN_CONTEXT"
+
+var contextNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// globalValueFlags are the flags of the root command that take a value
+var globalValueFlags = []string{"home", "context", "lock-timeout"}
+
+// localCommands always run on this machine, whatever the context
+var localCommands = map[string]bool{
+	"context":          true,
+	"version":          true,
+	"help":             true,
+	"completion":       true,
+	"__complete":       true,
+	"__completeNoDesc": true,
+}
+
+// remoteCommands are the commands that can run in a remote context, with their subcommands
+var remoteCommands = []string{
+	"bitswan workspace list",
+	"bitswan workspace status",
+	"bitswan workspace update",
+	"bitswan workspace select",
+	"bitswan automation",
+}
+
+// contextInfo is what context list reports about a context
+type contextInfo struct {
+	Name    string `json:"name" yaml:"name"`
+	Current bool   `json:"current" yaml:"current"`
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
+	Home    string `json:"home,omitempty" yaml:"home,omitempty"`
+}
+
+var contextColumns = []output.Column[contextInfo]{
+	{Header: "CURRENT", Value: func(c contextInfo) string {
+		if c.Current {
+			return "*"
+		}
+		return ""
+	}},
+	{Header: "NAME", Value: func(c contextInfo) string { return c.Name }},
+	{Header: "URL", Value: func(c contextInfo) string { return c.URL }},
+	{Header: "HOME", Wide: true, Value: func(c contextInfo) string { return c.Home }},
+}
+
+func newContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Manage the remote hosts bitswan commands run on",
+		Long:  "Manage contexts, remote hosts whose workspaces are managed over SSH. Commands run with --context <name>, or in the context selected with context use, manage the workspaces of the host from this machine: Docker is reached over SSH, the files of the BitSwan home over SFTP and Caddy over a forwarded port.",
+	}
+
+	cmd.AddCommand(newContextAddCmd())
+	cmd.AddCommand(newContextListCmd())
+	cmd.AddCommand(newContextUseCmd())
+	cmd.AddCommand(newContextRemoveCmd())
+
+	return cmd
+}
+
+func newContextAddCmd() *cobra.Command {
+	var c config.Context
+
+	cmd := &cobra.Command{
+		Use:          "add <name> ssh://[user@]host[:port]",
+		Short:        "Add a remote host as a context",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if !contextNamePattern.MatchString(name) || name == config.DefaultContext {
+				return fmt.Errorf("invalid context name %q", name)
+			}
+			target, err := remote.ParseURL(args[1])
+			if err != nil {
+				return err
+			}
+			c.URL = target.String()
+			if c.Home != "" && !path.IsAbs(c.Home) {
+				return fmt.Errorf("--remote-home must be an absolute path")
+			}
+
+			conf, err := config.GetConfig()
+			if err != nil {
+				return err
+			}
+			if _, ok := conf.Contexts[name]; ok {
+				return fmt.Errorf("context %s already exists", name)
+			}
+			if conf.Contexts == nil {
+				conf.Contexts = map[string]config.Context{}
+			}
+			conf.Contexts[name] = c
+			if err := conf.Save(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Context %s added, use it with --context %s or bitswan context use %s.\n", name, name, name)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&c.Home, "remote-home", "", "BitSwan home on the host (default: the default home of the SSH user)")
+
+	return cmd
+}
+
+func newContextListCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the contexts",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
+			conf, err := config.GetConfig()
+			if err != nil {
+				return err
+			}
+			current := currentContext(conf)
+
+			names := make([]string, 0, len(conf.Contexts))
+			for name := range conf.Contexts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			contexts := []contextInfo{{Name: config.DefaultContext, Current: current == config.DefaultContext}}
+			for _, name := range names {
+				c := conf.Contexts[name]
+				contexts = append(contexts, contextInfo{Name: name, Current: current == name, URL: c.URL, Home: c.Home})
+			}
+			return output.Write(cmd.OutOrStdout(), format, contexts, contextColumns)
+		},
+	}
+
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
+
+func newContextUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "use <name>",
+		Short:        "Select the context commands run in, default is this machine",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			conf, err := config.GetConfig()
+			if err != nil {
+				return err
+			}
+			if _, ok := conf.Contexts[name]; !ok && name != config.DefaultContext {
+				return fmt.Errorf("context %s does not exist", name)
+			}
+
+			conf.CurrentContext = name
+			if name == config.DefaultContext {
+				conf.CurrentContext = ""
+			}
+			if err := conf.Save(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Current context set to %s.\n", name)
+			return nil
+		},
+	}
+}
+
+func newContextRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "remove <name>",
+		Short:        "Remove a context, the host and its workspaces are left as they are",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			conf, err := config.GetConfig()
+			if err != nil {
+				return err
+			}
+			if _, ok := conf.Contexts[name]; !ok {
+				return fmt.Errorf("context %s does not exist", name)
+			}
+
+			delete(conf.Contexts, name)
+			if conf.CurrentContext == name {
+				conf.CurrentContext = ""
+			}
+			if err := conf.Save(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Context %s removed.\n", name)
+			return nil
+		},
+	}
+}
+
+// currentContext returns the context selected with context use
+func currentContext(conf *config.Config) string {
+	if conf.CurrentContext == "" {
+		return config.DefaultContext
+	}
+	return conf.CurrentContext
+}
+
+// resolveContext returns the context args run in, nil for this machine. It is
+// --context, BITSWAN_CONTEXT or the context selected with context use.
+func resolveContext(args []string) (string, *config.Context, error) {
+	name := flagValue(args, "context")
+	if name == "" {
+		name = os.Getenv(ContextEnv)
+	}
+	if name == config.DefaultContext {
+		return name, nil, nil
+	}
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		if name == "" {
+			// The commands that need the config report it
+			return config.DefaultContext, nil, nil
+		}
+		return "", nil, err
+	}
+	if name == "" {
+		name = currentContext(conf)
+		if name == config.DefaultContext {
+			return name, nil, nil
+		}
+	}
+
+	c, ok := conf.Contexts[name]
+	if !ok {
+		return "", nil, fmt.Errorf("context %s does not exist", name)
+	}
+	return name, &c, nil
+}
+
+// connectContext connects to the host of a remote context and makes it the
+// host of the BitSwan home for the rest of the command
+func connectContext(name string, c *config.Context) (*remote.Conn, error) {
+	target, err := remote.ParseURL(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", name, err)
+	}
+	conn, err := remote.Dial(target)
+	if err != nil {
+		return nil, err
+	}
+
+	host.Use(conn)
+	// The BitSwan home is the one on the host, --home only locates the contexts
+	home.Set(c.Home)
+	// docker run, ps and inspect reach the daemon of the host from this machine
+	os.Setenv("DOCKER_HOST", conn.DockerHost())
+	os.Unsetenv("DOCKER_CONTEXT")
+	return conn, nil
+}
+
+// runsInRemoteContext reports whether cmd can run in a remote context
+func runsInRemoteContext(cmd *cobra.Command) bool {
+	for _, prefix := range remoteCommands {
+		if cmd.CommandPath() == prefix || strings.HasPrefix(cmd.CommandPath(), prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// runsRemotely reports whether args run in a remote context, commands managing
+// the contexts and the help always run on this machine
+func runsRemotely(args []string) bool {
+	name := commandName(args)
+	return name != "" && !localCommands[name]
+}
+
+// commandName returns the first command in args, skipping the global flags
+func commandName(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return ""
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+		if isGlobalValueFlag(arg) {
+			i++
+		}
+	}
+	return ""
+}
+
+// flagValue returns the value of a global flag given with --name value or --name=value.
+// The commands are added before the flags are parsed, and which are depends on them.
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func isGlobalValueFlag(arg string) bool {
+	for _, name := range globalValueFlags {
+		if arg == "--"+name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+)
+
+func TestGlobalFlags(t *testing.T) {
+	args := []string{"--home", "/srv/bitswan", "--context=prod", "workspace", "env", "set", "alpha", "--", "--home", "x"}
+
+	assert.Equal(t, "/srv/bitswan", flagValue(args, "home"))
+	assert.Equal(t, "prod", flagValue(args, "context"))
+	assert.Empty(t, flagValue([]string{"workspace", "list"}, "context"))
+	assert.Equal(t, "workspace", commandName(args))
+	assert.Equal(t, "context", commandName([]string{"--lock-timeout", "1m", "context", "list"}))
+	assert.Empty(t, commandName([]string{"--context", "prod"}))
+}
+
+func TestResolveContext(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(ContextEnv, "")
+
+	conf := &config.Config{Contexts: map[string]config.Context{"prod": {URL: "ssh://ops@vm1"}}}
+	require.NoError(t, conf.Save())
+
+	name, c, err := resolveContext([]string{"workspace", "list"})
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultContext, name)
+	assert.Nil(t, c)
+
+	name, c, err = resolveContext([]string{"--context", "prod", "workspace", "list"})
+	require.NoError(t, err)
+	assert.Equal(t, "prod", name)
+	assert.Equal(t, "ssh://ops@vm1", c.URL)
+
+	// The current context is overridden by the environment and the flag
+	conf.CurrentContext = "prod"
+	require.NoError(t, conf.Save())
+	_, c, err = resolveContext(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, c)
+	t.Setenv(ContextEnv, "default")
+	_, c, err = resolveContext(nil)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	_, _, err = resolveContext([]string{"--context", "staging", "workspace", "list"})
+	assert.EqualError(t, err, "context staging does not exist")
+
+	assert.True(t, runsRemotely([]string{"--context", "prod", "workspace", "update", "alpha"}))
+	assert.True(t, runsRemotely([]string{"automation", "list"}))
+	assert.False(t, runsRemotely([]string{"context", "list"}))
+	assert.False(t, runsRemotely([]string{"--context", "prod"}))
+}
+
+func TestRunsInRemoteContext(t *testing.T) {
+	root := newRootCmd("")
+	for path, want := range map[string]bool{
+		"workspace list":   true,
+		"workspace update": true,
+		"workspace init":   false,
+		"caddy":            false,
+	} {
+		cmd, _, err := root.Find(strings.Fields(path))
+		require.NoError(t, err)
+		assert.Equal(t, want, runsInRemoteContext(cmd), path)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/textdiff"
+)
+
+func newDiffCmd() *cobra.Command {
+	var merged bool
+
+	cmd := &cobra.Command{
+		Use:          "diff <workspace-name>",
+		Short:        "Show what docker-compose.override.yml changes in the generated docker-compose file",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deploymentDir := home.Path("workspaces", args[0], "deployment")
+			compose, err := os.ReadFile(filepath.Join(deploymentDir, "docker-compose.yml"))
+			if err != nil {
+				return fmt.Errorf("error reading docker-compose file: %w", err)
+			}
+
+			override, err := dockercompose.ReadOverride(deploymentDir)
+			if err != nil {
+				return err
+			}
+			if override == nil {
+				if merged {
+					_, err := cmd.OutOrStdout().Write(compose)
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "No %s in %s, the generated file is used as is.\n", dockercompose.OverrideFile, deploymentDir)
+				return nil
+			}
+
+			result, err := dockercompose.MergeOverride(deploymentDir, compose, override)
+			if err != nil {
+				return err
+			}
+			if merged {
+				_, err := cmd.OutOrStdout().Write(result)
+				return err
+			}
+
+			// Both sides go through docker compose, so that only the overlay shows in the diff
+			generated, err := dockercompose.Config(deploymentDir, compose)
+			if err != nil {
+				return err
+			}
+			diff := textdiff.Unified("docker-compose.yml", "docker-compose.yml + "+dockercompose.OverrideFile, string(generated), string(result))
+			if diff == "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s does not change the generated file.\n", dockercompose.OverrideFile)
+				return nil
+			}
+			fmt.Fprint(cmd.OutOrStdout(), diff)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&merged, "merged", false, "Print the merged docker-compose file instead of the diff")
+
+	return cmd
+}
+
+// checkComposeOverride validates the overlay of the workspace against a newly
+// generated docker-compose file, before the file is written
+func checkComposeOverride(deploymentDir string, compose []byte) error {
+	override, err := dockercompose.ReadOverride(deploymentDir)
+	if err != nil || override == nil {
+		return err
+	}
+	_, err = dockercompose.MergeOverride(deploymentDir, compose, override)
+	return err
+}
@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/health"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Check that the host has everything bitswan needs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
+			checks := runDoctorChecks()
+
+			err := output.WriteObject(cmd.OutOrStdout(), format, checks, func(w io.Writer, wide bool) error {
+				writeDoctorTable(w, checks)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, check := range checks {
+				if check.Status == health.Error {
+					return fmt.Errorf("some prerequisites are missing")
+				}
+			}
+			return nil
+		},
+	}
+
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
+
+func runDoctorChecks() []health.Check {
+	checks := []health.Check{
+		checkDocker(),
+		checkDockerCompose(),
+		checkGit(),
+		checkGitIdentity(),
+		checkMkcert(),
+		checkSudo(),
+		checkBrowserOpener(),
+		checkConfigDirWritable(),
+		checkBitswanNetwork(),
+		checkCaddyContainer(),
+	}
+
+	ports := config.Caddy{}.Ports()
+	if conf, err := config.GetConfig(); err == nil {
+		ports = conf.Caddy.Ports()
+	}
+	for _, port := range []int{ports.HTTP, ports.HTTPS, ports.Admin} {
+		checks = append(checks, checkPort(port))
+	}
+
+	return checks
+}
+
+// commandOutput runs a command and returns its trimmed output
+func commandOutput(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+func checkDocker() health.Check {
+	check := health.Check{Name: "docker"}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		check.Status = health.Error
+		check.Detail = "docker not found in PATH"
+		check.Hint = "Install Docker: https://docs.docker.com/engine/install/"
+		return check
+	}
+
+	version, err := commandOutput("docker", "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = "docker daemon is not reachable"
+		check.Hint = "Start the docker daemon and make sure your user can access it (e.g. add it to the docker group)"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = "server " + version
+	return check
+}
+
+var composeVersionRe = regexp.MustCompile(`^v?(\d+)\.`)
+
+func checkDockerCompose() health.Check {
+	check := health.Check{Name: "docker compose"}
+
+	version, err := commandOutput("docker", "compose", "version", "--short")
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = "docker compose plugin not found"
+		check.Hint = "Install Docker Compose v2: https://docs.docker.com/compose/install/"
+		return check
+	}
+
+	major := 0
+	if match := composeVersionRe.FindStringSubmatch(version); match != nil {
+		major, _ = strconv.Atoi(match[1])
+	}
+	if major < 2 {
+		check.Status = health.Error
+		check.Detail = "version " + version
+		check.Hint = "Docker Compose v2 is required: https://docs.docker.com/compose/install/"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = "version " + version
+	return check
+}
+
+func checkGit() health.Check {
+	check := health.Check{Name: "git"}
+
+	version, err := commandOutput("git", "--version")
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = "git not found in PATH"
+		check.Hint = "Install git with your package manager"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = strings.TrimPrefix(version, "git version ")
+	return check
+}
+
+func checkGitIdentity() health.Check {
+	check := health.Check{Name: "git identity"}
+
+	name, _ := commandOutput("git", "config", "user.name")
+	email, _ := commandOutput("git", "config", "user.email")
+	if name == "" || email == "" {
+		// Only the initial commit of workspaces with --remote needs the identity
+		check.Status = health.Warning
+		check.Detail = "git user.name or user.email is not set"
+		check.Hint = `Run git config --global user.name "Your Name" && git config --global user.email you@example.com`
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = fmt.Sprintf("%s <%s>", name, email)
+	return check
+}
+
+func checkMkcert() health.Check {
+	check := health.Check{Name: "mkcert"}
+
+	version, err := commandOutput("mkcert", "-version")
+	if err != nil {
+		// mkcert is only needed for --mkcerts and --local
+		check.Status = health.Warning
+		check.Detail = "mkcert not found in PATH (needed for --mkcerts and --local)"
+		check.Hint = "Install mkcert: https://github.com/FiloSottile/mkcert#installation"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = version
+	return check
+}
+
+func checkSudo() health.Check {
+	check := health.Check{Name: "sudo"}
+
+	if runtime.GOOS != "linux" {
+		check.Status = health.OK
+		check.Detail = "not needed on " + runtime.GOOS
+		return check
+	}
+
+	if _, err := exec.LookPath("sudo"); err != nil {
+		check.Status = health.Error
+		check.Detail = "sudo not found in PATH"
+		check.Hint = "Install sudo, init uses it to hand workspace directories over to the editor user"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = "available"
+	return check
+}
+
+func checkBrowserOpener() health.Check {
+	check := health.Check{Name: "browser opener"}
+
+	opener := map[string]string{"linux": "xdg-open", "darwin": "open"}[runtime.GOOS]
+	if opener == "" {
+		check.Status = health.OK
+		check.Detail = "not checked on " + runtime.GOOS
+		return check
+	}
+
+	if _, err := exec.LookPath(opener); err != nil {
+		check.Status = health.Warning
+		check.Detail = opener + " not found in PATH (needed for workspace open)"
+		check.Hint = "Install xdg-utils with your package manager"
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = opener
+	return check
+}
+
+func checkConfigDirWritable() health.Check {
+	check := health.Check{Name: "config directory"}
+	bitswanConfig := home.Dir()
+
+	// The directory is created by init, so check the closest existing parent
+	dir := bitswanConfig
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".bitswan-doctor-*")
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = dir + " is not writable"
+		check.Hint = "Fix the ownership with: sudo chown -R $USER " + dir
+		return check
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	check.Status = health.OK
+	check.Detail = bitswanConfig + " is writable"
+	return check
+}
+
+func checkBitswanNetwork() health.Check {
+	networkName := home.NetworkName()
+	check := health.Check{Name: networkName}
+
+	exists, err := checkNetworkExists(networkName)
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = err.Error()
+		check.Hint = "Make sure the docker daemon is running"
+		return check
+	}
+
+	if !exists {
+		check.Status = health.Warning
+		check.Detail = "network does not exist yet"
+		check.Hint = "It is created by workspace init, or run: docker network create " + networkName
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = "exists"
+	return check
+}
+
+func checkCaddyContainer() health.Check {
+	container := home.CaddyContainer()
+	networkName := home.NetworkName()
+	check := health.Check{Name: container}
+
+	state, err := commandOutput("docker", "inspect", "-f", "{{.State.Status}}", container)
+	if err != nil {
+		check.Status = health.Warning
+		check.Detail = container + " container does not exist yet"
+		check.Hint = "It is created by workspace init, or run: bitswan caddy init --domain <domain>"
+		return check
+	}
+
+	if state != "running" {
+		check.Status = health.Error
+		check.Detail = container + " container is " + state
+		check.Hint = "Start it with: docker start " + container
+		return check
+	}
+
+	networks, _ := commandOutput("docker", "inspect", "-f", "{{json .NetworkSettings.Networks}}", container)
+	if !strings.Contains(networks, `"`+networkName+`"`) {
+		check.Status = health.Error
+		check.Detail = container + " container is not attached to " + networkName
+		check.Hint = "Run: docker network connect " + networkName + " " + container
+		return check
+	}
+
+	check.Status = health.OK
+	check.Detail = "running on " + networkName
+	return check
+}
+
+// checkPort verifies that a port needed by Caddy is either free or used by the caddy container
+func checkPort(port int) health.Check {
+	check := health.Check{Name: fmt.Sprintf("port %d", port)}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		check.Status = health.OK
+		check.Detail = "free"
+		return check
+	}
+	conn.Close()
+
+	container, _ := commandOutput("docker", "ps", "--filter", fmt.Sprintf("publish=%d", port), "--format", "{{.Names}}")
+	if container == home.CaddyContainer() {
+		check.Status = health.OK
+		check.Detail = "used by " + container
+		return check
+	}
+
+	owner := container
+	if owner == "" {
+		owner = portOwner(port)
+	}
+	if owner == "" {
+		owner = "another process"
+	}
+
+	check.Status = health.Error
+	check.Detail = "taken by " + owner
+	check.Hint = fmt.Sprintf("Stop %s or free port %d before running workspace init", owner, port)
+	return check
+}
+
+// portOwner tries to find the name of the process listening on a port
+func portOwner(port int) string {
+	pid, err := commandOutput("lsof", "-t", "-sTCP:LISTEN", fmt.Sprintf("-i:%d", port))
+	if err != nil || pid == "" {
+		return ""
+	}
+	pid = strings.Split(pid, "\n")[0]
+
+	name, err := commandOutput("ps", "-p", pid, "-o", "comm=")
+	if err != nil || name == "" {
+		return "pid " + pid
+	}
+	return fmt.Sprintf("%s (pid %s)", name, pid)
+}
+
+func writeDoctorTable(out io.Writer, checks []health.Check) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, check := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, check.Detail)
+	}
+	w.Flush()
+
+	for _, check := range checks {
+		if check.Status != health.OK && check.Hint != "" {
+			fmt.Fprintf(out, "\n%s: %s", check.Name, check.Hint)
+		}
+	}
+	fmt.Fprintln(out)
+}
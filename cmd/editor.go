@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/codeserver"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newEditorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "editor",
+		Short: "Manage the Bitswan Editor of workspaces",
+	}
+
+	cmd.AddCommand(newEditorPasswordCmd())
+
+	return cmd
+}
+
+func newEditorPasswordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "password",
+		Short: "Show or change the password of the editor",
+	}
+
+	cmd.AddCommand(newEditorPasswordShowCmd())
+	cmd.AddCommand(newEditorPasswordRotateCmd())
+
+	return cmd
+}
+
+func newEditorPasswordShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "show <workspace-name>",
+		Short:        "Print the password of the editor, also while the workspace is stopped",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := editorPassword(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), password)
+			return nil
+		},
+	}
+}
+
+func newEditorPasswordRotateCmd() *cobra.Command {
+	var passwordFile string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "rotate <workspace-name>",
+		Short:        "Replace the password of the editor and restart it",
+		Long:         "Replace the password of the editor with a generated one, or reset it to the password in --password-file, and restart only the editor.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password := codeserver.GeneratePassword()
+			if passwordFile != "" {
+				var err error
+				if password, err = readEditorPasswordFile(passwordFile); err != nil {
+					return err
+				}
+			}
+			return rotateEditorPassword(args[0], password, verbose)
+		},
+	}
+
+	cmd.Flags().StringVar(&passwordFile, "password-file", "", "Set the password read from the file instead of generating one")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func rotateEditorPassword(workspaceName, password string, verbose bool) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata.EditorURL == nil {
+		return fmt.Errorf("workspace %s has no editor", workspaceName)
+	}
+
+	if err := writeEditorPassword(gitopsConfig, password); err != nil {
+		return err
+	}
+	metadata.EditorPassword = &password
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return err
+	}
+
+	if workspaceState(workspaceName) == "running" {
+		fmt.Println("Restarting bitswan-editor...")
+		if err := composeProject(workspaceName+"-site", filepath.Join(gitopsConfig, "deployment"), verbose, "restart", "bitswan-editor"); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Bitswan Editor Password: %s\n", password)
+	return nil
+}
+
+// editorPassword returns the password of the editor. Workspaces created by older
+// versions only have it in the code-server config, or in the container when the
+// config directory belongs to the editor user.
+func editorPassword(workspaceName string) (string, error) {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return "", err
+	}
+	if metadata.EditorURL == nil {
+		return "", fmt.Errorf("workspace %s has no editor", workspaceName)
+	}
+	if metadata.EditorPassword != nil {
+		return *metadata.EditorPassword, nil
+	}
+
+	data, err := host.ReadFile(ws.Path("codeserver-config", codeserver.ConfigFile))
+	if err == nil {
+		if password, err := codeserver.Password(data); err == nil && password != "" {
+			return password, nil
+		}
+	}
+	return dockercompose.GetEditorPassword(workspaceName)
+}
+
+// writeEditorPassword puts the hash of the password into the code-server config
+func writeEditorPassword(gitopsConfig, password string) error {
+	existing, err := readEditorConfig(gitopsConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	data, err := codeserver.SetPassword(existing, password)
+	if err != nil {
+		return err
+	}
+	return writeEditorConfig(gitopsConfig, data)
+}
+
+// readEditorConfig reads the code-server config. It belongs to the editor user on
+// Linux and is read through sudo when the current user cannot read it.
+func readEditorConfig(gitopsConfig string) ([]byte, error) {
+	path := filepath.Join(gitopsConfig, "codeserver-config", codeserver.ConfigFile)
+	data, err := host.ReadFile(path)
+	if os.IsPermission(err) && host.GOOS() == "linux" {
+		if host.Command("", "sudo", "test", "-e", path).Run() != nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		if data, err = host.Command("", "sudo", "cat", path).Output(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	return data, err
+}
+
+// writeEditorConfig is the counterpart of readEditorConfig
+func writeEditorConfig(gitopsConfig string, data []byte) error {
+	path := filepath.Join(gitopsConfig, "codeserver-config", codeserver.ConfigFile)
+	err := host.WriteFile(path, data, 0600)
+	if !os.IsPermission(err) || host.GOOS() != "linux" {
+		return err
+	}
+
+	teeCom := host.Command("", "sudo", "tee", path)
+	teeCom.Stdin = bytes.NewReader(data)
+	teeCom.Stdout = io.Discard
+	if err := teeCom.Run(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	chownCom := host.Command("", "sudo", "chown", "1000:1000", path)
+	if err := runCommandVerbose(chownCom, false); err != nil {
+		return fmt.Errorf("failed to change ownership of %s: %w", path, err)
+	}
+	return nil
+}
+
+func readEditorPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read editor password file: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if err := codeserver.ValidatePassword(password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
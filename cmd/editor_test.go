@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/codeserver"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secrets"
+)
+
+func TestEditorPassword(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(secrets.BackendEnv, secrets.File)
+
+	gitopsConfig := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "workspaces", "alpha")
+	require.NoError(t, os.MkdirAll(filepath.Join(gitopsConfig, "codeserver-config"), 0700))
+	editorURL := "https://alpha-editor.example.com"
+
+	// Workspaces of older versions only have the password the editor generated
+	require.NoError(t, config.WriteMetadata(gitopsConfig, &config.Metadata{Domain: "example.com", EditorURL: &editorURL}))
+	require.NoError(t, os.WriteFile(filepath.Join(gitopsConfig, "codeserver-config", codeserver.ConfigFile), []byte("auth: password\npassword: generated\n"), 0600))
+	password, err := editorPassword("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "generated", password)
+
+	require.NoError(t, writeEditorPassword(gitopsConfig, "new-password"))
+	metadata, err := config.ReadMetadata(gitopsConfig)
+	require.NoError(t, err)
+	newPassword := "new-password"
+	metadata.EditorPassword = &newPassword
+	require.NoError(t, config.WriteMetadata(gitopsConfig, metadata))
+
+	password, err = editorPassword("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "new-password", password)
+
+	data, err := os.ReadFile(filepath.Join(gitopsConfig, "codeserver-config", codeserver.ConfigFile))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "new-password")
+	assert.Contains(t, string(data), "hashed-password: "+codeserver.HashPassword("new-password"))
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/envfile"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+var envColumns = []output.Column[envfile.Variable]{
+	{Header: "SERVICE", Value: func(v envfile.Variable) string { return v.Service }},
+	{Header: "KEY", Value: func(v envfile.Variable) string { return v.Key }},
+	{Header: "VALUE", Value: func(v envfile.Variable) string { return v.Value }},
+}
+
+func newEnvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Manage the environment variables of the gitops and editor services",
+		Long:  "Manage the environment variables of the gitops and editor services. The variables are stored in env.yaml of the workspace and survive updates.",
+	}
+
+	cmd.AddCommand(newEnvListCmd())
+	cmd.AddCommand(newEnvSetCmd())
+	cmd.AddCommand(newEnvUnsetCmd())
+
+	return cmd
+}
+
+func newEnvListCmd() *cobra.Command {
+	var service, format string
+	var reveal bool
+
+	cmd := &cobra.Command{
+		Use:          "list <workspace-name>",
+		Short:        "List the environment variables of a workspace",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+			if service != "" {
+				if err := envfile.ValidateService(service); err != nil {
+					return err
+				}
+			}
+
+			ws, err := workspace.Open(args[0])
+			if err != nil {
+				return err
+			}
+			env, err := envfile.Load(ws.Dir)
+			if err != nil {
+				return err
+			}
+			return output.Write(cmd.OutOrStdout(), format, env.List(service, reveal), envColumns)
+		},
+	}
+
+	cmd.Flags().StringVar(&service, "service", "", "Only list the variables of the gitops or editor service")
+	cmd.Flags().BoolVar(&reveal, "reveal", false, "Show the values of secret variables instead of masking them")
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
+
+func newEnvSetCmd() *cobra.Command {
+	var service string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "set <workspace-name> KEY=VALUE...",
+		Short:        "Set environment variables of a workspace service",
+		Long:         "Set environment variables of the gitops (default) or editor service. The service is recreated when the workspace is running.",
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := envfile.ValidateService(service); err != nil {
+				return err
+			}
+			vars, err := envfile.Parse(args[1:])
+			if err != nil {
+				return err
+			}
+
+			return changeEnv(args[0], service, verbose, func(env envfile.Env) error {
+				env.Set(service, vars)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&service, "service", envfile.Gitops, "Service to set the variables on: gitops or editor")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func newEnvUnsetCmd() *cobra.Command {
+	var service string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "unset <workspace-name> KEY...",
+		Short:        "Remove environment variables of a workspace service",
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := envfile.ValidateService(service); err != nil {
+				return err
+			}
+
+			return changeEnv(args[0], service, verbose, func(env envfile.Env) error {
+				if missing := env.Unset(service, args[1:]); len(missing) > 0 {
+					return fmt.Errorf("variables not set on %s: %s", service, strings.Join(missing, ", "))
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&service, "service", envfile.Gitops, "Service to remove the variables from: gitops or editor")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+// changeEnv changes the env file of the workspace, puts the variables into the
+// docker-compose file and recreates only the affected service
+func changeEnv(workspaceName, service string, verbose bool, change func(env envfile.Env) error) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	env, err := envfile.Load(gitopsConfig)
+	if err != nil {
+		return err
+	}
+	previous := env.Environment(service)
+	if err := change(env); err != nil {
+		return err
+	}
+
+	deploymentDir := ws.DeploymentDir()
+	compose, err := ws.ReadCompose()
+	if err != nil {
+		return err
+	}
+
+	serviceName := dockercompose.ServiceName(service)
+	images, err := getComposeImages(gitopsConfig)
+	if err != nil {
+		return err
+	}
+	if _, deployed := images[serviceName]; !deployed {
+		// The variables are applied once the editor is enabled
+		fmt.Printf("The %s service is not deployed, the variables are stored for later.\n", service)
+		return env.Save(gitopsConfig)
+	}
+
+	compose, err = dockercompose.SetEnvironment(compose, service, previous, env.Environment(service))
+	if err != nil {
+		return err
+	}
+	if err := checkComposeOverride(deploymentDir, compose); err != nil {
+		return err
+	}
+
+	if err := env.Save(gitopsConfig); err != nil {
+		return err
+	}
+	if compose, err = writeComposeFiles(deploymentDir, compose, workspace.WriteFile); err != nil {
+		return err
+	}
+	if err := recordRevision(gitopsConfig, compose, "env"); err != nil {
+		return err
+	}
+
+	if workspaceState(workspaceName) != "running" {
+		fmt.Println("Environment updated, it is applied when the workspace starts.")
+		return nil
+	}
+	fmt.Printf("Recreating %s...\n", serviceName)
+	if err := composeProject(workspaceName+"-site", deploymentDir, verbose, "up", "-d", "--no-deps", serviceName); err != nil {
+		return err
+	}
+	fmt.Println("Environment updated.")
+	return nil
+}
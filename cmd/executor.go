@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/plan"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// executor performs the side effects of a command. In dry-run mode nothing
+// is touched, every side effect is only recorded in the plan.
+type executor struct {
+	dryRun  bool
+	verbose bool
+	plan    *plan.Plan
+}
+
+func newExecutor(workspaceName string, dryRun, verbose bool) *executor {
+	return &executor{
+		dryRun:  dryRun,
+		verbose: verbose,
+		plan:    plan.New(workspaceName),
+	}
+}
+
+func (e *executor) mkdirAll(description, path string, perm os.FileMode) error {
+	if e.dryRun {
+		e.plan.Add(plan.Action{Kind: plan.Mkdir, Description: description, Path: path})
+		return nil
+	}
+	return os.MkdirAll(path, perm)
+}
+
+func (e *executor) writeFile(description, path string, data []byte, perm os.FileMode) error {
+	if e.dryRun {
+		e.plan.Add(plan.Action{Kind: plan.Write, Description: description, Path: path, Content: string(data)})
+		return nil
+	}
+	return workspace.WriteFile(path, data, perm)
+}
+
+// copyFile copies a file without showing its content in the plan (certificates, keys)
+func (e *executor) copyFile(description, src, dst string, perm os.FileMode) error {
+	if e.dryRun {
+		e.plan.Add(plan.Action{Kind: plan.Copy, Description: description, Source: src, Path: dst})
+		return nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, perm)
+}
+
+func (e *executor) run(description string, cmd *exec.Cmd, verbose bool) error {
+	if e.dryRun {
+		e.plan.Add(plan.Action{Kind: plan.Exec, Description: description, Command: cmd.Args, Dir: cmd.Dir})
+		return nil
+	}
+	return runCommandVerbose(cmd, verbose || e.verbose)
+}
+
+func (e *executor) caddy(description string, requests ...caddyapi.Request) error {
+	if e.dryRun {
+		for _, req := range requests {
+			e.plan.Add(plan.Action{Kind: plan.Caddy, Description: description, Method: req.Method, URL: req.URL, Payload: req.Payload})
+		}
+		return nil
+	}
+	return withGlobalLock(func() error {
+		for _, req := range requests {
+			if err := caddyapi.Send(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withGlobalLock runs fn holding the global lock, a dry run changes nothing shared and takes no lock
+func (e *executor) withGlobalLock(fn func() error) error {
+	if e.dryRun {
+		return fn()
+	}
+	return withGlobalLock(fn)
+}
+
+// request records a call to an external HTTP API. It is only used in dry-run mode,
+// where responses are not available.
+func (e *executor) request(description, method, url string, payload []byte) {
+	e.plan.Add(plan.Action{Kind: plan.HTTP, Description: description, Method: method, URL: url, Payload: payload})
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:          "history <workspace-name>",
+		Short:        "List the deployed revisions of a workspace",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
+			gitopsConfig := home.Path("workspaces", args[0])
+			if _, err := os.Stat(gitopsConfig); os.IsNotExist(err) {
+				return fmt.Errorf("workspace %s does not exist", args[0])
+			}
+
+			h, err := history.Load(filepath.Join(gitopsConfig, "deployment"))
+			if err != nil {
+				return err
+			}
+			revisions := h.Revisions
+			if revisions == nil {
+				revisions = []history.Revision{}
+			}
+			return output.WriteObject(cmd.OutOrStdout(), format, revisions, func(w io.Writer, wide bool) error {
+				if len(h.Revisions) == 0 {
+					fmt.Fprintln(w, "No revisions recorded yet, they are recorded on every update.")
+					return nil
+				}
+				writeHistoryTable(w, h)
+				return nil
+			})
+		},
+	}
+
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
+
+func writeHistoryTable(out io.Writer, h *history.History) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tCREATED\tREASON\tIMAGES")
+
+	current := h.Current().Number
+	for _, revision := range h.Revisions {
+		number := fmt.Sprint(revision.Number)
+		if revision.Number == current {
+			number += " (current)"
+		}
+
+		services := make([]string, 0, len(revision.Images))
+		for service := range revision.Images {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+
+		var images []string
+		for _, service := range services {
+			images = append(images, revision.Images[service])
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", number, revision.CreatedAt.Local().Format("2006-01-02 15:04:05"), revision.Reason, strings.Join(images, ", "))
+	}
+	w.Flush()
+}
+
+// recordRevision adds the docker-compose file to the revision history of the workspace
+func recordRevision(gitopsConfig string, compose []byte, reason string) error {
+	h, err := history.Load(filepath.Join(gitopsConfig, "deployment"))
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.Record(compose, reason); err != nil {
+		return fmt.Errorf("failed to record revision: %w", err)
+	}
+	return nil
+}
+
+// recordInitialRevision records the current docker-compose file of workspaces created
+// before the revision history existed, so that their first update can be rolled back
+func recordInitialRevision(gitopsConfig string) error {
+	deploymentDir := filepath.Join(gitopsConfig, "deployment")
+	h, err := history.Load(deploymentDir)
+	if err != nil {
+		return err
+	}
+	if h.Current() != nil {
+		return nil
+	}
+
+	compose, err := host.ReadFile(filepath.Join(deploymentDir, "docker-compose.yml"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading docker-compose file: %w", err)
+	}
+
+	// Workspaces this old have their secrets inline, the history keeps none. The
+	// services load them from the env files the caller writes next.
+	compose, _, err = dockercompose.ExternalizeSecrets(compose)
+	if err != nil {
+		return err
+	}
+
+	return recordRevision(gitopsConfig, compose, "initial")
+}
@@ -10,18 +10,26 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"gopkg.in/yaml.v3"
-
 	"github.com/bitswan-space/bitswan-workspaces/cmd/caddy"
+	"github.com/bitswan-space/bitswan-workspaces/internal/bundle"
 	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/codeserver"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockerhub"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/journal"
+	"github.com/bitswan-space/bitswan-workspaces/internal/labels"
+	"github.com/bitswan-space/bitswan-workspaces/internal/plan"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
 	"github.com/spf13/cobra"
 )
 
@@ -36,6 +44,17 @@ type initOptions struct {
 	local       bool
 	gitopsImage string
 	editorImage string
+	channel     string
+	labels      []string
+	override    string
+	// editorPassword is generated when neither it nor editorPasswordFile is given
+	editorPassword     string
+	editorPasswordFile string
+	limits             dockercompose.Limits
+	bundle             string
+	keepOnFailure      bool
+	dryRun             bool
+	output             string
 }
 
 type DockerNetwork struct {
@@ -49,21 +68,11 @@ type DockerNetwork struct {
 	Scope     string `json:"Scope"`
 }
 
-type MetadataInit struct {
-	Domain       string  `yaml:"domain"`
-	EditorURL    *string `yaml:"editor-url,omitempty"`
-	GitopsURL    string  `yaml:"gitops-url"`
-	GitopsSecret string  `yaml:"gitops-secret"`
-	WorkspaceId  *string `yaml:"workspace_id,omitempty"`
-	MqttUsername *int    `yaml:"mqtt_username,omitempty"`
-	MqttPassword *string `yaml:"mqtt_password,omitempty"`
-	MqttBroker   *string `yaml:"mqtt_broker,omitempty"`
-	MqttPort     *int    `yaml:"mqtt_port,omitempty"`
-	MqttTopic    *string `yaml:"mqtt_topic,omitempty"`
-}
-
 func defaultInitOptions() *initOptions {
-	return &initOptions{}
+	return &initOptions{
+		output:  "text",
+		channel: dockerhub.Stable,
+	}
 }
 
 func newInitCmd() *cobra.Command {
@@ -80,12 +89,22 @@ func newInitCmd() *cobra.Command {
 	cmd.Flags().StringVar(&o.domain, "domain", "", "The domain to use for the Caddyfile")
 	cmd.Flags().StringVar(&o.certsDir, "certs-dir", "", "The directory where the certificates are located")
 	cmd.Flags().BoolVar(&o.noIde, "no-ide", false, "Do not start Bitswan Editor")
+	cmd.Flags().StringVar(&o.editorPassword, "editor-password", "", "Password of Bitswan Editor, generated when not given")
+	cmd.Flags().StringVar(&o.editorPasswordFile, "editor-password-file", "", "Read the password of Bitswan Editor from a file")
 	cmd.Flags().BoolVarP(&o.verbose, "verbose", "v", false, "Verbose output")
 	cmd.Flags().BoolVar(&o.mkCerts, "mkcerts", false, "Automatically generate local certificates using the mkcerts utility")
 	cmd.Flags().BoolVar(&o.setHosts, "set-hosts", false, "Automatically set hosts to /etc/hosts file")
 	cmd.Flags().BoolVar(&o.local, "local", false, "Automatically use flag --set-hosts and --mkcerts. If no domain is set defaults to bs-<workspacename>.localhost")
 	cmd.Flags().StringVar(&o.gitopsImage, "gitops-image", "", "Custom image for the gitops")
 	cmd.Flags().StringVar(&o.editorImage, "editor-image", "", "Custom image for the editor")
+	cmd.Flags().StringVar(&o.channel, "channel", o.channel, "Release channel of the images: stable, beta or a version prefix such as 2025")
+	cmd.Flags().StringArrayVar(&o.labels, "label", nil, "Label the workspace with key=value, can be repeated")
+	addLimitsFlags(cmd, &o.limits)
+	cmd.Flags().StringVar(&o.override, "compose-override", "", "docker-compose.override.yml to merge with the generated docker-compose file")
+	cmd.Flags().StringVar(&o.bundle, "bundle", "", "Install from an offline bundle created with 'bitswan bundle create', without network access")
+	cmd.Flags().BoolVar(&o.keepOnFailure, "keep-on-failure", false, "Do not roll back a partially initialized workspace when init fails")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "Print the execution plan without changing anything")
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "Output format of the dry-run plan (text or json)")
 
 	return cmd
 }
@@ -191,18 +210,18 @@ func EnsureExamples(bitswanConfig string, verbose bool) error {
 	targetDir := filepath.Join(bitswanConfig, "bitswan-src")
 
 	// Check if the directory exists and contains a git repository
-	if _, err := os.Stat(filepath.Join(targetDir, ".git")); os.IsNotExist(err) {
+	if _, err := host.Stat(filepath.Join(targetDir, ".git")); os.IsNotExist(err) {
 		// Directory doesn't exist or is not a git repo, clone it
 		if verbose {
 			fmt.Printf("Cloning BitSwan repository to %s\n", targetDir)
 		}
 
 		// Create parent directory if it doesn't exist
-		if err := os.MkdirAll(filepath.Dir(targetDir), 0755); err != nil {
+		if err := host.MkdirAll(filepath.Dir(targetDir), 0755); err != nil {
 			return fmt.Errorf("failed to create parent directory: %w", err)
 		}
 
-		cmd := exec.Command("git", "clone", repoURL, targetDir)
+		cmd := host.Command("", "git", "clone", repoURL, targetDir)
 		if err := runCommandVerbose(cmd, verbose); err != nil {
 			return fmt.Errorf("failed to clone repository: %w", err)
 		}
@@ -228,8 +247,7 @@ func UpdateExamples(bitswanConfig string, verbose bool) error {
 		fmt.Printf("Updating BitSwan repository at %s\n", repoPath)
 	}
 
-	cmd := exec.Command("git", "pull")
-	cmd.Dir = repoPath
+	cmd := host.Command(repoPath, "git", "pull")
 
 	if err := runCommandVerbose(cmd, verbose); err != nil {
 		return fmt.Errorf("failed to update repository: %w", err)
@@ -284,7 +302,7 @@ func generateWildcardCerts(domain string) (string, error) {
 	return tempDir, nil
 }
 
-func setHosts(workspaceName string, o *initOptions) error {
+func setHosts(e *executor, workspaceName string, o *initOptions) error {
 	fmt.Println("Checking if the user has permission to write to /etc/hosts...")
 	fileInfo, err := os.Stat("/etc/hosts")
 	if err != nil {
@@ -314,9 +332,14 @@ func setHosts(workspaceName string, o *initOptions) error {
 
 	fmt.Println("Adding record to /etc/hosts...")
 	for _, entry := range hostsEntries {
+		if e.dryRun {
+			e.plan.Add(plan.Action{Kind: plan.Hosts, Description: "Add /etc/hosts record", Path: "/etc/hosts", Content: entry})
+			continue
+		}
+
 		cmdStr := "echo '" + entry + "' | sudo tee -a /etc/hosts"
 		addHostsCom := exec.Command("sh", "-c", cmdStr)
-		if err := runCommandVerbose(addHostsCom, o.verbose); err != nil {
+		if err := e.run("Append record to /etc/hosts", addHostsCom, false); err != nil {
 			return fmt.Errorf("unable to write into '/etc/hosts'. \n Please add the records manually")
 		}
 	}
@@ -326,13 +349,19 @@ func setHosts(workspaceName string, o *initOptions) error {
 }
 
 // After displaying the information, save it to metadata.yaml
-func saveMetadata(gitopsConfig, workspaceName, token, domain string, noIde bool, workspaceId *string, mqttEnvVars []string) error {
-	metadata := MetadataInit{
+func saveMetadata(e *executor, gitopsConfig, workspaceName, token, domain, channel string, workspaceLabels map[string]string, limits dockercompose.Limits, noIde bool, editorPassword string, workspaceId *string, mqttEnvVars []string) error {
+	metadata := config.Metadata{
 		Domain:       domain,
+		Channel:      channel,
+		Labels:       workspaceLabels,
 		GitopsURL:    fmt.Sprintf("https://%s-gitops.%s", workspaceName, domain),
 		GitopsSecret: token,
 	}
 
+	if !limits.IsZero() {
+		metadata.Limits = &limits
+	}
+
 	if workspaceId != nil {
 		metadata.WorkspaceId = workspaceId
 	}
@@ -343,11 +372,7 @@ func saveMetadata(gitopsConfig, workspaceName, token, domain string, noIde bool,
 			key, value, _ := strings.Cut(envVar, "=")
 			switch key {
 			case "MQTT_USERNAME":
-				username, err := strconv.Atoi(value)
-				if err != nil {
-					return fmt.Errorf("failed to convert MQTT_USERNAME: %w", err)
-				}
-				metadata.MqttUsername = &username
+				metadata.MqttUsername = &value
 			case "MQTT_PASSWORD":
 				metadata.MqttPassword = &value
 			case "MQTT_BROKER":
@@ -368,47 +393,106 @@ func saveMetadata(gitopsConfig, workspaceName, token, domain string, noIde bool,
 	if !noIde {
 		editorURL := fmt.Sprintf("https://%s-editor.%s", workspaceName, domain)
 		metadata.EditorURL = &editorURL
+		metadata.EditorPassword = &editorPassword
+	}
+
+	// A dry run must not create the secrets key
+	if !e.dryRun {
+		var err error
+		if metadata, err = metadata.Encrypted(); err != nil {
+			return err
+		}
 	}
 
 	// Marshal to YAML
-	yamlData, err := yaml.Marshal(metadata)
+	yamlData, err := metadata.Marshal()
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return err
 	}
 
 	// Write to file
-	metadataPath := filepath.Join(gitopsConfig, "metadata.yaml")
-	if err := os.WriteFile(metadataPath, yamlData, 0644); err != nil {
+	metadataPath := filepath.Join(gitopsConfig, config.MetadataFile)
+	if err := e.writeFile("Write workspace metadata", metadataPath, yamlData, 0644); err != nil {
 		return fmt.Errorf("failed to write metadata file: %w", err)
 	}
 
 	return nil
 }
 
-func (o *initOptions) run(cmd *cobra.Command, args []string) error {
+func (o *initOptions) run(cmd *cobra.Command, args []string) (err error) {
 	// The first argument is the workspace name
 	workspaceName := args[0]
-	bitswanConfig := os.Getenv("HOME") + "/.config/bitswan/"
+	j := journal.New()
+	e := newExecutor(workspaceName, o.dryRun, o.verbose)
 
-	if _, err := os.Stat(bitswanConfig); os.IsNotExist(err) {
-		if err := os.MkdirAll(bitswanConfig, 0755); err != nil {
-			return fmt.Errorf("failed to create BitSwan config directory: %w", err)
+	// Held until a failed init is rolled back, a dry run changes nothing and takes no lock
+	if !o.dryRun {
+		unlock, err := lockWorkspaces(workspaceName)
+		if err != nil {
+			return err
 		}
+		defer unlock()
 	}
 
-	// Init bitswan network
-	networkName := "bitswan_network"
+	if o.dryRun {
+		if o.output != "text" && o.output != "json" {
+			return fmt.Errorf("unsupported output format: %s", o.output)
+		}
+
+		// Keep stdout for the plan only, so that it can be piped to other tools
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() {
+			os.Stdout = stdout
+			if err == nil {
+				err = e.plan.Write(cmd.OutOrStdout(), o.output)
+			}
+		}()
+	}
+
+	// Unwind everything that was done so far when any step fails or panics,
+	// so that a half-built workspace does not block a retry
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		if err == nil || o.dryRun {
+			return
+		}
+
+		if o.keepOnFailure {
+			fmt.Println("Initialization failed, keeping the partially initialized workspace (--keep-on-failure):")
+			for _, step := range j.Steps() {
+				fmt.Printf("  - %s\n", step.Description)
+			}
+			return
+		}
+
+		fmt.Println("Initialization failed, rolling back...")
+		if rollbackErr := j.Rollback(); rollbackErr != nil {
+			fmt.Printf("\033[33mWarning: rollback was incomplete: %v\033[0m\n", rollbackErr)
+		} else {
+			fmt.Println("Rollback finished.")
+		}
+	}()
+
+	return o.initWorkspace(workspaceName, e, j)
+}
+
+// ensureBitswanNetwork creates the Docker network all workspaces share, when it is missing
+func ensureBitswanNetwork(e *executor) error {
+	networkName := home.NetworkName()
 	exists, err := checkNetworkExists(networkName)
 	if err != nil {
-		panic(fmt.Errorf("Error checking network: %v\n", err))
+		return fmt.Errorf("error checking network: %w", err)
 	}
 
 	if exists {
 		fmt.Printf("Network '%s' exists\n", networkName)
 	} else {
-		createDockerNetworkCom := exec.Command("docker", "network", "create", "bitswan_network")
+		createDockerNetworkCom := exec.Command("docker", "network", "create", networkName)
 		fmt.Println("Creating BitSwan Docker network...")
-		if err := runCommandVerbose(createDockerNetworkCom, o.verbose); err != nil {
+		if err := e.run("Create BitSwan Docker network", createDockerNetworkCom, false); err != nil {
 			if err.Error() == "exit status 1" {
 				fmt.Println("BitSwan Docker network already exists!")
 			} else {
@@ -418,40 +502,95 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 			fmt.Println("BitSwan Docker network created!")
 		}
 	}
+	return nil
+}
 
-	// Init shared Caddy if not exists
-	caddyConfig := bitswanConfig + "caddy"
-
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println(r)
-			fmt.Println("Failed to start Caddy.")
+// useBundle loads the offline bundle and uses its images in place of the ones of the release channel
+func (o *initOptions) useBundle(e *executor) error {
+	var manifest *bundle.Manifest
+	if e.dryRun {
+		b, err := bundle.Open(o.bundle)
+		if err != nil {
+			return err
 		}
-	}()
+		manifest = b.Manifest
+		e.plan.Add(plan.Action{Kind: plan.Exec, Description: "Load images from bundle", Command: []string{"docker", "load"}, Source: o.bundle})
+		e.plan.Add(plan.Action{Kind: plan.Exec, Description: "Install examples from bundle", Source: o.bundle})
+	} else {
+		var err error
+		if manifest, err = useBundle(o.bundle, o.verbose); err != nil {
+			return fmt.Errorf("failed to use bundle: %w", err)
+		}
+	}
 
-	client := &http.Client{
-		Timeout: 2 * time.Second,
+	if o.gitopsImage == "" {
+		o.gitopsImage = manifest.GitopsImage
 	}
-	resp, err := client.Get("http://localhost:2019")
-	caddy_running := true
-	if err != nil {
-		caddy_running = false
-	} else {
-		defer resp.Body.Close()
+	if o.editorImage == "" {
+		o.editorImage = manifest.EditorImage
+	}
+	return nil
+}
+
+// removeDirectory removes a directory created by init. Parts of the workspace
+// are chowned to the editor user, so fall back to sudo when that is needed.
+func removeDirectory(path string) error {
+	err := os.RemoveAll(path)
+	if err != nil && runtime.GOOS == "linux" {
+		return exec.Command("sudo", "rm", "-rf", path).Run()
+	}
+	return err
+}
+
+// resolveEditorPassword settles the password the editor starts with
+func (o *initOptions) resolveEditorPassword() error {
+	if o.editorPassword != "" && o.editorPasswordFile != "" {
+		return fmt.Errorf("cannot use --editor-password with --editor-password-file")
+	}
+	if o.noIde {
+		if o.editorPassword != "" || o.editorPasswordFile != "" {
+			return fmt.Errorf("cannot set an editor password with --no-ide")
+		}
+		return nil
 	}
 
-	if !caddy_running {
-		err = caddy.InitCaddy(o.domain, o.verbose)
+	switch {
+	case o.editorPasswordFile != "":
+		password, err := readEditorPasswordFile(o.editorPasswordFile)
 		if err != nil {
-			return fmt.Errorf("failed to initialize Caddy: %w", err)
+			return err
 		}
-	} else {
-		fmt.Println("A running instance of Caddy with admin found")
+		o.editorPassword = password
+	case o.editorPassword != "":
+		return codeserver.ValidatePassword(o.editorPassword)
+	default:
+		o.editorPassword = codeserver.GeneratePassword()
+	}
+	return nil
+}
+
+func (o *initOptions) initWorkspace(workspaceName string, e *executor, j *journal.Journal) error {
+	bitswanConfig := home.Dir()
+	gitopsConfig := config.WorkspaceDir(workspaceName)
+
+	if _, err := os.Stat(gitopsConfig); !os.IsNotExist(err) {
+		return fmt.Errorf("GitOps with this name was already initialized: %s", workspaceName)
+	}
+
+	workspaceLabels, err := labels.Parse(o.labels)
+	if err != nil {
+		return err
+	}
+	if err := o.limits.Validate(); err != nil {
+		return err
+	}
+	if err := o.resolveEditorPassword(); err != nil {
+		return err
 	}
 
 	// Secure that --local flag is not used with --set-hosts or --mkcerts
 	if o.local && (o.setHosts || o.mkCerts) {
-		panic(fmt.Errorf("Cannot use --local flag with --set-hosts or --mkcerts"))
+		return fmt.Errorf("cannot use --local flag with --set-hosts or --mkcerts")
 	}
 
 	if o.local {
@@ -462,74 +601,140 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if _, err := os.Stat(bitswanConfig); os.IsNotExist(err) {
+		if err := e.mkdirAll("Create BitSwan config directory", bitswanConfig, 0755); err != nil {
+			return fmt.Errorf("failed to create BitSwan config directory: %w", err)
+		}
+	}
+
+	// Init bitswan network. The network is shared by all workspaces,
+	// so it is never removed on rollback.
+	if err := e.withGlobalLock(func() error { return ensureBitswanNetwork(e) }); err != nil {
+		return err
+	}
+
+	// The bundle provides the images, including Caddy's, and the examples
+	if o.bundle != "" {
+		if err := o.useBundle(e); err != nil {
+			return err
+		}
+	} else if !e.dryRun {
+		conf, err := config.GetConfig()
+		if err != nil {
+			return err
+		}
+		if err := registry.LoginAll(conf.Registry); err != nil {
+			return err
+		}
+	}
+
+	// Init shared Caddy if not exists. Caddy is shared as well and stays up on rollback.
+	caddyConfig := filepath.Join(bitswanConfig, "caddy")
+
+	// Checked under the lock, so that concurrent inits do not both initialize Caddy
+	err = e.withGlobalLock(func() error {
+		client := &http.Client{
+			Timeout: 2 * time.Second,
+		}
+		resp, err := client.Get(caddyapi.AdminURL)
+		caddy_running := true
+		if err != nil {
+			caddy_running = false
+		} else {
+			defer resp.Body.Close()
+		}
+
+		if !caddy_running {
+			if e.dryRun {
+				e.plan.Add(plan.Action{
+					Kind:        plan.Exec,
+					Description: "Initialize shared Caddy",
+					Command:     []string{"docker", "compose", "-p", home.CaddyProject(), "up", "-d"},
+					Dir:         caddyConfig,
+				})
+			} else {
+				err = caddy.InitCaddy(o.domain, o.verbose)
+				if err != nil {
+					return fmt.Errorf("failed to initialize Caddy: %w", err)
+				}
+			}
+		} else {
+			fmt.Println("A running instance of Caddy with admin found")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	inputCertsDir := o.certsDir
 
 	if o.mkCerts {
-		certDir, err := generateWildcardCerts(o.domain)
-		if err != nil {
-			return fmt.Errorf("Error generating certificates: %v\n", err)
+		if e.dryRun {
+			inputCertsDir = "<mkcert output>"
+			e.plan.Add(plan.Action{Kind: plan.Exec, Description: "Generate wildcard certificates", Command: []string{"mkcert", "*." + o.domain}})
+		} else {
+			certDir, err := generateWildcardCerts(o.domain)
+			if err != nil {
+				return fmt.Errorf("error generating certificates: %w", err)
+			}
+			inputCertsDir = certDir
 		}
-		inputCertsDir = certDir
 	}
 
 	if inputCertsDir != "" {
 		fmt.Println("Installing certs from", inputCertsDir)
 		caddyCertsDir := caddyConfig + "/certs"
 		if _, err := os.Stat(caddyCertsDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(caddyCertsDir, 0755); err != nil {
+			if err := e.mkdirAll("Create Caddy certs directory", caddyCertsDir, 0755); err != nil {
 				return fmt.Errorf("failed to create Caddy certs directory: %w", err)
 			}
 		}
 
 		certsDir := caddyCertsDir + "/" + o.domain
 		if _, err := os.Stat(certsDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(certsDir, 0755); err != nil {
+			if err := e.mkdirAll("Create certs directory for "+o.domain, certsDir, 0755); err != nil {
 				return fmt.Errorf("failed to create certs directory: %w", err)
 			}
+			j.Record("create certs directory "+certsDir, func() error {
+				return os.RemoveAll(certsDir)
+			})
 		}
 
-		certs, err := os.ReadDir(inputCertsDir)
-		if err != nil {
-			panic(fmt.Errorf("Failed to read certs directory: %w", err))
-		}
-
-		for _, cert := range certs {
-			if cert.IsDir() {
-				continue
+		if e.dryRun {
+			// The certificates may not exist yet (mkcert), only show where they are copied
+			if err := e.copyFile("Copy certificates", inputCertsDir, certsDir, 0755); err != nil {
+				return err
 			}
-
-			certPath := inputCertsDir + "/" + cert.Name()
-			newCertPath := certsDir + "/" + cert.Name()
-
-			bytes, err := os.ReadFile(certPath)
+		} else {
+			certs, err := os.ReadDir(inputCertsDir)
 			if err != nil {
-				panic(fmt.Errorf("Failed to read cert file: %w", err))
+				return fmt.Errorf("failed to read certs directory: %w", err)
 			}
 
-			if err := os.WriteFile(newCertPath, bytes, 0755); err != nil {
-				panic(fmt.Errorf("Failed to copy cert file: %w", err))
-			}
-		}
-
-		fmt.Println("Certs copied successfully!")
-	}
+			for _, cert := range certs {
+				if cert.IsDir() {
+					continue
+				}
 
-	gitopsConfig := bitswanConfig + "workspaces/" + workspaceName
+				certPath := inputCertsDir + "/" + cert.Name()
+				newCertPath := certsDir + "/" + cert.Name()
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println(r)
-			fmt.Println("Failed to initialize GitOps.")
+				if err := e.copyFile("Copy certificate "+cert.Name(), certPath, newCertPath, 0755); err != nil {
+					return fmt.Errorf("failed to copy cert file: %w", err)
+				}
+			}
 		}
-	}()
 
-	if _, err := os.Stat(gitopsConfig); !os.IsNotExist(err) {
-		return fmt.Errorf("GitOps with this name was already initialized: %s", workspaceName)
+		fmt.Println("Certs copied successfully!")
 	}
 
-	if err := os.MkdirAll(gitopsConfig, 0755); err != nil {
+	if err := e.mkdirAll("Create workspace directory", gitopsConfig, 0755); err != nil {
 		return fmt.Errorf("failed to create GitOps directory: %w", err)
 	}
+	j.Record("create workspace directory "+gitopsConfig, func() error {
+		return removeDirectory(gitopsConfig)
+	})
 
 	// Initialize Bitswan workspace
 	gitopsWorkspace := gitopsConfig + "/workspace"
@@ -537,12 +742,12 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 		com := exec.Command("git", "clone", o.remoteRepo, gitopsWorkspace) //nolint:gosec
 
 		fmt.Println("Cloning remote repository...")
-		if err := runCommandVerbose(com, o.verbose); err != nil {
-			panic(fmt.Errorf("Failed to clone remote repository: %w", err))
+		if err := e.run("Clone remote repository", com, false); err != nil {
+			return fmt.Errorf("failed to clone remote repository: %w", err)
 		}
 		fmt.Println("Remote repository cloned!")
 	} else {
-		if err := os.Mkdir(gitopsWorkspace, 0755); err != nil {
+		if err := e.mkdirAll("Create workspace repository directory", gitopsWorkspace, 0755); err != nil {
 			return fmt.Errorf("failed to create GitOps workspace directory %s: %w", gitopsWorkspace, err)
 		}
 		com := exec.Command("git", "init")
@@ -550,8 +755,8 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 
 		fmt.Println("Initializing git in workspace...")
 
-		if err := runCommandVerbose(com, o.verbose); err != nil {
-			panic(fmt.Errorf("Failed to init git in workspace: %w", err))
+		if err := e.run("Initialize workspace repository", com, false); err != nil {
+			return fmt.Errorf("failed to init git in workspace: %w", err)
 		}
 
 		fmt.Println("Git initialized in workspace!")
@@ -563,37 +768,51 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 	worktreeAddCom.Dir = gitopsWorkspace
 
 	fmt.Println("Setting up GitOps worktree...")
-	if err := runCommandVerbose(worktreeAddCom, o.verbose); err != nil {
-		panic(fmt.Errorf("Failed to create GitOps worktree: exit code %w.", err))
+	if err := e.run("Add GitOps worktree", worktreeAddCom, false); err != nil {
+		return fmt.Errorf("failed to create GitOps worktree: %w", err)
 	}
+	j.Record("add GitOps worktree "+gitopsWorktree, func() error {
+		worktreeRemoveCom := exec.Command("git", "worktree", "remove", "--force", gitopsWorktree)
+		worktreeRemoveCom.Dir = gitopsWorkspace
+		return runCommandVerbose(worktreeRemoveCom, o.verbose)
+	})
 
 	// Add repo as safe directory
 	safeDirCom := exec.Command("git", "config", "--global", "--add", "safe.directory", gitopsWorktree)
-	if err := runCommandVerbose(safeDirCom, o.verbose); err != nil {
-		panic(fmt.Errorf("Failed to add safe directory: %w", err))
+	if err := e.run("Add GitOps worktree as git safe.directory", safeDirCom, false); err != nil {
+		return fmt.Errorf("failed to add safe directory: %w", err)
 	}
+	j.Record("add safe.directory "+gitopsWorktree, func() error {
+		unsetCom := exec.Command("git", "config", "--global", "--unset-all", "safe.directory", "^"+regexp.QuoteMeta(gitopsWorktree)+"$")
+		return runCommandVerbose(unsetCom, o.verbose)
+	})
 
 	if o.remoteRepo != "" {
 		// Create empty commit
 		emptyCommitCom := exec.Command("git", "commit", "--allow-empty", "-m", "Initial commit")
 		emptyCommitCom.Dir = gitopsWorktree
-		if err := runCommandVerbose(emptyCommitCom, o.verbose); err != nil {
-			panic(fmt.Errorf("Failed to create empty commit: %w", err))
+		if err := e.run("Create initial commit", emptyCommitCom, false); err != nil {
+			return fmt.Errorf("failed to create empty commit: %w", err)
 		}
 
 		// Push to remote
 		setUpstreamCom := exec.Command("git", "push", "-u", "origin", workspaceName)
 		setUpstreamCom.Dir = gitopsWorktree
-		if err := runCommandVerbose(setUpstreamCom, o.verbose); err != nil {
-			panic(fmt.Errorf("Failed to set upstream: %w", err))
+		if err := e.run("Push GitOps branch to remote", setUpstreamCom, false); err != nil {
+			return fmt.Errorf("failed to set upstream: %w", err)
 		}
+		j.Record("push branch "+workspaceName+" to remote", func() error {
+			deleteBranchCom := exec.Command("git", "push", "origin", "--delete", workspaceName)
+			deleteBranchCom.Dir = gitopsWorkspace
+			return runCommandVerbose(deleteBranchCom, o.verbose)
+		})
 	}
 
 	fmt.Println("GitOps worktree set up successfully!")
 
 	// Create secrets directory
 	secretsDir := gitopsConfig + "/secrets"
-	if err := os.MkdirAll(secretsDir, 0700); err != nil {
+	if err := e.mkdirAll("Create secrets directory", secretsDir, 0700); err != nil {
 		return fmt.Errorf("failed to create secrets directory: %w", err)
 	}
 
@@ -602,21 +821,28 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 	if !o.noIde {
 		// Create codeserver config directory
 		codeserverConfigDir := gitopsConfig + "/codeserver-config"
-		if err := os.MkdirAll(codeserverConfigDir, 0700); err != nil {
+		if err := e.mkdirAll("Create code-server config directory", codeserverConfigDir, 0700); err != nil {
 			return fmt.Errorf("failed to create codeserver config directory: %w", err)
 		}
+		editorConfig, err := codeserver.SetPassword(nil, o.editorPassword)
+		if err != nil {
+			return err
+		}
+		if err := e.writeFile("Write code-server config", filepath.Join(codeserverConfigDir, codeserver.ConfigFile), editorConfig, 0600); err != nil {
+			return fmt.Errorf("failed to write code-server config: %w", err)
+		}
 
 		if hostOsTmp == "linux" {
 			chownCom := exec.Command("sudo", "chown", "-R", "1000:1000", secretsDir)
-			if err := runCommandVerbose(chownCom, o.verbose); err != nil {
+			if err := e.run("Hand secrets directory over to the editor user", chownCom, false); err != nil {
 				return fmt.Errorf("failed to change ownership of secrets folder: %w", err)
 			}
 			chownCom = exec.Command("sudo", "chown", "-R", "1000:1000", codeserverConfigDir)
-			if err := runCommandVerbose(chownCom, o.verbose); err != nil {
+			if err := e.run("Hand code-server config directory over to the editor user", chownCom, false); err != nil {
 				return fmt.Errorf("failed to change ownership of codeserver config folder: %w", err)
 			}
 			chownCom = exec.Command("sudo", "chown", "-R", "1000:1000", gitopsWorkspace)
-			if err := runCommandVerbose(chownCom, o.verbose); err != nil {
+			if err := e.run("Hand workspace repository over to the editor user", chownCom, false); err != nil {
 				return fmt.Errorf("failed to change ownership of workspace folder: %w", err)
 			}
 		}
@@ -624,54 +850,73 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 
 	// Set hosts to /etc/hosts file
 	if o.setHosts {
-		err := setHosts(workspaceName, o)
+		err := setHosts(e, workspaceName, o)
 		if err != nil {
 			fmt.Printf("\033[33m%s\033[0m\n", err)
 		}
 	}
 
-	gitopsImage := o.gitopsImage
-	if gitopsImage == "" {
-		gitopsLatestVersion, err := dockerhub.GetLatestDockerHubVersion("https://hub.docker.com/v2/repositories/bitswan/gitops/tags/")
-		if err != nil {
-			panic(fmt.Errorf("Failed to get latest BitSwan GitOps version: %w", err))
-		}
-		gitopsImage = "bitswan/gitops:" + gitopsLatestVersion
+	gitopsImage, bitswanEditorImage, err := resolveImages(o.channel, o.gitopsImage, o.editorImage)
+	if err != nil {
+		return err
 	}
-
-	bitswanEditorImage := o.editorImage
-	if bitswanEditorImage == "" {
-		bitswanEditorLatestVersion, err := dockerhub.GetLatestDockerHubVersion("https://hub.docker.com/v2/repositories/bitswan/bitswan-editor/tags/")
-		if err != nil {
-			panic(fmt.Errorf("Failed to get latest BitSwan Editor version: %w", err))
-		}
-		bitswanEditorImage = "bitswan/bitswan-editor:" + bitswanEditorLatestVersion
+	e.plan.SetImage("gitops", gitopsImage)
+	if !o.noIde {
+		e.plan.SetImage("editor", bitswanEditorImage)
 	}
 
 	fmt.Println("Setting up GitOps deployment...")
 	gitopsDeployment := gitopsConfig + "/deployment"
-	if err := os.MkdirAll(gitopsDeployment, 0755); err != nil {
-		return fmt.Errorf("Failed to create deployment directory: %w", err)
+	if err := e.mkdirAll("Create deployment directory", gitopsDeployment, 0755); err != nil {
+		return fmt.Errorf("failed to create deployment directory: %w", err)
 	}
 
 	if inputCertsDir != "" {
-		if err := caddyapi.InstallTLSCerts(workspaceName, o.domain); err != nil {
-			return fmt.Errorf("Failed to install caddy certs %w", err)
+		tlsRequests, err := caddyapi.TLSCertsRequests(workspaceName, o.domain)
+		if err != nil {
+			return err
+		}
+		// Record the step before running it, the certificates may be installed even when the policy fails
+		j.Record("install TLS certificates in Caddy", func() error {
+			return withGlobalLock(func() error {
+				if err := caddyapi.UnregisterCaddyService("tlspolicy", workspaceName); err != nil {
+					return err
+				}
+				return caddyapi.UnregisterCaddyService("tlscerts", workspaceName)
+			})
+		})
+		if err := e.caddy("Install TLS certificates and policy", tlsRequests...); err != nil {
+			return fmt.Errorf("failed to install caddy certs: %w", err)
 		}
 	}
 
 	// Register GitOps service
-	if err := caddyapi.RegisterServiceWithCaddy("gitops", workspaceName, o.domain, fmt.Sprintf("%s-gitops:8079", workspaceName)); err != nil {
-		return fmt.Errorf("failed to register GitOps service: %w", err)
-	}
-
+	gitopsRoute, err := caddyapi.ServiceRouteRequest("gitops", workspaceName, o.domain, fmt.Sprintf("%s-gitops:8079", workspaceName))
 	if err != nil {
-		panic(fmt.Errorf("Failed to add Caddy records: %w", err))
+		return err
 	}
-
-	err = EnsureExamples(bitswanConfig, o.verbose)
-	if err != nil {
-		panic(fmt.Errorf("Failed to download examples: %w", err))
+	if err := e.caddy("Register GitOps route", gitopsRoute); err != nil {
+		return fmt.Errorf("failed to register GitOps service: %w", err)
+	}
+	j.Record("register GitOps route in Caddy", func() error {
+		return withGlobalLock(func() error {
+			return caddyapi.UnregisterCaddyService("gitops", workspaceName)
+		})
+	})
+
+	if o.bundle != "" {
+		fmt.Println("Using examples from the bundle")
+	} else if e.dryRun {
+		e.plan.Add(plan.Action{
+			Kind:        plan.Exec,
+			Description: "Clone or update BitSwan examples",
+			Command:     []string{"git", "clone", "https://github.com/bitswan-space/BitSwan.git", filepath.Join(bitswanConfig, "bitswan-src")},
+		})
+	} else {
+		err = EnsureExamples(bitswanConfig, o.verbose)
+		if err != nil {
+			return fmt.Errorf("failed to download examples: %w", err)
+		}
 	}
 
 	var aocEnvVars []string
@@ -679,124 +924,11 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 	workspaceId := ""
 	fmt.Println("Registering workspace...")
 	// Check if automation_server.yaml exists
-	automationServerConfig := filepath.Join(bitswanConfig, "aoc", "automation_server.yaml")
-	if _, err := os.Stat(automationServerConfig); !os.IsNotExist(err) {
-		// Read automation_server.yaml
-		yamlFile, err := os.ReadFile(automationServerConfig)
-		if err != nil {
-			return fmt.Errorf("failed to read automation_server.yaml: %w", err)
-		}
-
-		var automationConfig AutomationServerYaml
-		if err := yaml.Unmarshal(yamlFile, &automationConfig); err != nil {
-			return fmt.Errorf("failed to unmarshal automation_server.yaml: %w", err)
-		}
-
-		fmt.Println("Getting automation server token...")
-
-		resp, err := sendRequest("GET", fmt.Sprintf("%s/api/automation-servers/token", automationConfig.AOCUrl), nil, automationConfig.AccessToken)
-		if err != nil {
-			return fmt.Errorf("error sending request: %w", err)
-		}
-
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("failed to get automation server token: %s", resp.Status)
-		}
-
-		type AutomationServerTokenResponse struct {
-			Token string `json:"token"`
-		}
-
-		var automationServerTokenResponse AutomationServerTokenResponse
-		body, _ := ioutil.ReadAll(resp.Body)
-		err = json.Unmarshal([]byte(body), &automationServerTokenResponse)
-		if err != nil {
-			return fmt.Errorf("error decoding JSON: %w", err)
-		}
-		fmt.Println("Automation server token received successfully!")
-
-		payload := map[string]interface{}{
-			"name":                 workspaceName,
-			"automation_server_id": automationConfig.AutomationServerId,
-			"keycloak_org_id":      "00000000-0000-0000-0000-000000000000",
-		}
-
-		if !o.noIde {
-			payload["editor_url"] = fmt.Sprintf("https://%s-editor.%s", workspaceName, o.domain)
-		}
-
-		jsonBytes, err := json.Marshal(payload)
-		if err != nil {
-			return fmt.Errorf("failed to marshal JSON: %w", err)
-		}
-
-		resp, err = sendRequest("POST", fmt.Sprintf("%s/api/workspaces/", automationConfig.AOCUrl), jsonBytes, automationConfig.AccessToken)
-		if err != nil {
-			return fmt.Errorf("error sending request: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusCreated {
-			return fmt.Errorf("failed to register workspace: %s", resp.Status)
-		}
-
-		type WorkspacePostResponse struct {
-			Id                 string `json:"id"`
-			Name               string `json:"name"`
-			KeycloakOrgId      string `json:"keycloak_org_id"`
-			AutomationServerId string `json:"automation_server_id"`
-			CreatedAt          string `json:"created_at"`
-			UpdatedAt          string `json:"updated_at"`
-		}
-
-		var workspacePostResponse WorkspacePostResponse
-		body, _ = ioutil.ReadAll(resp.Body)
-		err = json.Unmarshal([]byte(body), &workspacePostResponse)
-		if err != nil {
-			return fmt.Errorf("error decoding JSON: %w", err)
-		}
-
-		fmt.Println("Workspace registered successfully!")
-
-		workspaceId = workspacePostResponse.Id
-
-		aocEnvVars = append(aocEnvVars, "BITSWAN_WORKSPACE_ID="+fmt.Sprint(workspacePostResponse.Id))
-		aocEnvVars = append(aocEnvVars, "BITSWAN_AOC_URL="+automationConfig.AOCUrl)
-		aocEnvVars = append(aocEnvVars, "BITSWAN_AOC_TOKEN="+automationServerTokenResponse.Token)
-
-		fmt.Println("Getting EMQX JWT for workspace...")
-		resp, err = sendRequest("GET", fmt.Sprintf("%s/api/workspaces/%s/emqx/jwt", automationConfig.AOCUrl, workspacePostResponse.Id), nil, automationConfig.AccessToken)
+	if _, err := os.Stat(automationServerYamlPath()); !os.IsNotExist(err) {
+		workspaceId, aocEnvVars, mqttEnvVars, err = o.registerWithAOC(e, j, workspaceName)
 		if err != nil {
-			return fmt.Errorf("error sending request: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("failed to get EMQX JWT: %s", resp.Status)
-		}
-
-		type EmqxGetResponse struct {
-			Url   string `json:"url"`
-			Token string `json:"token"`
-		}
-
-		var emqxGetResponse EmqxGetResponse
-		body, _ = ioutil.ReadAll(resp.Body)
-		err = json.Unmarshal([]byte(body), &emqxGetResponse)
-		if err != nil {
-			return fmt.Errorf("error decoding JSON: %w", err)
+			return err
 		}
-
-		fmt.Println("EMQX JWT received successfully!")
-
-		urlParts := strings.Split(emqxGetResponse.Url, ":")
-		emqxUrl, emqxPort := urlParts[0], urlParts[1]
-		mqttEnvVars = append(mqttEnvVars, "MQTT_USERNAME="+fmt.Sprint(workspacePostResponse.Id))
-		mqttEnvVars = append(mqttEnvVars, "MQTT_PASSWORD="+emqxGetResponse.Token)
-		mqttEnvVars = append(mqttEnvVars, "MQTT_BROKER="+emqxUrl)
-		mqttEnvVars = append(mqttEnvVars, "MQTT_PORT="+emqxPort)
-		mqttEnvVars = append(mqttEnvVars, "MQTT_TOPIC=/topology")
 	} else {
 		fmt.Println("Automation server config not found, skipping workspace registration.")
 	}
@@ -807,38 +939,83 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 		gitopsImage,
 		bitswanEditorImage,
 		o.domain,
+		"",
 		o.noIde,
 		mqttEnvVars,
 		aocEnvVars,
+		workspaceLabels,
+		o.limits,
+		nil,
 	)
-
 	if err != nil {
-		panic(fmt.Errorf("Failed to create docker-compose file: %w", err))
+		return fmt.Errorf("failed to create docker-compose file: %w", err)
+	}
+	// The plan is printed and may be shared, keep the secrets out of it
+	e.plan.Redact(token, o.editorPassword)
+	for _, envVar := range append(aocEnvVars, mqttEnvVars...) {
+		if key, value, _ := strings.Cut(envVar, "="); dockercompose.SecretVariables[key] {
+			e.plan.Redact(value)
+		}
 	}
 
-	dockerComposePath := gitopsDeployment + "/docker-compose.yml"
-	if err := os.WriteFile(dockerComposePath, []byte(compose), 0755); err != nil {
-		panic(fmt.Errorf("Failed to write docker-compose file: %w", err))
+	if !e.dryRun {
+		if err := dockercompose.RewriteWorktreeGitdir(gitopsConfig); err != nil {
+			return err
+		}
 	}
 
-	err = os.Chdir(gitopsDeployment)
+	if o.override != "" {
+		override, err := os.ReadFile(o.override)
+		if err != nil {
+			return fmt.Errorf("failed to read compose override: %w", err)
+		}
+		// A dry run creates no deployment directory for docker compose to check the overlay in
+		if e.dryRun {
+			err = dockercompose.CheckOverride([]byte(compose), override)
+		} else {
+			_, err = dockercompose.MergeOverride(gitopsDeployment, []byte(compose), override)
+		}
+		if err != nil {
+			return err
+		}
+		if err := e.writeFile("Write docker-compose override file", filepath.Join(gitopsDeployment, dockercompose.OverrideFile), override, 0644); err != nil {
+			return fmt.Errorf("failed to write docker-compose override file: %w", err)
+		}
+	}
+
+	written, err := writeComposeFiles(gitopsDeployment, []byte(compose), func(path string, data []byte, perm os.FileMode) error {
+		return e.writeFile("Write "+filepath.Base(path), path, data, perm)
+	})
 	if err != nil {
-		panic(fmt.Errorf("Failed to change directory to GitOps deployment: %w", err))
+		return err
+	}
+	if !e.dryRun {
+		if err := recordRevision(gitopsConfig, written, "init"); err != nil {
+			return err
+		}
 	}
 
 	fmt.Println("GitOps deployment set up successfully!")
 
 	// Save metadata to file
-	if err := saveMetadata(gitopsConfig, workspaceName, token, o.domain, o.noIde, &workspaceId, mqttEnvVars); err != nil {
+	if err := saveMetadata(e, gitopsConfig, workspaceName, token, o.domain, o.channel, workspaceLabels, o.limits, o.noIde, o.editorPassword, &workspaceId, mqttEnvVars); err != nil {
 		fmt.Printf("Warning: Failed to save metadata: %v\n", err)
 	}
 
 	projectName := workspaceName + "-site"
 	dockerComposeCom := exec.Command("docker", "compose", "-p", projectName, "up", "-d")
+	dockerComposeCom.Dir = gitopsDeployment
+
+	// Record the step before running it, compose may have started some containers even when it fails
+	j.Record("start docker compose project "+projectName, func() error {
+		downCom := exec.Command("docker", "compose", "-p", projectName, "down", "--volumes")
+		downCom.Dir = gitopsDeployment
+		return runCommandVerbose(downCom, o.verbose)
+	})
 
 	fmt.Println("Launching BitSwan Workspace services...")
-	if err := runCommandVerbose(dockerComposeCom, true); err != nil {
-		panic(fmt.Errorf("failed to start docker-compose: %w", err))
+	if err := e.run("Launch BitSwan Workspace services", dockerComposeCom, true); err != nil {
+		return fmt.Errorf("failed to start docker-compose: %w", err)
 	}
 
 	fmt.Println("BitSwan GitOps initialized successfully!")
@@ -847,20 +1024,34 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 	if !o.noIde {
 		fmt.Println("Downloading and installing editor...")
 		// Register GitOps service
-		if err := caddyapi.RegisterServiceWithCaddy("editor", workspaceName, o.domain, fmt.Sprintf("%s-editor:9999", workspaceName)); err != nil {
+		editorRoute, err := caddyapi.ServiceRouteRequest("editor", workspaceName, o.domain, fmt.Sprintf("%s-editor:9999", workspaceName))
+		if err != nil {
+			return err
+		}
+		if err := e.caddy("Register Editor route", editorRoute); err != nil {
 			return fmt.Errorf("failed to register Editor service with caddy: %w", err)
 		}
+		j.Record("register Editor route in Caddy", func() error {
+			return withGlobalLock(func() error {
+				return caddyapi.UnregisterCaddyService("editor", workspaceName)
+			})
+		})
+
+		if e.dryRun {
+			return nil
+		}
+
 		// First, wait for the editor service to be ready by streaming logs
 		if err := dockercompose.WaitForEditorReady(workspaceName); err != nil {
-			panic(fmt.Errorf("failed to wait for editor to be ready: %w", err))
-		}
-		editorPassword, err := dockercompose.GetEditorPassword(workspaceName)
-		if err != nil {
-			panic(fmt.Errorf("Failed to get Bitswan Editor password: %w", err))
+			return fmt.Errorf("failed to wait for editor to be ready: %w", err)
 		}
 		fmt.Println("------------BITSWAN EDITOR INFO------------")
 		fmt.Printf("Bitswan Editor URL: https://%s-editor.%s\n", workspaceName, o.domain)
-		fmt.Printf("Bitswan Editor Password: %s\n", editorPassword)
+		fmt.Printf("Bitswan Editor Password: %s\n", o.editorPassword)
+	}
+
+	if e.dryRun {
+		return nil
 	}
 
 	fmt.Println("------------GITOPS INFO------------")
@@ -870,3 +1061,165 @@ func (o *initOptions) run(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// registerWithAOC registers the workspace with the automation operation center and
+// returns the workspace ID together with the AOC and MQTT environment variables
+func (o *initOptions) registerWithAOC(e *executor, j *journal.Journal, workspaceName string) (string, []string, []string, error) {
+	automationConfig, err := readAutomationServerYaml()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to read automation_server.yaml: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"name":                 workspaceName,
+		"automation_server_id": automationConfig.AutomationServerId,
+		"keycloak_org_id":      "00000000-0000-0000-0000-000000000000",
+	}
+
+	if !o.noIde {
+		payload["editor_url"] = fmt.Sprintf("https://%s-editor.%s", workspaceName, o.domain)
+	}
+
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if e.dryRun {
+		// Responses are not available in dry-run, show placeholders in their place
+		workspaceId := "<workspace-id>"
+		e.request("Get automation server token", "GET", fmt.Sprintf("%s/api/automation-servers/token", automationConfig.AOCUrl), nil)
+		e.request("Register workspace in AOC", "POST", fmt.Sprintf("%s/api/workspaces/", automationConfig.AOCUrl), jsonBytes)
+		e.request("Get EMQX JWT for workspace", "GET", fmt.Sprintf("%s/api/workspaces/%s/emqx/jwt", automationConfig.AOCUrl, workspaceId), nil)
+
+		aocEnvVars := []string{
+			"BITSWAN_WORKSPACE_ID=" + workspaceId,
+			"BITSWAN_AOC_URL=" + automationConfig.AOCUrl,
+			"BITSWAN_AOC_TOKEN=<automation-server-token>",
+		}
+		mqttEnvVars := []string{
+			"MQTT_USERNAME=" + workspaceId,
+			"MQTT_PASSWORD=<emqx-jwt>",
+			"MQTT_BROKER=<emqx-host>",
+			"MQTT_PORT=<emqx-port>",
+			"MQTT_TOPIC=/topology",
+		}
+		return workspaceId, aocEnvVars, mqttEnvVars, nil
+	}
+
+	fmt.Println("Getting automation server token...")
+
+	resp, err := sendRequest("GET", fmt.Sprintf("%s/api/automation-servers/token", automationConfig.AOCUrl), nil, automationConfig.AccessToken)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, nil, fmt.Errorf("failed to get automation server token: %s", resp.Status)
+	}
+
+	type AutomationServerTokenResponse struct {
+		Token string `json:"token"`
+	}
+
+	var automationServerTokenResponse AutomationServerTokenResponse
+	body, _ := ioutil.ReadAll(resp.Body)
+	err = json.Unmarshal([]byte(body), &automationServerTokenResponse)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+	fmt.Println("Automation server token received successfully!")
+
+	resp, err = sendRequest("POST", fmt.Sprintf("%s/api/workspaces/", automationConfig.AOCUrl), jsonBytes, automationConfig.AccessToken)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", nil, nil, fmt.Errorf("failed to register workspace: %s", resp.Status)
+	}
+
+	type WorkspacePostResponse struct {
+		Id                 string `json:"id"`
+		Name               string `json:"name"`
+		KeycloakOrgId      string `json:"keycloak_org_id"`
+		AutomationServerId string `json:"automation_server_id"`
+		CreatedAt          string `json:"created_at"`
+		UpdatedAt          string `json:"updated_at"`
+	}
+
+	var workspacePostResponse WorkspacePostResponse
+	body, _ = ioutil.ReadAll(resp.Body)
+	err = json.Unmarshal([]byte(body), &workspacePostResponse)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+
+	fmt.Println("Workspace registered successfully!")
+
+	j.Record("register workspace in AOC", func() error {
+		return deleteAOCWorkspace(*automationConfig, workspacePostResponse.Id)
+	})
+
+	var aocEnvVars []string
+	aocEnvVars = append(aocEnvVars, "BITSWAN_WORKSPACE_ID="+fmt.Sprint(workspacePostResponse.Id))
+	aocEnvVars = append(aocEnvVars, "BITSWAN_AOC_URL="+automationConfig.AOCUrl)
+	aocEnvVars = append(aocEnvVars, "BITSWAN_AOC_TOKEN="+automationServerTokenResponse.Token)
+
+	fmt.Println("Getting EMQX JWT for workspace...")
+	resp, err = sendRequest("GET", fmt.Sprintf("%s/api/workspaces/%s/emqx/jwt", automationConfig.AOCUrl, workspacePostResponse.Id), nil, automationConfig.AccessToken)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, nil, fmt.Errorf("failed to get EMQX JWT: %s", resp.Status)
+	}
+
+	type EmqxGetResponse struct {
+		Url   string `json:"url"`
+		Token string `json:"token"`
+	}
+
+	var emqxGetResponse EmqxGetResponse
+	body, _ = ioutil.ReadAll(resp.Body)
+	err = json.Unmarshal([]byte(body), &emqxGetResponse)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+
+	fmt.Println("EMQX JWT received successfully!")
+
+	urlParts := strings.Split(emqxGetResponse.Url, ":")
+	if len(urlParts) != 2 {
+		return "", nil, nil, fmt.Errorf("unexpected EMQX URL format: %s", emqxGetResponse.Url)
+	}
+	emqxUrl, emqxPort := urlParts[0], urlParts[1]
+
+	var mqttEnvVars []string
+	mqttEnvVars = append(mqttEnvVars, "MQTT_USERNAME="+fmt.Sprint(workspacePostResponse.Id))
+	mqttEnvVars = append(mqttEnvVars, "MQTT_PASSWORD="+emqxGetResponse.Token)
+	mqttEnvVars = append(mqttEnvVars, "MQTT_BROKER="+emqxUrl)
+	mqttEnvVars = append(mqttEnvVars, "MQTT_PORT="+emqxPort)
+	mqttEnvVars = append(mqttEnvVars, "MQTT_TOPIC=/topology")
+
+	return workspacePostResponse.Id, aocEnvVars, mqttEnvVars, nil
+}
+
+// deleteAOCWorkspace removes a workspace record registered during init
+func deleteAOCWorkspace(automationConfig AutomationServerYaml, workspaceId string) error {
+	resp, err := sendRequest("DELETE", fmt.Sprintf("%s/api/workspaces/%s/", automationConfig.AOCUrl, workspaceId), nil, automationConfig.AccessToken)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete workspace from AOC: %s", resp.Status)
+	}
+
+	return nil
+}
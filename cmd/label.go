@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/labels"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// nameLabel is the pseudo label selectors use to match workspace names, e.g. name=team-*
+const nameLabel = "name"
+
+func newLabelCmd() *cobra.Command {
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "label <workspace-name> [key=value | key-]...",
+		Short:        "Show, set or remove the labels of a workspace",
+		Long:         "Show the labels of a workspace, or set labels with key=value and remove them with key-. The labels are also put on the docker services of the workspace, which are recreated when the workspace is running.",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workspaceName := args[0]
+			if len(args) == 1 {
+				workspaceLabels, err := getWorkspaceLabels(workspaceName)
+				if err != nil {
+					return err
+				}
+				writeLabelsTable(cmd.OutOrStdout(), workspaceLabels)
+				return nil
+			}
+
+			set, removed, err := labels.ParseChanges(args[1:])
+			if err != nil {
+				return err
+			}
+			if err := labelWorkspace(workspaceName, set, removed, verbose); err != nil {
+				return fmt.Errorf("error labelling workspace: %w", err)
+			}
+			fmt.Printf("Workspace %s labelled.\n", workspaceName)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func labelWorkspace(workspaceName string, set map[string]string, removed []string, verbose bool) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	if metadata.Labels == nil {
+		metadata.Labels = map[string]string{}
+	}
+	for key, value := range set {
+		metadata.Labels[key] = value
+	}
+	for _, key := range removed {
+		delete(metadata.Labels, key)
+	}
+
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return err
+	}
+
+	// Put the labels on the docker services, so that external tooling can find them
+	compose, err := ws.ReadCompose()
+	if err != nil {
+		return err
+	}
+	compose, err = dockercompose.SetLabels(compose, workspaceName, metadata.Labels)
+	if err != nil {
+		return err
+	}
+	if compose, err = writeComposeFiles(ws.DeploymentDir(), compose, workspace.WriteFile); err != nil {
+		return err
+	}
+	if err := recordRevision(ws.Dir, compose, "label"); err != nil {
+		return err
+	}
+
+	if workspaceState(workspaceName) != "running" {
+		return nil
+	}
+	fmt.Println("Recreating services with the new labels...")
+	return composeProject(workspaceName+"-site", ws.DeploymentDir(), verbose, "up", "-d")
+}
+
+// getWorkspaceLabels returns the labels of the workspace from its metadata
+func getWorkspaceLabels(workspaceName string) (map[string]string, error) {
+	metadata, err := workspace.New(workspaceName).ReadMetadataSealed()
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", workspaceName, err)
+	}
+	return metadata.Labels, nil
+}
+
+// selectWorkspaces returns the workspaces named in args, all workspaces with --all or
+// when only a selector is given, narrowed down by the label selector. The workspace
+// name can be matched with the name pseudo label, e.g. name=team-*
+func selectWorkspaces(args []string, all bool, selector string) ([]string, error) {
+	workspacesDir := home.WorkspacesDir()
+
+	names := args
+	if all || (len(args) == 0 && selector != "") {
+		var err error
+		if names, err = getWorkspaceNames(workspacesDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if selector == "" {
+		return names, nil
+	}
+
+	s, err := labels.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, name := range names {
+		workspaceLabels, err := getWorkspaceLabels(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		candidate := map[string]string{nameLabel: name}
+		for key, value := range workspaceLabels {
+			candidate[key] = value
+		}
+		if s.Matches(candidate) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, nil
+}
+
+// forEachWorkspace runs fn for every workspace, continuing after failures, and
+// returns an error naming the workspaces that failed
+func forEachWorkspace(workspaceNames []string, fn func(workspaceName string) error) error {
+	if len(workspaceNames) == 0 {
+		return fmt.Errorf("no workspaces selected")
+	}
+
+	var failed []string
+	for _, workspaceName := range workspaceNames {
+		if err := fn(workspaceName); err != nil {
+			fmt.Fprintf(os.Stderr, "\033[31m%s: %v\033[0m\n", workspaceName, err)
+			failed = append(failed, workspaceName)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// formatLabels renders labels as a sorted key=value list
+func formatLabels(workspaceLabels map[string]string) string {
+	pairs := make([]string, 0, len(workspaceLabels))
+	for key, value := range workspaceLabels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func writeLabelsTable(out io.Writer, workspaceLabels map[string]string) {
+	keys := make([]string, 0, len(workspaceLabels))
+	for key := range workspaceLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", key, workspaceLabels[key])
+	}
+	w.Flush()
+}
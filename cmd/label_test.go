@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectWorkspaces(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	metadata := map[string]string{
+		"team-a": "domain: a.localhost\nlabels:\n  env: prod\n  team: data\n",
+		"team-b": "domain: b.localhost\nlabels:\n  env: staging\n",
+		"other":  "domain: other.localhost\n",
+	}
+	for name, content := range metadata {
+		dir := filepath.Join(home, ".config", "bitswan", "workspaces", name)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte(content), 0644))
+	}
+
+	names, err := selectWorkspaces(nil, true, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"team-a", "team-b", "other"}, names)
+
+	names, err = selectWorkspaces(nil, false, "name=team-*")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"team-a", "team-b"}, names)
+
+	names, err = selectWorkspaces([]string{"other", "team-b"}, false, "name=team-*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-b"}, names)
+
+	names, err = selectWorkspaces(nil, false, "env=prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, names)
+
+	names, err = selectWorkspaces(nil, false, "env,env!=prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-b"}, names)
+
+	names, err = selectWorkspaces(nil, false, "!env")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, names)
+
+	_, err = selectWorkspaces(nil, true, "name=[")
+	assert.Error(t, err)
+}
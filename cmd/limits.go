@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+)
+
+type limitsFlag struct {
+	name  string
+	usage string
+	// field returns a pointer to the string or int field of the limits the flag sets
+	field func(l *dockercompose.Limits) interface{}
+}
+
+var limitsFlags = []limitsFlag{
+	{"gitops-cpus", "CPUs the gitops service may use, e.g. 1.5", func(l *dockercompose.Limits) interface{} { return &l.Gitops.CPUs }},
+	{"gitops-memory", "Memory limit of the gitops service, e.g. 1g", func(l *dockercompose.Limits) interface{} { return &l.Gitops.Memory }},
+	{"gitops-pids-limit", "Process limit of the gitops service", func(l *dockercompose.Limits) interface{} { return &l.Gitops.PidsLimit }},
+	{"gitops-restart", "Restart policy of the gitops service (default always)", func(l *dockercompose.Limits) interface{} { return &l.Gitops.Restart }},
+	{"editor-cpus", "CPUs the editor may use, e.g. 2", func(l *dockercompose.Limits) interface{} { return &l.Editor.CPUs }},
+	{"editor-memory", "Memory limit of the editor, e.g. 4g", func(l *dockercompose.Limits) interface{} { return &l.Editor.Memory }},
+	{"editor-pids-limit", "Process limit of the editor", func(l *dockercompose.Limits) interface{} { return &l.Editor.PidsLimit }},
+	{"editor-restart", "Restart policy of the editor (default always)", func(l *dockercompose.Limits) interface{} { return &l.Editor.Restart }},
+	{"automation-cpus", "Default CPUs of the automation containers started by gitops", func(l *dockercompose.Limits) interface{} { return &l.Automations.CPUs }},
+	{"automation-memory", "Default memory limit of the automation containers started by gitops", func(l *dockercompose.Limits) interface{} { return &l.Automations.Memory }},
+	{"automation-pids-limit", "Default process limit of the automation containers started by gitops", func(l *dockercompose.Limits) interface{} { return &l.Automations.PidsLimit }},
+}
+
+// addLimitsFlags adds the resource limit flags of init and update, bound to l
+func addLimitsFlags(cmd *cobra.Command, l *dockercompose.Limits) {
+	for _, f := range limitsFlags {
+		switch field := f.field(l).(type) {
+		case *string:
+			cmd.Flags().StringVar(field, f.name, "", f.usage)
+		case *int:
+			cmd.Flags().IntVar(field, f.name, 0, f.usage)
+		}
+	}
+}
+
+// changedLimits returns a function that applies the limit flags given on the command
+// line to the limits of a workspace, or nil when no limit flag was given
+func changedLimits(cmd *cobra.Command, flagLimits *dockercompose.Limits) func(l *dockercompose.Limits) {
+	var changed []limitsFlag
+	for _, f := range limitsFlags {
+		if cmd.Flags().Changed(f.name) {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return func(l *dockercompose.Limits) {
+		for _, f := range changed {
+			switch field := f.field(l).(type) {
+			case *string:
+				*field = *f.field(flagLimits).(*string)
+			case *int:
+				*field = *f.field(flagLimits).(*int)
+			}
+		}
+	}
+}
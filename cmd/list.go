@@ -1,20 +1,53 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
 
+// workspaceInfo is what list reports about a workspace
+type workspaceInfo struct {
+	Name           string            `json:"name" yaml:"name"`
+	State          string            `json:"state" yaml:"state"`
+	Domain         string            `json:"domain,omitempty" yaml:"domain,omitempty"`
+	EditorURL      string            `json:"editor_url,omitempty" yaml:"editor_url,omitempty"`
+	GitopsURL      string            `json:"gitops_url,omitempty" yaml:"gitops_url,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	EditorPassword string            `json:"editor_password,omitempty" yaml:"editor_password,omitempty"`
+	GitopsSecret   string            `json:"gitops_secret,omitempty" yaml:"gitops_secret,omitempty"`
+}
+
+var workspaceColumns = []output.Column[workspaceInfo]{
+	{Header: "NAME", Value: func(w workspaceInfo) string { return w.Name }},
+	{Header: "STATE", Value: func(w workspaceInfo) string { return w.State }},
+	{Header: "DOMAIN", Wide: true, Value: func(w workspaceInfo) string { return w.Domain }},
+	{Header: "GITOPS URL", Wide: true, Value: func(w workspaceInfo) string { return w.GitopsURL }},
+	{Header: "EDITOR URL", Wide: true, Value: func(w workspaceInfo) string { return w.EditorURL }},
+	{Header: "LABELS", Wide: true, Value: func(w workspaceInfo) string { return formatLabels(w.Labels) }},
+}
+
+var secretColumns = []output.Column[workspaceInfo]{
+	{Header: "EDITOR PASSWORD", Value: func(w workspaceInfo) string { return w.EditorPassword }},
+	{Header: "GITOPS SECRET", Value: func(w workspaceInfo) string { return w.GitopsSecret }},
+}
+
 func newListCmd() *cobra.Command {
 	var showPasswords bool
 	var long bool
+	var selector string
+	var format string
 
 	cmd := &cobra.Command{
 		Use:          "list",
@@ -22,97 +55,89 @@ func newListCmd() *cobra.Command {
 		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			workspacesDir := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "workspaces")
-
-			// Check if directory exists
-			if _, err := os.Stat(workspacesDir); os.IsNotExist(err) {
-				return fmt.Errorf("workspaces directory not found: %s", workspacesDir)
+			if long && format == output.Table {
+				format = output.Wide
 			}
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
+			workspacesDir := home.WorkspacesDir()
 
-			// Read directory entries
-			entries, err := os.ReadDir(workspacesDir)
+			workspaceNames, err := selectWorkspaces(nil, true, selector)
 			if err != nil {
-				return fmt.Errorf("failed to read workspaces directory: %w", err)
+				return err
 			}
 
-			// Print each subdirectory
-			for _, entry := range entries {
-				if entry.IsDir() {
-					workspaceName := entry.Name()
-					fmt.Fprintln(cmd.OutOrStdout(), workspaceName)
-					if long {
-						domain, editorURL, gitopsURL := getMetaData(workspaceName, workspacesDir)
-						if domain != "" {
-							fmt.Fprintf(cmd.OutOrStdout(), "  Workspace Domain: %s\n", domain)
-						}
-						if editorURL != "" {
-							fmt.Fprintf(cmd.OutOrStdout(), "  Editor URL: %s\n", editorURL)
-						}
-						if gitopsURL != "" {
-							fmt.Fprintf(cmd.OutOrStdout(), "  Gitops URL: %s\n", gitopsURL)
-						}
-					}
-
-					if showPasswords {
-						// Get VSCode server password
-						vscodePassword, _ := dockercompose.GetEditorPassword(workspaceName)
-						if vscodePassword != "" {
-							fmt.Fprintf(cmd.OutOrStdout(), "  VSCode Password: %s\n", vscodePassword)
-						}
-
-						// Get GitOps secret
-						gitopsSecret, _ := getGitOpsSecret(workspaceName, workspacesDir)
-						if gitopsSecret != "" {
-							fmt.Fprintf(cmd.OutOrStdout(), "  GitOps Secret: %s\n", gitopsSecret)
-						}
-					}
-				}
+			workspaces := make([]workspaceInfo, 0, len(workspaceNames))
+			for _, workspaceName := range workspaceNames {
+				workspaces = append(workspaces, listWorkspace(workspaceName, workspacesDir, showPasswords))
 			}
 
-			return nil
+			columns := workspaceColumns
+			if showPasswords {
+				columns = append(columns[:len(columns):len(columns)], secretColumns...)
+			}
+			return output.Write(cmd.OutOrStdout(), format, workspaces, columns)
 		},
 	}
 
 	cmd.Flags().BoolVar(&showPasswords, "passwords", false, "Show VSCode server passwords and GitOps secrets")
-	cmd.Flags().BoolVarP(&long, "long", "l", false, "Show verbose output")
+	cmd.Flags().BoolVar(&long, "long", false, "Show domains, URLs and labels, same as --output wide")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Only list workspaces matching the label selector, e.g. env=prod")
+	output.AddFlag(cmd, &format)
 
 	return cmd
 }
 
-func getMetaData(workspaceName string, workspacesDir string) (string, string, string) {
-	// Path to metadata.yaml file
-	metadataPath := filepath.Join(workspacesDir, workspaceName, "metadata.yaml")
+func listWorkspace(workspaceName, workspacesDir string, showPasswords bool) workspaceInfo {
+	info := workspaceInfo{Name: workspaceName, State: workspaceState(workspaceName)}
+	info.Domain, info.EditorURL, info.GitopsURL = getMetaData(workspaceName, workspacesDir)
+	info.Labels, _ = getWorkspaceLabels(workspaceName)
 
-	// Check if metadata file exists
-	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
-		return "", "", ""
+	if showPasswords {
+		// Missing secrets are left empty, e.g. the editor password of a workspace without editor
+		info.EditorPassword, _ = editorPassword(workspaceName)
+		info.GitopsSecret, _ = getGitOpsSecret(workspaceName, workspacesDir)
 	}
+	return info
+}
 
-	// Read metadata file
-	data, err := os.ReadFile(metadataPath)
+func getMetaData(workspaceName string, workspacesDir string) (string, string, string) {
+	metadata, err := config.ReadMetadataSealed(filepath.Join(workspacesDir, workspaceName))
 	if err != nil {
 		return "", "", ""
 	}
 
-	// Parse YAML
-	var metadata struct {
-		Domain    string `yaml:"domain"`
-		EditorURL string `yaml:"editor-url"`
-		GitopsURL string `yaml:"gitops-url"`
-	}
-
-	if err := yaml.Unmarshal(data, &metadata); err != nil {
-		return "", "", ""
+	editorURL := ""
+	if metadata.EditorURL != nil {
+		editorURL = *metadata.EditorURL
 	}
-
-	return metadata.Domain, metadata.EditorURL, metadata.GitopsURL
+	return metadata.Domain, editorURL, metadata.GitopsURL
 }
 
+// errGitopsSecretNotFound is returned by getGitOpsSecret when the workspace has no gitops secret
+var errGitopsSecretNotFound = errors.New("GitOps secret not found")
+
 func getGitOpsSecret(workspace string, workspacesDir string) (string, error) {
+	// Migrated workspaces keep the secret in an env file next to the docker-compose file
+	secretsFilePath := filepath.Join(workspacesDir, workspace, "deployment", dockercompose.GitopsSecretsFile)
+	data, err := host.ReadFile(secretsFilePath)
+	if err == nil {
+		if secret, ok := dockercompose.ParseEnvFile(data)["BITSWAN_GITOPS_SECRET"]; ok && secret != "" {
+			return secret, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
 	// Read docker-compose.yml file
 	composeFilePath := filepath.Join(workspacesDir, workspace, "deployment", "docker-compose.yml")
 
-	data, err := os.ReadFile(composeFilePath)
+	data, err = host.ReadFile(composeFilePath)
+	if os.IsNotExist(err) {
+		return "", errGitopsSecretNotFound
+	}
 	if err != nil {
 		return "", err
 	}
@@ -136,7 +161,7 @@ func getGitOpsSecret(workspace string, workspacesDir string) (string, error) {
 
 	env, ok := editorService["environment"].([]interface{})
 	if !ok {
-		return "", fmt.Errorf("environment section not found")
+		return "", errGitopsSecretNotFound
 	}
 
 	// Look for the BITSWAN_GITOPS_SECRET in the environment variables
@@ -148,11 +173,34 @@ func getGitOpsSecret(workspace string, workspacesDir string) (string, error) {
 
 		if strings.HasPrefix(envVar, "BITSWAN_GITOPS_SECRET=") {
 			parts := strings.SplitN(envVar, "=", 2)
-			if len(parts) == 2 {
+			if len(parts) == 2 && parts[1] != "" {
 				return parts[1], nil
 			}
 		}
 	}
 
-	return "", fmt.Errorf("GitOps secret not found")
+	return "", errGitopsSecretNotFound
+}
+
+// getWorkspaceNames returns the names of all workspaces in the workspaces directory
+func getWorkspaceNames(workspacesDir string) ([]string, error) {
+	// Check if directory exists
+	if _, err := host.Stat(workspacesDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("workspaces directory not found: %s", workspacesDir)
+	}
+
+	// Read directory entries
+	entries, err := host.ReadDir(workspacesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspaces directory: %w", err)
+	}
+
+	var workspaceNames []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			workspaceNames = append(workspaceNames, entry.Name())
+		}
+	}
+
+	return workspaceNames, nil
 }
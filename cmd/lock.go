@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// lockTimeout is how long commands wait for locks held by other bitswan processes,
+// set by --lock-timeout
+var lockTimeout = workspace.DefaultLockTimeout
+
+// lockCommand is recorded in the locks for processes waiting for them. Only the
+// command is, its arguments may hold secrets.
+var lockCommand = "bitswan"
+
+// lockWorkspaces takes the locks of workspaces until unlock is called. They are
+// taken in name order so that commands changing several workspaces cannot deadlock.
+func lockWorkspaces(workspaceNames ...string) (unlock func(), err error) {
+	names := append([]string(nil), workspaceNames...)
+	sort.Strings(names)
+
+	var locks []*workspace.Lock
+	unlock = func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if err := locks[i].Unlock(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+	for _, name := range names {
+		lock, err := workspace.LockWorkspace(name, lockCommand, lockTimeout)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return unlock, nil
+}
+
+// withGlobalLock runs fn while holding the lock of the Caddy configuration and the
+// Docker network. It must not be nested, the lock is not reentrant.
+func withGlobalLock(fn func() error) error {
+	lock, err := workspace.LockGlobal(lockCommand, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:          "migrate",
+		Short:        "Upgrade the metadata of all workspaces to the current schema",
+		Long:         "Upgrade metadata.yaml of every workspace to the schema of this version of bitswan and report the migrations applied. Workspaces are also upgraded when a command reads them, migrate writes the upgrade to disk.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workspaceNames, err := selectWorkspaces(nil, true, "")
+			if err != nil {
+				return err
+			}
+			return forEachWorkspace(workspaceNames, func(workspaceName string) error {
+				applied, err := migrateWorkspaceMetadata(workspaceName, dryRun)
+				if err != nil {
+					return err
+				}
+				if len(applied) == 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: up to date (schema version %d)\n", workspaceName, config.MetadataVersion)
+					return nil
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s:\n", workspaceName)
+				for _, migration := range applied {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", migration)
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report the migrations without writing them")
+
+	return cmd
+}
+
+// migrateWorkspaceMetadata rewrites metadata.yaml of a workspace in the current
+// schema and returns the migrations applied. The secrets are written as they were
+// read, so no access to the secrets key is needed.
+func migrateWorkspaceMetadata(workspaceName string, dryRun bool) ([]string, error) {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	metadataPath := ws.Path(config.MetadataFile)
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", config.MetadataFile, err)
+	}
+
+	metadata, applied, err := config.ParseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 || dryRun {
+		return applied, nil
+	}
+
+	data, err = metadata.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.WriteFile(config.MetadataFile, data, 0644); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+)
+
+func TestMigrateWorkspaceMetadata(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	gitopsConfig := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "workspaces", "alpha")
+	require.NoError(t, os.MkdirAll(gitopsConfig, 0755))
+	original := "domain: example.com\ngitops-secret: enc:v1:sealed\nmqtt_username: 1234\n"
+	require.NoError(t, os.WriteFile(filepath.Join(gitopsConfig, config.MetadataFile), []byte(original), 0644))
+
+	applied, err := migrateWorkspaceMetadata("alpha", true)
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+	data, err := os.ReadFile(filepath.Join(gitopsConfig, config.MetadataFile))
+	require.NoError(t, err)
+	assert.Equal(t, original, string(data))
+
+	applied, err = migrateWorkspaceMetadata("alpha", false)
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+	metadata, err := config.ReadMetadataSealed(gitopsConfig)
+	require.NoError(t, err)
+	assert.Equal(t, config.MetadataVersion, metadata.SchemaVersion)
+	assert.Equal(t, "1234", *metadata.MqttUsername)
+	// The secrets are written without decrypting them
+	assert.Equal(t, "enc:v1:sealed", metadata.GitopsSecret)
+
+	applied, err = migrateWorkspaceMetadata("alpha", false)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
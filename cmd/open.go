@@ -2,18 +2,13 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
-)
 
-type MetadataOpen struct {
-	EditorURL *string `yaml:"editor-url,omitempty"`
-}
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+)
 
 func newOpenCmd() *cobra.Command {
 	return &cobra.Command{
@@ -26,10 +21,7 @@ func newOpenCmd() *cobra.Command {
 }
 
 func runOpenCmd(cmd *cobra.Command, args []string) error {
-	workspacePath := filepath.Join(os.Getenv("HOME"), ".config/bitswan/workspaces", args[0])
-	metadataPath := filepath.Join(workspacePath, "metadata.yaml")
-
-	metadata, err := loadMetadata(metadataPath)
+	metadata, err := config.ReadMetadataSealed(config.WorkspaceDir(args[0]))
 	if err != nil {
 		return err
 	}
@@ -42,20 +34,6 @@ func runOpenCmd(cmd *cobra.Command, args []string) error {
 	return openURL(*metadata.EditorURL)
 }
 
-func loadMetadata(metadataPath string) (*MetadataOpen, error) {
-	data, err := os.ReadFile(metadataPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata file: %w", err)
-	}
-
-	var metadata MetadataOpen
-	if err := yaml.Unmarshal(data, &metadata); err != nil {
-		return nil, fmt.Errorf("failed to parse metadata file: %w", err)
-	}
-
-	return &metadata, nil
-}
-
 func openURL(url string) error {
 	var cmd *exec.Cmd
 
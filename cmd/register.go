@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secrets"
 )
 
 type DeviceAuthorizationResponse struct {
@@ -215,7 +217,7 @@ func newRegisterCmd() *cobra.Command {
 			}
 
 			fmt.Printf("Successfully registered workspace as automation server. You can close the browser tab.\n")
-			fmt.Println("Access token, AOC BE URL, and Automation server ID have been saved to ~/.config/bitswan/aoc/automation_server.yaml.")
+			fmt.Printf("Access token, AOC BE URL, and Automation server ID have been saved to %s.\n", automationServerYamlPath())
 
 			return nil
 		},
@@ -252,26 +254,51 @@ func sendRequest(method, url string, payload []byte, bearerToken string) (*http.
 }
 
 func saveAutomationServerYaml(aocUrl string, automationServerId string, accessToken string) error {
-	automationServerYaml := AutomationServerYaml{
+	return writeAutomationServerYaml(&AutomationServerYaml{
 		AOCUrl:             aocUrl,
 		AutomationServerId: automationServerId,
 		AccessToken:        accessToken,
+	})
+}
+
+func automationServerYamlPath() string {
+	return home.Path("aoc", "automation_server.yaml")
+}
+
+// readAutomationServerYaml reads the AOC registration and decrypts its access token
+func readAutomationServerYaml() (*AutomationServerYaml, error) {
+	yamlFile, err := host.ReadFile(automationServerYamlPath())
+	if err != nil {
+		return nil, err
 	}
 
-	aocDir := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "aoc")
+	var automationConfig AutomationServerYaml
+	if err := yaml.Unmarshal(yamlFile, &automationConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal automation_server.yaml: %w", err)
+	}
+	if automationConfig.AccessToken, err = secrets.Decrypt(automationConfig.AccessToken); err != nil {
+		return nil, fmt.Errorf("failed to decrypt AOC access token: %w", err)
+	}
+	return &automationConfig, nil
+}
 
-	// Marshal to YAML
-	yamlData, err := yaml.Marshal(automationServerYaml)
+// writeAutomationServerYaml writes the AOC registration with its access token encrypted
+func writeAutomationServerYaml(automationConfig *AutomationServerYaml) error {
+	encrypted := *automationConfig
+	var err error
+	if encrypted.AccessToken, err = secrets.Encrypt(automationConfig.AccessToken); err != nil {
+		return fmt.Errorf("failed to encrypt AOC access token: %w", err)
+	}
+
+	yamlData, err := yaml.Marshal(encrypted)
 	if err != nil {
 		return fmt.Errorf("failed to marshal automation server yaml: %w", err)
 	}
 
-	// Write to file
-	automationServerYamlPath := filepath.Join(aocDir, "automation_server.yaml")
-	if err := os.WriteFile(automationServerYamlPath, yamlData, 0644); err != nil {
+	// Replacing the file also restricts files written by older versions, which were readable by everyone
+	if err := host.WriteFile(automationServerYamlPath(), yamlData, 0600); err != nil {
 		return fmt.Errorf("failed to write automation server yaml file: %w", err)
 	}
 
 	return nil
-
 }
@@ -13,6 +13,8 @@ import (
 
 	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
 	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
@@ -23,13 +25,6 @@ type Compose struct {
 	} `yaml:"services"`
 }
 
-// Metadata only desired field
-type Metadata struct {
-	EditorURL    *string `yaml:"editor-url"`
-	GitOpsURL    string  `yaml:"gitops-url"`
-	GitOpsSecret string  `yaml:"gitops-secret"`
-}
-
 // ANSI color codes for terminal
 const (
 	reset  = "\033[0m"
@@ -143,26 +138,27 @@ func deleteHostsEntry(workspaceName string) error {
 }
 
 func removeGitops(workspaceName string) error {
-	bitswanPath := os.Getenv("HOME") + "/.config/bitswan/"
-	gitopsPath := bitswanPath + "workspaces/" + workspaceName
+	bitswanPath := home.Dir()
+
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// 1. Ask user for confirmation
 	var confirm string
 
 	fmt.Println("Automations in this gitops will be removed and cannot be recovered.")
 
-	metadataPath := gitopsPath + "/metadata.yaml"
-	data, err := os.ReadFile(metadataPath)
-	if err != nil {
+	if _, err := ws.ReadMetadataSealed(); err != nil {
 		return fmt.Errorf("error reading metadata file: %w", err)
 	}
 
-	var metadata Metadata
-	err = yaml.Unmarshal(data, &metadata)
-	if err != nil {
-		return fmt.Errorf("error unmarshalling metadata: %w", err)
-	}
-
 	// Parse the response
 	automationSet, err := automations.GetListAutomations(workspaceName)
 	var skipAutomationRemoval bool
@@ -214,7 +210,7 @@ func removeGitops(workspaceName string) error {
 	// 3. Remove docker container and volume
 	fmt.Println("Removing docker containers and volumes...")
 	workspacesFolder := filepath.Join(bitswanPath, "workspaces")
-	dockerComposePath := filepath.Join(workspacesFolder, workspaceName, "deployment")
+	dockerComposePath := ws.DeploymentDir()
 	projectName := workspaceName + "-site"
 	cmd := exec.Command("docker", "compose", "-p", projectName, "down", "--volumes")
 	cmd.Dir = dockerComposePath
@@ -227,10 +223,9 @@ func removeGitops(workspaceName string) error {
 
 	// 4. Remove images used by docker-compose
 	fmt.Println("Removing images used by docker-compose...")
-	dockerComposeFilePath := filepath.Join(dockerComposePath, "docker-compose.yml")
-	data, err = os.ReadFile(dockerComposeFilePath)
+	data, err := ws.ReadCompose()
 	if err != nil {
-		return fmt.Errorf("error reading docker-compose file: %w", err)
+		return err
 	}
 
 	var compose Compose
@@ -271,7 +266,9 @@ func removeGitops(workspaceName string) error {
 
 	// 6. Remove caddy files
 	fmt.Println("Removing caddy files...")
-	err = caddyapi.DeleteCaddyRecords(workspaceName)
+	err = withGlobalLock(func() error {
+		return caddyapi.DeleteCaddyRecords(workspaceName)
+	})
 	if err != nil {
 		return fmt.Errorf("error removing caddy files: %w", err)
 	}
@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/journal"
+	"github.com/bitswan-space/bitswan-workspaces/internal/spec"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newRenameCmd() *cobra.Command {
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "rename <old-name> <new-name>",
+		Short:        "Rename a workspace in place",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			oldName, newName := args[0], args[1]
+
+			// Both names are locked, so that no other command uses the new name meanwhile
+			unlock, err := lockWorkspaces(oldName, newName)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			j := journal.New()
+			defer func() {
+				if err == nil {
+					return
+				}
+				fmt.Println("Rename failed, rolling back...")
+				if rollbackErr := j.Rollback(); rollbackErr != nil {
+					fmt.Printf("\033[33mWarning: rollback was incomplete: %v\033[0m\n", rollbackErr)
+				} else {
+					fmt.Println("Rollback finished.")
+				}
+			}()
+
+			fmt.Printf("Renaming workspace %s to %s...\n", oldName, newName)
+			if err := renameWorkspace(oldName, newName, verbose, j); err != nil {
+				return fmt.Errorf("error renaming workspace: %w", err)
+			}
+			fmt.Printf("Workspace %s renamed to %s successfully!\n", oldName, newName)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func renameWorkspace(oldName, newName string, verbose bool, j *journal.Journal) error {
+	if err := spec.ValidateName(newName); err != nil {
+		return err
+	}
+
+	bitswanConfig := home.Dir()
+	oldConfig := filepath.Join(bitswanConfig, "workspaces", oldName)
+	newConfig := filepath.Join(bitswanConfig, "workspaces", newName)
+
+	if _, err := os.Stat(oldConfig); os.IsNotExist(err) {
+		return fmt.Errorf("workspace %s does not exist", oldName)
+	}
+	if _, err := os.Stat(newConfig); !os.IsNotExist(err) {
+		return fmt.Errorf("workspace %s already exists", newName)
+	}
+
+	metadataPath := filepath.Join(oldConfig, config.MetadataFile)
+	oldMetadata, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata.yaml: %w", err)
+	}
+
+	// The secrets stay encrypted, rename does not change them
+	metadata, _, err := config.ParseMetadata(oldMetadata)
+	if err != nil {
+		return err
+	}
+	noIde := metadata.EditorURL == nil
+
+	// A stopped workspace has no services running and no Caddy routes, it is only
+	// moved and stays down until it is started under the new name
+	state, err := readStoppedState(oldConfig)
+	if err != nil {
+		return err
+	}
+	stopped := state != nil
+
+	// 1. Stop the services of the old compose project
+	oldProject, newProject := oldName+"-site", newName+"-site"
+	if !stopped {
+		fmt.Println("Stopping services...")
+		if err := composeProject(oldProject, filepath.Join(oldConfig, "deployment"), verbose, "down"); err != nil {
+			return err
+		}
+		j.Record("stop docker compose project "+oldProject, func() error {
+			return composeProject(oldProject, filepath.Join(oldConfig, "deployment"), verbose, "up", "-d")
+		})
+	}
+
+	// 2. Rename the gitops branch, the worktree keeps it checked out
+	repoDir := filepath.Join(oldConfig, "workspace")
+	if err := gitCommand(repoDir, verbose, "branch", "-m", oldName, newName); err != nil {
+		return fmt.Errorf("failed to rename branch: %w", err)
+	}
+	j.Record("rename branch "+oldName+" to "+newName, func() error {
+		return gitCommand(filepath.Join(oldConfig, "workspace"), verbose, "branch", "-m", newName, oldName)
+	})
+
+	// 3. Move the workspace directory and repair the worktree links
+	fmt.Println("Moving workspace directory...")
+	if err := os.Rename(oldConfig, newConfig); err != nil {
+		return fmt.Errorf("failed to move workspace directory: %w", err)
+	}
+	j.Record("move "+oldConfig+" to "+newConfig, func() error {
+		if err := os.Rename(newConfig, oldConfig); err != nil {
+			return err
+		}
+		return fixWorktreePaths(oldConfig)
+	})
+	if err := fixWorktreePaths(newConfig); err != nil {
+		return err
+	}
+
+	newWorktree := filepath.Join(newConfig, "gitops")
+	if err := gitCommand("", verbose, "config", "--global", "--add", "safe.directory", newWorktree); err != nil {
+		return fmt.Errorf("failed to add safe directory: %w", err)
+	}
+	j.Record("add safe.directory "+newWorktree, func() error {
+		return gitCommand("", verbose, "config", "--global", "--unset-all", "safe.directory", "^"+regexp.QuoteMeta(newWorktree)+"$")
+	})
+
+	// 4. Rewrite the docker-compose file and the metadata
+	composePath := filepath.Join(newConfig, "deployment", workspace.ComposeFile)
+	oldCompose, err := os.ReadFile(composePath)
+	if err != nil {
+		return fmt.Errorf("error reading docker-compose file: %w", err)
+	}
+	compose := renameInCompose(string(oldCompose), oldName, newName, oldConfig, newConfig)
+	if err := workspace.WriteFile(composePath, []byte(compose), 0755); err != nil {
+		return fmt.Errorf("failed to write docker-compose file: %w", err)
+	}
+	j.Record("rewrite docker-compose file", func() error {
+		return workspace.WriteFile(composePath, oldCompose, 0755)
+	})
+
+	// The overlay may refer to the workspace directory as well
+	overridePath := filepath.Join(newConfig, "deployment", dockercompose.OverrideFile)
+	if oldOverride, err := os.ReadFile(overridePath); err == nil {
+		override := renameInCompose(string(oldOverride), oldName, newName, oldConfig, newConfig)
+		if err := workspace.WriteFile(overridePath, []byte(override), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dockercompose.OverrideFile, err)
+		}
+		j.Record("rewrite "+dockercompose.OverrideFile, func() error {
+			return workspace.WriteFile(overridePath, oldOverride, 0644)
+		})
+	}
+
+	// Earlier revisions have to use the new name as well, so that they can be rolled back to
+	h, err := history.Load(filepath.Join(newConfig, "deployment"))
+	if err != nil {
+		return err
+	}
+	for _, revisionPath := range h.Files() {
+		revisionPath := revisionPath
+		oldRevision, err := os.ReadFile(revisionPath)
+		if err != nil {
+			return fmt.Errorf("failed to read revision: %w", err)
+		}
+		if err := workspace.WriteFile(revisionPath, []byte(renameInCompose(string(oldRevision), oldName, newName, oldConfig, newConfig)), 0644); err != nil {
+			return fmt.Errorf("failed to write revision: %w", err)
+		}
+		j.Record("rewrite revision "+revisionPath, func() error {
+			return workspace.WriteFile(revisionPath, oldRevision, 0644)
+		})
+	}
+
+	metadata.GitopsURL = fmt.Sprintf("https://%s-gitops.%s", newName, metadata.Domain)
+	if !noIde {
+		editorURL := fmt.Sprintf("https://%s-editor.%s", newName, metadata.Domain)
+		metadata.EditorURL = &editorURL
+	}
+	newMetadata, err := metadata.Marshal()
+	if err != nil {
+		return err
+	}
+	newMetadataPath := filepath.Join(newConfig, config.MetadataFile)
+	if err := workspace.WriteFile(newMetadataPath, newMetadata, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	j.Record("rewrite metadata.yaml", func() error {
+		return workspace.WriteFile(newMetadataPath, oldMetadata, 0644)
+	})
+
+	// 5. Rename the workspace record in the AOC
+	if metadata.WorkspaceId != nil {
+		if err := renameAOCWorkspace(*metadata.WorkspaceId, newName, metadata.Domain, noIde); err != nil {
+			return err
+		}
+		j.Record("rename workspace in AOC", func() error {
+			return renameAOCWorkspace(*metadata.WorkspaceId, oldName, metadata.Domain, noIde)
+		})
+	}
+
+	// 6. Move the Caddy routes and TLS policies over to the new name
+	if !stopped {
+		if err := registerCaddyRoutes(newName, metadata.Domain, noIde); err != nil {
+			return err
+		}
+		j.Record("register Caddy routes of "+newName, func() error {
+			if err := unregisterCaddyRoutes(newName); err != nil {
+				return err
+			}
+			return registerCaddyRoutes(oldName, metadata.Domain, noIde)
+		})
+		if err := unregisterCaddyRoutes(oldName); err != nil {
+			return err
+		}
+	}
+
+	// 7. Update /etc/hosts records, when the workspace has them
+	renamed, err := renameHostsEntries(oldName, newName, metadata.Domain)
+	if err != nil {
+		return err
+	}
+	if renamed {
+		j.Record("rename /etc/hosts records", func() error {
+			_, err := renameHostsEntries(newName, oldName, metadata.Domain)
+			return err
+		})
+	}
+
+	// 8. Start the services under the new compose project
+	if stopped {
+		fmt.Println("Workspace is stopped, its services run under the new name once it is started.")
+	} else {
+		fmt.Println("Starting services...")
+		j.Record("start docker compose project "+newProject, func() error {
+			return composeProject(newProject, filepath.Join(newConfig, "deployment"), verbose, "down")
+		})
+		if err := composeProject(newProject, filepath.Join(newConfig, "deployment"), verbose, "up", "-d"); err != nil {
+			return err
+		}
+	}
+
+	// 9. Publish the renamed branch when the workspace has a remote repository
+	newRepoDir := filepath.Join(newConfig, "workspace")
+	hasRemote := gitCommand(newRepoDir, false, "remote", "get-url", "origin") == nil
+	if hasRemote {
+		if err := gitCommand(newWorktree, verbose, "push", "-u", "origin", newName); err != nil {
+			return fmt.Errorf("failed to push branch %s: %w", newName, err)
+		}
+	}
+
+	// Everything below only cleans up after the old name, failures are not rolled back
+	if hasRemote {
+		if err := gitCommand(newRepoDir, verbose, "push", "origin", "--delete", oldName); err != nil {
+			fmt.Printf("\033[33mWarning: failed to delete remote branch %s: %v\033[0m\n", oldName, err)
+		}
+	}
+
+	oldWorktree := filepath.Join(oldConfig, "gitops")
+	if err := gitCommand("", verbose, "config", "--global", "--unset-all", "safe.directory", "^"+regexp.QuoteMeta(oldWorktree)+"$"); err != nil {
+		fmt.Printf("\033[33mWarning: failed to remove safe.directory %s: %v\033[0m\n", oldWorktree, err)
+	}
+
+	conf, err := config.GetConfig()
+	if err == nil && conf.ActiveWorkspace == oldName {
+		conf.ActiveWorkspace = newName
+		err = conf.Save()
+	}
+	if err != nil {
+		fmt.Printf("\033[33mWarning: failed to update the active workspace: %v\033[0m\n", err)
+	}
+
+	return nil
+}
+
+// renameInCompose replaces the workspace name and directory in a docker-compose file
+// generated by dockercompose.CreateDockerComposeFile
+func renameInCompose(compose, oldName, newName, oldConfig, newConfig string) string {
+	replacer := strings.NewReplacer(
+		oldConfig+"/", newConfig+"/",
+		"BITSWAN_GITOPS_DIR_HOST="+oldConfig+"\n", "BITSWAN_GITOPS_DIR_HOST="+newConfig+"\n",
+		"BITSWAN_WORKSPACE_NAME="+oldName+"\n", "BITSWAN_WORKSPACE_NAME="+newName+"\n",
+		"hostname: "+oldName+"-gitops\n", "hostname: "+newName+"-gitops\n",
+		"hostname: "+oldName+"-editor\n", "hostname: "+newName+"-editor\n",
+		"http://"+oldName+"-gitops:", "http://"+newName+"-gitops:",
+		dockercompose.WorkspaceLabel+": "+oldName+"\n", dockercompose.WorkspaceLabel+": "+newName+"\n",
+	)
+	return replacer.Replace(compose)
+}
+
+func composeProject(projectName, dir string, verbose bool, args ...string) error {
+	cmd := host.Command(dir, "docker", append([]string{"compose", "-p", projectName}, args...)...)
+	if err := runCommandVerbose(cmd, verbose); err != nil {
+		return fmt.Errorf("failed to run docker compose %s for %s: %w", strings.Join(args, " "), projectName, err)
+	}
+	return nil
+}
+
+func gitCommand(dir string, verbose bool, args ...string) error {
+	cmd := host.Command(dir, "git", args...)
+	return runCommandVerbose(cmd, verbose)
+}
+
+func unregisterCaddyRoutes(workspaceName string) error {
+	return withGlobalLock(func() error {
+		for _, id := range []string{"gitops", "editor", "tlspolicy", "tlscerts"} {
+			if err := caddyapi.UnregisterCaddyService(id, workspaceName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// renameAOCWorkspace updates the name and editor URL of the workspace record in the AOC
+func renameAOCWorkspace(workspaceId, workspaceName, domain string, noIde bool) error {
+	automationConfig, err := readAutomationServerYaml()
+	if err != nil {
+		return fmt.Errorf("failed to read automation_server.yaml: %w", err)
+	}
+
+	payload := map[string]interface{}{
+		"name": workspaceName,
+	}
+	if !noIde {
+		payload["editor_url"] = fmt.Sprintf("https://%s-editor.%s", workspaceName, domain)
+	}
+
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	fmt.Println("Renaming workspace in AOC...")
+	resp, err := sendRequest("PATCH", fmt.Sprintf("%s/api/workspaces/%s/", automationConfig.AOCUrl, workspaceId), jsonBytes, automationConfig.AccessToken)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to rename workspace in AOC: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// renameHostsEntries rewrites the /etc/hosts records of a workspace, it reports
+// whether there were any records to rename
+func renameHostsEntries(oldName, newName, domain string) (bool, error) {
+	input, err := os.ReadFile("/etc/hosts")
+	if err != nil {
+		return false, nil
+	}
+
+	replacer := strings.NewReplacer(
+		" "+oldName+"-gitops."+domain, " "+newName+"-gitops."+domain,
+		" "+oldName+"-editor."+domain, " "+newName+"-editor."+domain,
+	)
+	output := replacer.Replace(string(input))
+	if output == string(input) {
+		return false, nil
+	}
+
+	fmt.Println("Updating /etc/hosts records...")
+	cmd := exec.Command("sudo", "tee", "/etc/hosts")
+	cmd.Stdin = strings.NewReader(output)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("failed to write /etc/hosts: %w", err)
+	}
+	return true, nil
+}
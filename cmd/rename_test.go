@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+)
+
+func TestRenameInCompose(t *testing.T) {
+	oldConfig := "/home/user/.config/bitswan/workspaces/alpha"
+	newConfig := "/home/user/.config/bitswan/workspaces/beta"
+
+	compose, _, err := dockercompose.CreateDockerComposeFile(oldConfig, "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", false, nil, nil, map[string]string{"env": "prod"}, dockercompose.Limits{}, nil)
+	require.NoError(t, err)
+
+	renamed := renameInCompose(compose, "alpha", "beta", oldConfig, newConfig)
+	assert.NotContains(t, renamed, "alpha")
+	assert.Contains(t, renamed, "hostname: beta-gitops")
+	assert.Contains(t, renamed, "hostname: beta-editor")
+	assert.Contains(t, renamed, "BITSWAN_WORKSPACE_NAME=beta")
+	assert.Contains(t, renamed, "BITSWAN_GITOPS_DIR_HOST="+newConfig)
+	assert.Contains(t, renamed, "http://beta-gitops:8079")
+	assert.Contains(t, renamed, newConfig+"/gitops:/gitops/gitops:z")
+	assert.Contains(t, renamed, "space.bitswan.workspace: beta\n")
+	assert.Contains(t, renamed, "space.bitswan.label.env: prod\n")
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newRollbackCmd() *cobra.Command {
+	var to int
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "rollback <workspace-name>",
+		Short:        "Restore a previous revision of a workspace and restart its services",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workspaceName := args[0]
+			revision, err := rollbackWorkspace(workspaceName, to, verbose)
+			if err != nil {
+				return fmt.Errorf("error rolling back workspace: %w", err)
+			}
+			fmt.Printf("Workspace %s rolled back to revision %d!\n", workspaceName, revision)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&to, "to", 0, "Revision to roll back to (defaults to the previous revision)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func rollbackWorkspace(workspaceName string, to int, verbose bool) (int, error) {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+	deploymentDir := ws.DeploymentDir()
+
+	h, err := history.Load(deploymentDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var target *history.Revision
+	if to == 0 {
+		if target = h.Previous(); target == nil {
+			return 0, fmt.Errorf("no previous revision to roll back to")
+		}
+	} else if target, err = h.Get(to); err != nil {
+		return 0, err
+	}
+	if target.Number == h.Current().Number {
+		return 0, fmt.Errorf("revision %d is already the current revision", target.Number)
+	}
+
+	compose, err := h.Compose(target.Number)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkComposeOverride(deploymentDir, compose); err != nil {
+		return 0, err
+	}
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Rolling back workspace %s to revision %d...\n", workspaceName, target.Number)
+
+	// The revision decides whether the editor is deployed
+	_, hasEditor := target.Images["bitswan-editor"]
+	noIde := !hasEditor
+	if (metadata.EditorURL == nil) != noIde {
+		if err := toggleEditor(ws, metadata, noIde); err != nil {
+			return 0, err
+		}
+	}
+
+	// The gitops secret only changes with secret rotate, keep the one the services use.
+	// Revisions recorded before the secrets were moved out have them inline, and
+	// restoring theirs would silently undo a rotation.
+	secret, err := getGitOpsSecret(workspaceName, filepath.Dir(gitopsConfig))
+	if err != nil && !errors.Is(err, errGitopsSecretNotFound) {
+		return 0, fmt.Errorf("failed to read gitops secret: %w", err)
+	}
+	compose, envFiles, err := dockercompose.ExternalizeSecrets(compose)
+	if err != nil {
+		return 0, err
+	}
+	if secret != "" {
+		values := map[string]string{"BITSWAN_GITOPS_SECRET": secret, "BITSWAN_DEPLOY_SECRET": secret}
+		for name, content := range envFiles {
+			envFiles[name] = dockercompose.SetEnvFileValues(content, values)
+		}
+	}
+	if err := writeSecretFiles(deploymentDir, envFiles, workspace.WriteFile); err != nil {
+		return 0, err
+	}
+
+	if compose, err = writeComposeFiles(deploymentDir, compose, workspace.WriteFile); err != nil {
+		return 0, err
+	}
+
+	if secret != "" && secret != metadata.GitopsSecret {
+		metadata.GitopsSecret = secret
+		if err := ws.WriteMetadata(metadata); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := recordRevision(gitopsConfig, compose, fmt.Sprintf("rollback to %d", target.Number)); err != nil {
+		return 0, err
+	}
+
+	// A stopped workspace stays down, start brings it up with the restored files
+	stopped, err := readStoppedState(gitopsConfig)
+	if err != nil {
+		return 0, err
+	}
+	if stopped != nil {
+		fmt.Println("Workspace is stopped, it runs the restored revision once it is started.")
+		return target.Number, nil
+	}
+
+	fmt.Println("Restarting services...")
+	projectName := workspaceName + "-site"
+	if err := composeProject(projectName, deploymentDir, verbose, "down"); err != nil {
+		return 0, err
+	}
+	if err := composeProject(projectName, deploymentDir, verbose, "up", "-d", "--remove-orphans"); err != nil {
+		return 0, err
+	}
+	fmt.Println("Services restarted!")
+
+	if err := registerCaddyRoutes(workspaceName, metadata.Domain, noIde); err != nil {
+		return 0, err
+	}
+
+	return target.Number, nil
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/health"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+type rolloutOptions struct {
+	all           bool
+	selector      string
+	parallel      int
+	healthTimeout time.Duration
+}
+
+type rolloutResult struct {
+	Workspace   string
+	Status      string
+	GitopsImage string
+	EditorImage string
+	Duration    time.Duration
+	Detail      string
+}
+
+const (
+	rolloutUpdated = "updated"
+	rolloutFailed  = "failed"
+	rolloutSkipped = "skipped"
+)
+
+// rolloutUpdate updates the workspaces in batches of ro.parallel. Every workspace of a
+// batch has to come up healthy before the next batch starts, the first failure stops
+// the rollout and the remaining workspaces are skipped. Workspaces parked with
+// workspace stop are skipped too, they would never come up healthy.
+func rolloutUpdate(out io.Writer, workspaceNames []string, o *updateOptions, ro *rolloutOptions) error {
+	if len(workspaceNames) == 0 {
+		return fmt.Errorf("no workspaces selected")
+	}
+	parallel := max(ro.parallel, 1)
+
+	// The examples repository is shared, so update it once instead of from every workspace
+	if !o.skipExamples {
+		fmt.Println("Ensuring examples are up to date...")
+		if err := EnsureExamples(home.Dir(), true); err != nil {
+			return fmt.Errorf("failed to download examples: %w", err)
+		}
+	}
+
+	// Resolve the images once per channel, so that all workspaces get the same versions
+	type images struct{ gitops, editor string }
+	resolved := map[string]images{}
+	plans := make([]*updateOptions, len(workspaceNames))
+	metadatas := make([]config.Metadata, len(workspaceNames))
+	results := make([]rolloutResult, len(workspaceNames))
+	var pending []int
+
+	for i, workspaceName := range workspaceNames {
+		results[i] = rolloutResult{Workspace: workspaceName, Status: rolloutSkipped}
+
+		ws := workspace.New(workspaceName)
+		metadata, err := ws.ReadMetadataSealed()
+		if err != nil {
+			return fmt.Errorf("workspace %s: %w", workspaceName, err)
+		}
+		metadatas[i] = *metadata
+
+		stopped, err := readStoppedState(ws.Dir)
+		if err != nil {
+			return fmt.Errorf("workspace %s: %w", workspaceName, err)
+		}
+		if stopped != nil {
+			results[i].Detail = "stopped"
+			continue
+		}
+		pending = append(pending, i)
+
+		channel := metadatas[i].Channel
+		if o.channel != "" {
+			channel = o.channel
+		}
+
+		imgs, ok := resolved[channel]
+		if !ok {
+			gitopsImage, editorImage, err := resolveImages(channel, o.gitopsImage, o.editorImage)
+			if err != nil {
+				return err
+			}
+			imgs = images{gitops: gitopsImage, editor: editorImage}
+			resolved[channel] = imgs
+			fmt.Printf("Channel %s resolves to %s and %s\n", channelName(channel), imgs.gitops, imgs.editor)
+		}
+
+		plans[i] = &updateOptions{
+			gitopsImage:  imgs.gitops,
+			editorImage:  imgs.editor,
+			channel:      o.channel,
+			noIde:        o.noIde,
+			skipExamples: true,
+			setLimits:    o.setLimits,
+		}
+	}
+
+	failed := false
+	for start := 0; start < len(pending) && !failed; start += parallel {
+		end := min(start+parallel, len(pending))
+		fmt.Printf("Updating %d of %d workspaces...\n", end, len(pending))
+
+		var wg sync.WaitGroup
+		for _, i := range pending[start:end] {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = updateAndWait(workspaceNames[i], metadatas[i], plans[i], ro.healthTimeout)
+			}(i)
+		}
+		wg.Wait()
+
+		for _, i := range pending[start:end] {
+			if results[i].Status == rolloutFailed {
+				failed = true
+			}
+		}
+	}
+
+	writeRolloutTable(out, results)
+	if failed {
+		return fmt.Errorf("rollout stopped after a failed update")
+	}
+	return nil
+}
+
+func updateAndWait(workspaceName string, metadata config.Metadata, o *updateOptions, healthTimeout time.Duration) rolloutResult {
+	started := time.Now()
+	result := rolloutResult{
+		Workspace:   workspaceName,
+		Status:      rolloutUpdated,
+		GitopsImage: o.gitopsImage,
+		EditorImage: o.editorImage,
+	}
+
+	noIde := metadata.EditorURL == nil
+	if o.noIde != nil {
+		noIde = *o.noIde
+	}
+	if noIde {
+		result.EditorImage = "-"
+	}
+
+	if err := updateLocked(workspaceName, o); err != nil {
+		result.Status = rolloutFailed
+		result.Detail = err.Error()
+	} else if err := waitForHealthy(workspaceName, noIde, healthTimeout); err != nil {
+		result.Status = rolloutFailed
+		result.Detail = err.Error()
+	}
+
+	result.Duration = time.Since(started).Round(time.Second)
+	return result
+}
+
+// waitForHealthy waits until the containers of the workspace run and its gitops API answers
+func waitForHealthy(workspaceName string, noIde bool, timeout time.Duration) error {
+	// The update stored a new gitops secret
+	metadata, err := workspace.New(workspaceName).ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	services := []string{"bitswan-gitops"}
+	if !noIde {
+		services = append(services, "bitswan-editor")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		check := health.CheckContainers(workspaceName+"-site", services)
+		if check.Status == health.OK {
+			check = checkGitopsAPI(*metadata)
+			if check.Status == health.OK {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not healthy after %s: %s", timeout, check.Detail)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func channelName(channel string) string {
+	if channel == "" {
+		return "stable"
+	}
+	return channel
+}
+
+func writeRolloutTable(out io.Writer, results []rolloutResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tSTATUS\tGITOPS\tEDITOR\tDURATION\tDETAIL")
+	for _, r := range results {
+		if r.Status == rolloutSkipped {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t%s\n", r.Workspace, r.Status, r.Detail)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Workspace, r.Status, r.GitopsImage, r.EditorImage, r.Duration, r.Detail)
+	}
+	w.Flush()
+}
@@ -9,28 +9,63 @@ import (
 
 	"github.com/bitswan-space/bitswan-workspaces/cmd/automation"
 	"github.com/bitswan-space/bitswan-workspaces/cmd/caddy"
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
 func newRootCmd(version string) *cobra.Command {
+	var homeDir string
+
 	cmd := &cobra.Command{
 		Use:   "bitswan",
 		Short: "Deploy your Jupyter pipelines with bitswan",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			lockCommand = cmd.CommandPath()
+			if host.Remote() != nil {
+				if !runsInRemoteContext(cmd) {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("%s is not supported in remote contexts, run it on the host", cmd.CommandPath())
+				}
+			} else if homeDir != "" {
+				home.Set(homeDir)
+			}
+			// Commands that need the config report when it cannot be read
+			if conf, err := config.GetConfig(); err == nil {
+				addr, err := host.Forward(conf.Caddy.Ports().Admin)
+				if err != nil {
+					return err
+				}
+				caddyapi.AdminURL = "http://" + addr
+			}
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmd.Help()
 		},
 	}
 
+	cmd.PersistentFlags().StringVar(&homeDir, "home", "", "BitSwan home directory (default $BITSWAN_HOME, $XDG_CONFIG_HOME/bitswan or ~/.config/bitswan)")
+	cmd.PersistentFlags().String("context", "", "Context to run the command in, see bitswan context (default $BITSWAN_CONTEXT or the current context)")
+	cmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", workspace.DefaultLockTimeout, "How long to wait for workspaces locked by other bitswan commands")
+
 	cmd.AddCommand(newVersionCmd(version)) // version subcommand
 	cmd.AddCommand(newWorkspaceCmd())      // workspace subcommand
 	cmd.AddCommand(newRegisterCmd())       // register subcommand
 	cmd.AddCommand(caddy.NewCaddyCmd())    // caddy subcommand
+	cmd.AddCommand(newDoctorCmd())         // doctor subcommand
+	cmd.AddCommand(newBundleCmd())         // bundle subcommand
+	cmd.AddCommand(newMigrateCmd())        // migrate subcommand
+	cmd.AddCommand(newContextCmd())        // context subcommand
 
 	// Check if the configuration file exists and has an active workspace
-	configPath := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "config.toml")
-	if _, err := os.Stat(configPath); err == nil {
+	configPath := config.ConfigPath()
+	if _, err := host.Stat(configPath); err == nil {
 		// File exists, read and parse it
-		configData, err := os.ReadFile(configPath)
+		configData, err := host.ReadFile(configPath)
 		if err == nil {
 			if strings.Contains(string(configData), "active_workspace = \"") {
 				cmd.AddCommand(automation.NewAutomationCmd())
@@ -61,6 +96,20 @@ func newWorkspaceCmd() *cobra.Command {
 	cmd.AddCommand(newRemoveCmd())
 	cmd.AddCommand(newSelectCmd())
 	cmd.AddCommand(newOpenCmd())
+	cmd.AddCommand(newApplyCmd())
+	cmd.AddCommand(newStatusCmd())
+	cmd.AddCommand(newBackupCmd())
+	cmd.AddCommand(newRestoreCmd())
+	cmd.AddCommand(newRenameCmd())
+	cmd.AddCommand(newStopCmd())
+	cmd.AddCommand(newStartCmd())
+	cmd.AddCommand(newHistoryCmd())
+	cmd.AddCommand(newRollbackCmd())
+	cmd.AddCommand(newLabelCmd())
+	cmd.AddCommand(newDiffCmd())
+	cmd.AddCommand(newEnvCmd())
+	cmd.AddCommand(newSecretCmd())
+	cmd.AddCommand(newEditorCmd())
 
 	return cmd
 }
@@ -125,8 +174,32 @@ func addExternalCommands(rootCmd *cobra.Command) {
 	}
 }
 
+// homeFromArgs returns the value of --home. The commands are added before the flags
+// are parsed, and which are depends on the config in the home.
+func homeFromArgs(args []string) string {
+	return flagValue(args, "home")
+}
+
 // Execute invokes the command.
 func Execute(version string) error {
+	args := os.Args[1:]
+	if homeDir := homeFromArgs(args); homeDir != "" {
+		home.Set(homeDir)
+	}
+
+	// Commands in a remote context manage the host over one SSH connection
+	contextName, context, err := resolveContext(args)
+	if err != nil {
+		return err
+	}
+	if context != nil && runsRemotely(args) {
+		conn, err := connectContext(contextName, context)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+
 	if err := newRootCmd(version).Execute(); err != nil {
 		return fmt.Errorf("error executing root command: %w", err)
 	}
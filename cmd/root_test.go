@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
 )
 
 func TestRootCommandOutput(t *testing.T) {
@@ -17,3 +20,24 @@ func TestRootCommandOutput(t *testing.T) {
 	cmdErr := cmd.RunE(cmd, nil)
 	require.NoError(t, cmdErr)
 }
+
+func TestHomeFromArgs(t *testing.T) {
+	require.Equal(t, "/srv/bitswan", homeFromArgs([]string{"--home", "/srv/bitswan", "workspace", "list"}))
+	require.Equal(t, "/srv/bitswan", homeFromArgs([]string{"workspace", "list", "--home=/srv/bitswan"}))
+	require.Empty(t, homeFromArgs([]string{"workspace", "list"}))
+	require.Empty(t, homeFromArgs([]string{"workspace", "env", "alpha", "--", "--home", "/srv/bitswan"}))
+
+	// --home takes precedence over BITSWAN_HOME, which takes precedence over XDG_CONFIG_HOME
+	xdg := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv(home.EnvVar, "")
+	t.Cleanup(func() { home.Set("") })
+	require.Equal(t, filepath.Join(xdg, "bitswan"), home.Dir())
+
+	t.Setenv(home.EnvVar, "/srv/env")
+	require.Equal(t, "/srv/env", home.Dir())
+
+	home.Set(homeFromArgs([]string{"--home", "/srv/flag", "workspace", "list"}))
+	require.Equal(t, "/srv/flag", home.Dir())
+}
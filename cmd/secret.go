@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+func newSecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage the secrets of workspaces",
+	}
+
+	cmd.AddCommand(newSecretMigrateCmd())
+	cmd.AddCommand(newSecretRotateCmd())
+
+	return cmd
+}
+
+func newSecretMigrateCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:          "migrate [<workspace-name>...] [--all]",
+		Short:        "Encrypt the plaintext secrets of workspaces created by older versions",
+		Long:         "Encrypt the gitops secret and MQTT password in metadata.yaml and the AOC access token, and move the secrets out of the docker-compose file and its revision history into env files only readable by the user.",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !all {
+				return fmt.Errorf("specify a workspace name or --all")
+			}
+			workspaceNames, err := selectWorkspaces(args, all, "")
+			if err != nil {
+				return err
+			}
+
+			if err := migrateAutomationServerSecrets(); err != nil {
+				return err
+			}
+			return forEachWorkspace(workspaceNames, func(workspaceName string) error {
+				fmt.Printf("Encrypting secrets of %s...\n", workspaceName)
+				return migrateWorkspaceSecrets(workspaceName)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Migrate all workspaces")
+
+	return cmd
+}
+
+func newSecretRotateCmd() *cobra.Command {
+	var verbose bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:          "rotate <workspace-name>",
+		Short:        "Replace the gitops secret of a workspace with a new one",
+		Long:         "Generate a new gitops secret, hand it to the gitops and editor services and check that the automations API accepts it. Clients that were given the old secret have to be updated.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rotateGitopsSecret(args[0], verbose, timeout)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute, "How long to wait for the automations API to accept the new secret")
+
+	return cmd
+}
+
+func rotateGitopsSecret(workspaceName string, verbose bool, timeout time.Duration) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	// The secret lives in the env files, move it there first if it is still inline
+	deploymentDir := ws.DeploymentDir()
+	compose, err := ws.ReadCompose()
+	if err != nil {
+		return err
+	}
+	written, err := writeComposeFiles(deploymentDir, compose, workspace.WriteFile)
+	if err != nil {
+		return err
+	}
+	if string(written) != string(compose) {
+		if err := recordRevision(gitopsConfig, written, "secret migrate"); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Rotating the gitops secret of %s...\n", workspaceName)
+	secret := dockercompose.NewGitopsSecret()
+	values := map[string]string{}
+	for _, key := range dockercompose.GitopsSecretVariables {
+		values[key] = secret
+	}
+	for _, name := range []string{dockercompose.GitopsSecretsFile, dockercompose.EditorSecretsFile} {
+		path := filepath.Join(deploymentDir, name)
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := workspace.WriteFile(path, dockercompose.SetEnvFileValues(content, values), 0600); err != nil {
+			return err
+		}
+	}
+
+	metadata.GitopsSecret = secret
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return err
+	}
+
+	noIde := metadata.EditorURL == nil
+	if workspaceState(workspaceName) != "running" {
+		fmt.Println("Gitops secret rotated, it is applied when the workspace starts.")
+	} else {
+		services := []string{"bitswan-gitops"}
+		if !noIde {
+			services = append(services, "bitswan-editor")
+		}
+		fmt.Println("Recreating services...")
+		upArgs := append([]string{"up", "-d", "--no-deps", "--force-recreate"}, services...)
+		if err := composeProject(workspaceName+"-site", deploymentDir, verbose, upArgs...); err != nil {
+			return err
+		}
+
+		fmt.Println("Checking the automations API...")
+		if err := waitForHealthy(workspaceName, noIde, timeout); err != nil {
+			return fmt.Errorf("the automations API does not accept the new secret: %w", err)
+		}
+		fmt.Println("Gitops secret rotated.")
+	}
+
+	fmt.Println("Updated: bitswan-gitops, metadata.yaml")
+	if !noIde {
+		fmt.Println("Updated: bitswan-editor (deploy secret)")
+	}
+	if metadata.WorkspaceId != nil {
+		fmt.Printf("Not updated: the AOC record of workspace %s, update it if it was given the old secret\n", *metadata.WorkspaceId)
+	}
+	fmt.Println("Not updated: scripts and clients that use the old secret, e.g. from bitswan workspace list --passwords")
+	return nil
+}
+
+func migrateWorkspaceSecrets(workspaceName string) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return err
+	}
+
+	deploymentDir := ws.DeploymentDir()
+	compose, err := ws.ReadCompose()
+	if err != nil {
+		return err
+	}
+	if _, err := writeComposeFiles(deploymentDir, compose, workspace.WriteFile); err != nil {
+		return err
+	}
+
+	// Earlier revisions had their own secrets, which are no longer in use
+	h, err := history.Load(deploymentDir)
+	if err != nil {
+		return err
+	}
+	for _, revisionPath := range h.Files() {
+		revision, err := os.ReadFile(revisionPath)
+		if err != nil {
+			return fmt.Errorf("failed to read revision: %w", err)
+		}
+		revision, _, err = dockercompose.ExternalizeSecrets(revision)
+		if err != nil {
+			return err
+		}
+		if err := workspace.WriteFile(revisionPath, revision, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateAutomationServerSecrets() error {
+	automationConfig, err := readAutomationServerYaml()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeAutomationServerYaml(automationConfig)
+}
+
+// writeComposeFiles writes the docker-compose file of a workspace. Its secrets are
+// moved to env files only readable by the user, which the services load. It returns
+// the docker-compose file as written, to be recorded in the revision history.
+func writeComposeFiles(deploymentDir string, compose []byte, write func(path string, data []byte, perm os.FileMode) error) ([]byte, error) {
+	compose, envFiles, err := dockercompose.ExternalizeSecrets(compose)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSecretFiles(deploymentDir, envFiles, write); err != nil {
+		return nil, err
+	}
+
+	if err := write(filepath.Join(deploymentDir, workspace.ComposeFile), compose, 0755); err != nil {
+		return nil, fmt.Errorf("failed to write docker-compose file: %w", err)
+	}
+	return compose, nil
+}
+
+// writeSecretFiles writes the env files holding the secrets of the services
+func writeSecretFiles(deploymentDir string, envFiles map[string][]byte, write func(path string, data []byte, perm os.FileMode) error) error {
+	for _, name := range []string{dockercompose.GitopsSecretsFile, dockercompose.EditorSecretsFile} {
+		content, ok := envFiles[name]
+		if !ok {
+			continue
+		}
+		if err := write(filepath.Join(deploymentDir, name), content, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
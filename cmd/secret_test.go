@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/history"
+)
+
+func TestWriteComposeFiles(t *testing.T) {
+	workspacesDir := t.TempDir()
+	deploymentDir := filepath.Join(workspacesDir, "alpha", "deployment")
+	require.NoError(t, os.MkdirAll(deploymentDir, 0755))
+	compose, token, err := dockercompose.CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "", "example.com", "", true, nil, nil, nil, dockercompose.Limits{}, nil)
+	require.NoError(t, err)
+
+	written, err := writeComposeFiles(deploymentDir, []byte(compose), os.WriteFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(written), token)
+
+	data, err := os.ReadFile(filepath.Join(deploymentDir, "docker-compose.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, written, data)
+
+	info, err := os.Stat(filepath.Join(deploymentDir, dockercompose.GitopsSecretsFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	secret, err := getGitOpsSecret("alpha", workspacesDir)
+	require.NoError(t, err)
+	assert.Equal(t, token, secret)
+}
+
+func TestGetGitOpsSecretNotFound(t *testing.T) {
+	workspacesDir := t.TempDir()
+	_, err := getGitOpsSecret("alpha", workspacesDir)
+	assert.ErrorIs(t, err, errGitopsSecretNotFound)
+
+	// A broken file is an error, not a reason to generate a new secret
+	deploymentDir := filepath.Join(workspacesDir, "alpha", "deployment")
+	require.NoError(t, os.MkdirAll(deploymentDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(deploymentDir, "docker-compose.yml"), []byte("services: ["), 0644))
+	_, err = getGitOpsSecret("alpha", workspacesDir)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errGitopsSecretNotFound)
+}
+
+func TestRecordInitialRevisionKeepsNoSecrets(t *testing.T) {
+	gitopsConfig := t.TempDir()
+	deploymentDir := filepath.Join(gitopsConfig, "deployment")
+	require.NoError(t, os.MkdirAll(deploymentDir, 0755))
+	compose, token, err := dockercompose.CreateDockerComposeFile(gitopsConfig, "alpha", "bitswan/gitops:1", "", "example.com", "", true, nil, nil, nil, dockercompose.Limits{}, nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(deploymentDir, "docker-compose.yml"), []byte(compose), 0755))
+
+	require.NoError(t, recordInitialRevision(gitopsConfig))
+
+	h, err := history.Load(deploymentDir)
+	require.NoError(t, err)
+	recorded, err := h.Compose(h.Current().Number)
+	require.NoError(t, err)
+	assert.NotContains(t, string(recorded), token)
+	assert.Contains(t, string(recorded), dockercompose.GitopsSecretsFile)
+}
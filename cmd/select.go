@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
 	"github.com/spf13/cobra"
 )
 
@@ -17,7 +19,7 @@ func newSelectCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			workspace := args[0]
-			bitswanDir := filepath.Join(os.Getenv("HOME"), ".config", "bitswan")
+			bitswanDir := home.Dir()
 
 			// Validate the workspace
 			err := checkValidWorkspace(workspace, bitswanDir)
@@ -49,17 +51,17 @@ func checkValidWorkspace(workspace string, bitswanDir string) error {
 	workspacesDir := filepath.Join(bitswanDir, "workspaces")
 
 	// Check if the workspaces directory exists
-	if _, err := os.Stat(workspacesDir); os.IsNotExist(err) {
+	if _, err := host.Stat(workspacesDir); os.IsNotExist(err) {
 		return fmt.Errorf("workspaces directory does not exist: %s", workspacesDir)
 	}
 
 	// Validate if the provided workspace exists in the workspaces directory
 	workspacePath := filepath.Join(workspacesDir, workspace)
-	if _, err := os.Stat(workspacePath); os.IsNotExist(err) {
+	if _, err := host.Stat(workspacePath); os.IsNotExist(err) {
 		var availableWorkspaces []string
 
 		// List available workspaces
-		files, err := os.ReadDir(workspacesDir)
+		files, err := host.ReadDir(workspacesDir)
 		if err != nil {
 			return fmt.Errorf("failed to read workspaces directory: %v", err)
 		}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/health"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// gitopsStartTimeout is how long start waits for the gitops API before restarting automations
+const gitopsStartTimeout = 2 * time.Minute
+
+func newStartCmd() *cobra.Command {
+	var selector string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "start <workspace-name>... | --selector <selector>",
+		Short:        "Start stopped workspaces",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && selector == "" {
+				return fmt.Errorf("specify a workspace name or --selector")
+			}
+			workspaceNames, err := selectWorkspaces(args, false, selector)
+			if err != nil {
+				return err
+			}
+
+			return forEachWorkspace(workspaceNames, func(workspaceName string) error {
+				fmt.Printf("Starting workspace %s...\n", workspaceName)
+				if err := startWorkspace(workspaceName, verbose); err != nil {
+					return fmt.Errorf("error starting workspace: %w", err)
+				}
+				fmt.Printf("Workspace %s started!\n", workspaceName)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Start all workspaces matching the label selector, e.g. env=staging")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func startWorkspace(workspaceName string, verbose bool) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	state, err := readStoppedState(gitopsConfig)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Starting services...")
+	if err := composeProject(workspaceName+"-site", ws.DeploymentDir(), verbose, "up", "-d"); err != nil {
+		return err
+	}
+
+	if err := registerCaddyRoutes(workspaceName, metadata.Domain, metadata.EditorURL == nil); err != nil {
+		return err
+	}
+
+	if state != nil && len(state.Automations) > 0 {
+		fmt.Println("Waiting for the gitops service...")
+		if err := waitForGitops(*metadata, gitopsStartTimeout); err != nil {
+			return err
+		}
+
+		for _, deploymentId := range state.Automations {
+			automation := automations.Automation{DeploymentID: deploymentId, Workspace: workspaceName}
+			fmt.Printf("Starting automation %s...\n", deploymentId)
+			if err := automation.Start(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Remove(filepath.Join(gitopsConfig, stoppedStateFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", stoppedStateFile, err)
+	}
+	return nil
+}
+
+// waitForGitops polls the gitops API until it answers or the timeout passes
+func waitForGitops(metadata config.Metadata, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		check := checkGitopsAPI(metadata)
+		if check.Status == health.OK {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("gitops service did not come up: %s", check.Detail)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
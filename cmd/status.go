@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/health"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secrets"
+)
+
+func newStatusCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:          "status [workspace-name...]",
+		Short:        "Report the health of workspaces",
+		Long:         "Report the health of the given workspaces (all workspaces by default). Exits with a non-zero code when any workspace is unhealthy.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := output.Validate(format); err != nil {
+				return err
+			}
+
+			workspacesDir := home.WorkspacesDir()
+			workspaceNames := args
+			if len(workspaceNames) == 0 {
+				var err error
+				workspaceNames, err = getWorkspaceNames(workspacesDir)
+				if err != nil {
+					return err
+				}
+			}
+
+			var reports []health.Report
+			healthy := true
+			for _, workspaceName := range workspaceNames {
+				report := workspaceStatus(workspaceName, workspacesDir)
+				healthy = healthy && report.Healthy
+				reports = append(reports, report)
+			}
+
+			err := output.WriteObject(cmd.OutOrStdout(), format, reports, func(w io.Writer, wide bool) error {
+				writeStatusTable(w, reports)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if !healthy {
+				return fmt.Errorf("one or more workspaces are unhealthy")
+			}
+			return nil
+		},
+	}
+
+	output.AddFlag(cmd, &format)
+
+	return cmd
+}
+
+func workspaceStatus(workspaceName, workspacesDir string) health.Report {
+	metadata, err := config.ReadMetadataSealed(filepath.Join(workspacesDir, workspaceName))
+	if err != nil {
+		return health.NewReport(workspaceName, health.Check{Name: "metadata", Status: health.Error, Detail: err.Error()})
+	}
+
+	// A stopped workspace has no containers nor routes on purpose
+	if _, err := host.Stat(filepath.Join(workspacesDir, workspaceName, stoppedStateFile)); err == nil {
+		return health.NewReport(workspaceName, health.Check{
+			Name:   "state",
+			Status: health.Warning,
+			Detail: "stopped",
+			Hint:   "run 'bitswan workspace start " + workspaceName + "'",
+		})
+	}
+
+	noIde := metadata.EditorURL == nil
+	services := []string{"bitswan-gitops"}
+	routeIds := []string{workspaceName + "_gitops"}
+	hosts := []string{fmt.Sprintf("%s-gitops.%s", workspaceName, metadata.Domain)}
+	if !noIde {
+		services = append(services, "bitswan-editor")
+		routeIds = append(routeIds, workspaceName+"_editor")
+		hosts = append(hosts, fmt.Sprintf("%s-editor.%s", workspaceName, metadata.Domain))
+	}
+
+	checks := []health.Check{
+		health.CheckContainers(workspaceName+"-site", services),
+		health.CheckCaddyObjects("caddy routes", routeIds),
+	}
+
+	// Workspaces without their own certificates use certificates managed by Caddy
+	certPath := home.Path("caddy", "certs", metadata.Domain, "full-chain.pem")
+	if _, err := host.Stat(certPath); err == nil {
+		checks = append(checks,
+			health.CheckCaddyObjects("caddy tls", []string{workspaceName + "_tlspolicy", workspaceName + "_tlscerts"}),
+			health.CheckCertificate(certPath, time.Now()),
+		)
+	} else {
+		checks = append(checks, health.Check{Name: "certificate", Status: health.OK, Detail: "managed by Caddy"})
+	}
+
+	checks = append(checks,
+		health.CheckDNS(hosts),
+		checkGitopsAPI(*metadata),
+		checkAOCRegistration(*metadata),
+	)
+
+	return health.NewReport(workspaceName, checks...)
+}
+
+// checkGitopsAPI verifies that the gitops service accepts the stored secret
+func checkGitopsAPI(metadata config.Metadata) health.Check {
+	check := health.Check{Name: "gitops api", Status: health.OK}
+
+	secret, err := secrets.Decrypt(metadata.GitopsSecret)
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := automations.SendAutomationRequest("GET", metadata.GitopsURL+"/automations", secret)
+	if err != nil {
+		check.Status = health.Error
+		check.Detail = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		check.Detail = metadata.GitopsURL + " answers"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		check.Status = health.Error
+		check.Detail = "stored gitops secret was rejected"
+	default:
+		check.Status = health.Error
+		check.Detail = fmt.Sprintf("%s/automations returned %s", metadata.GitopsURL, resp.Status)
+	}
+	return check
+}
+
+func checkAOCRegistration(metadata config.Metadata) health.Check {
+	if metadata.WorkspaceId == nil || *metadata.WorkspaceId == "" {
+		return health.Check{Name: "aoc", Status: health.OK, Detail: "not registered"}
+	}
+	return health.Check{Name: "aoc", Status: health.OK, Detail: "registered as " + *metadata.WorkspaceId}
+}
+
+func writeStatusTable(out io.Writer, reports []health.Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tCHECK\tSTATUS\tDETAIL")
+	for _, report := range reports {
+		for _, check := range report.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", report.Workspace, check.Name, check.Status, check.Detail)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/automations"
+	"github.com/bitswan-space/bitswan-workspaces/internal/health"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
+)
+
+// stoppedStateFile marks a stopped workspace and remembers what start has to bring back
+const stoppedStateFile = "stopped.yaml"
+
+type stoppedState struct {
+	// Deployment IDs of the automations stopped together with the workspace
+	Automations []string `yaml:"automations,omitempty"`
+}
+
+func newStopCmd() *cobra.Command {
+	var stopAutomations bool
+	var selector string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:          "stop <workspace-name>... | --selector <selector>",
+		Short:        "Stop workspaces without removing them",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && selector == "" {
+				return fmt.Errorf("specify a workspace name or --selector")
+			}
+			workspaceNames, err := selectWorkspaces(args, false, selector)
+			if err != nil {
+				return err
+			}
+
+			return forEachWorkspace(workspaceNames, func(workspaceName string) error {
+				fmt.Printf("Stopping workspace %s...\n", workspaceName)
+				if err := stopWorkspace(workspaceName, stopAutomations, verbose); err != nil {
+					return fmt.Errorf("error stopping workspace: %w", err)
+				}
+				fmt.Printf("Workspace %s stopped. Run 'bitswan workspace start %s' to start it again.\n", workspaceName, workspaceName)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&stopAutomations, "automations", false, "Also stop the running automations of the workspace")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Stop all workspaces matching the label selector, e.g. env=staging")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+
+	return cmd
+}
+
+func stopWorkspace(workspaceName string, stopAutomations, verbose bool) error {
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockWorkspaces(workspaceName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	gitopsConfig := ws.Dir
+
+	state, err := readStoppedState(gitopsConfig)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &stoppedState{}
+	}
+
+	// Automations are stopped through the gitops service, so before it goes down
+	if stopAutomations {
+		automationSet, err := automations.GetAutomations(workspaceName)
+		if err != nil {
+			return fmt.Errorf("failed to get automations, stop the workspace without --automations to leave them running: %w", err)
+		}
+
+		for _, automation := range automationSet {
+			if automation.State != "running" {
+				continue
+			}
+			fmt.Printf("Stopping automation %s...\n", automation.Name)
+			if err := automation.Stop(); err != nil {
+				return err
+			}
+			state.Automations = append(state.Automations, automation.DeploymentID)
+		}
+	}
+
+	// Write the state before anything else is torn down, so start can recover
+	// the stopped automations even if stopping fails halfway
+	if err := writeStoppedState(gitopsConfig, state); err != nil {
+		return err
+	}
+
+	fmt.Println("Detaching Caddy routes...")
+	if err := unregisterCaddyRoutes(workspaceName); err != nil {
+		return err
+	}
+
+	fmt.Println("Stopping services...")
+	return composeProject(workspaceName+"-site", ws.DeploymentDir(), verbose, "down")
+}
+
+// readStoppedState returns nil when the workspace is not stopped
+func readStoppedState(gitopsConfig string) (*stoppedState, error) {
+	data, err := host.ReadFile(filepath.Join(gitopsConfig, stoppedStateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", stoppedStateFile, err)
+	}
+
+	var state stoppedState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", stoppedStateFile, err)
+	}
+	return &state, nil
+}
+
+func writeStoppedState(gitopsConfig string, state *stoppedState) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", stoppedStateFile, err)
+	}
+	if err := workspace.WriteFile(filepath.Join(gitopsConfig, stoppedStateFile), data, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+// workspaceState tells whether the services of a workspace are running
+func workspaceState(workspaceName string) string {
+	states, err := health.ContainerStates(workspaceName + "-site")
+	if err != nil {
+		return "unknown"
+	}
+	for _, container := range states {
+		if container.State == "running" {
+			return "running"
+		}
+	}
+	return "stopped"
+}
@@ -2,36 +2,96 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"time"
 
-	"gopkg.in/yaml.v3"
-
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/codeserver"
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
 	"github.com/bitswan-space/bitswan-workspaces/internal/dockerhub"
+	"github.com/bitswan-space/bitswan-workspaces/internal/envfile"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
+	"github.com/bitswan-space/bitswan-workspaces/internal/workspace"
 	"github.com/spf13/cobra"
 )
 
 type updateOptions struct {
 	gitopsImage string
 	editorImage string
+	// channel overrides the release channel of the workspace, empty keeps the current one
+	channel string
+	// noIde overrides whether the editor is deployed, nil keeps the current setting
+	noIde *bool
+	// bundle is an offline bundle that provides the images and examples
+	bundle string
+	// skipExamples leaves updating the shared examples repository to the caller
+	skipExamples bool
+	// setLimits changes the resource limits of the workspace, nil keeps the current ones
+	setLimits func(l *dockercompose.Limits)
 }
 
 func newUpdateCmd() *cobra.Command {
 	o := &updateOptions{}
+	ro := &rolloutOptions{}
+	var flagLimits dockercompose.Limits
 	cmd := &cobra.Command{
-		Use:          "update <workspace-name>",
+		Use:          "update <workspace-name>... | --all",
 		Short:        "bitswan workspace update",
-		Args:         cobra.ExactArgs(1),
+		Args:         cobra.ArbitraryArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			o.setLimits = changedLimits(cmd, &flagLimits)
+			if err := flagLimits.Validate(); err != nil {
+				return err
+			}
+
+			if o.bundle != "" {
+				if host.Remote() != nil {
+					return fmt.Errorf("--bundle is not supported in remote contexts, run it on the host")
+				}
+				manifest, err := useBundle(o.bundle, true)
+				if err != nil {
+					return fmt.Errorf("failed to use bundle: %w", err)
+				}
+				if o.gitopsImage == "" {
+					o.gitopsImage = manifest.GitopsImage
+				}
+				if o.editorImage == "" {
+					o.editorImage = manifest.EditorImage
+				}
+				o.skipExamples = true
+			} else {
+				conf, err := config.GetConfig()
+				if err != nil {
+					return err
+				}
+				if err := registry.LoginAll(conf.Registry); err != nil {
+					return err
+				}
+			}
+
+			if ro.all || ro.selector != "" || len(args) > 1 {
+				workspaceNames, err := selectWorkspaces(args, ro.all, ro.selector)
+				if err != nil {
+					return err
+				}
+				return rolloutUpdate(cmd.OutOrStdout(), workspaceNames, o, ro)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("specify a workspace name, --all or --selector")
+			}
+
 			workspaceName := args[0]
 			fmt.Printf("Updating Gitops: %s...\n", workspaceName)
-			err := updateGitops(workspaceName, o)
+			err := updateLocked(workspaceName, o)
 			if err != nil {
 				return fmt.Errorf("error updating workspace: %w", err)
 			}
@@ -42,83 +102,89 @@ func newUpdateCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&o.gitopsImage, "gitops-image", "", "Custom image for the gitops")
 	cmd.Flags().StringVar(&o.editorImage, "editor-image", "", "Custom image for the editor")
+	cmd.Flags().StringVar(&o.channel, "channel", "", "Switch the release channel of the images: stable, beta or a version prefix such as 2025")
+	addLimitsFlags(cmd, &flagLimits)
+	cmd.Flags().StringVar(&o.bundle, "bundle", "", "Update from an offline bundle created with 'bitswan bundle create', without network access")
+	cmd.Flags().BoolVar(&ro.all, "all", false, "Update all workspaces")
+	cmd.Flags().StringVarP(&ro.selector, "selector", "l", "", "Only update workspaces matching the label selector, e.g. env=prod or name=team-*")
+	cmd.Flags().IntVar(&ro.parallel, "parallel", 2, "Number of workspaces updated at the same time")
+	cmd.Flags().DurationVar(&ro.healthTimeout, "health-timeout", 5*time.Minute, "How long to wait for an updated workspace to become healthy")
 
 	return cmd
 }
 
-func updateGitops(workspaceName string, o *updateOptions) error {
-	bitswanPath := os.Getenv("HOME") + "/.config/bitswan/"
-
-	repoPath := filepath.Join(bitswanPath, "bitswan-src")
-	// 1. Create or update examples directory
-	fmt.Println("Ensuring examples are up to date...")
-	err := EnsureExamples(repoPath, true)
+// updateLocked updates a workspace while holding its lock
+func updateLocked(workspaceName string, o *updateOptions) error {
+	unlock, err := lockWorkspaces(workspaceName)
 	if err != nil {
-		return fmt.Errorf("failed to download examples: %w", err)
+		return err
 	}
-	fmt.Println("Examples are up to date!")
+	defer unlock()
+	return updateGitops(workspaceName, o)
+}
 
-	// 2. Update Docker images and docker-compose file
-	fmt.Println("Updating Docker images and docker-compose file...")
-	gitopsImage := o.gitopsImage
-	if gitopsImage == "" {
-		gitopsLatestVersion, err := dockerhub.GetLatestDockerHubVersion("https://hub.docker.com/v2/repositories/bitswan/gitops/tags/")
+// updateGitops updates a workspace, the caller holds its lock
+func updateGitops(workspaceName string, o *updateOptions) error {
+	// 1. Create or update examples directory
+	if !o.skipExamples {
+		fmt.Println("Ensuring examples are up to date...")
+		err := EnsureExamples(home.Dir(), true)
 		if err != nil {
-			panic(fmt.Errorf("failed to get latest BitSwan GitOps version: %w", err))
+			return fmt.Errorf("failed to download examples: %w", err)
 		}
-		gitopsImage = "bitswan/gitops:" + gitopsLatestVersion
+		fmt.Println("Examples are up to date!")
 	}
 
-	bitswanEditorImage := o.editorImage
-	if o.editorImage == "" {
-		bitswanEditorLatestVersion, err := dockerhub.GetLatestDockerHubVersion("https://hub.docker.com/v2/repositories/bitswan/bitswan-editor/tags/")
-		if err != nil {
-			panic(fmt.Errorf("failed to get latest BitSwan Editor version: %w", err))
-		}
-		bitswanEditorImage = "bitswan/bitswan-editor:" + bitswanEditorLatestVersion
+	// 2. Update Docker images and docker-compose file
+	fmt.Println("Updating Docker images and docker-compose file...")
+	ws, err := workspace.Open(workspaceName)
+	if err != nil {
+		return err
 	}
+	gitopsConfig := ws.Dir
 
-	gitopsConfig := filepath.Join(bitswanPath, "workspaces/", workspaceName)
+	metadata, err := ws.ReadMetadata()
+	if err != nil {
+		return err
+	}
 
-	// Get the domain from the file `~/.config/bitswan/<workspace-name>/deployment/domain`
-	dataPath := filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "workspaces", workspaceName, "metadata.yaml")
+	channel := metadata.Channel
+	if o.channel != "" {
+		channel = o.channel
+	}
 
-	data, err := os.ReadFile(dataPath)
+	gitopsImage, bitswanEditorImage, err := resolveImages(channel, o.gitopsImage, o.editorImage)
 	if err != nil {
-		return fmt.Errorf("failed to read metadata.yaml: %w", err)
+		return err
 	}
+	fmt.Printf("Using %s and %s\n", gitopsImage, bitswanEditorImage)
 
-	// Config represents the structure of the YAML file
-	var metadata MetadataInit
-	if err := yaml.Unmarshal(data, &metadata); err != nil {
-		return fmt.Errorf("failed to unmarshal metadata.yaml: %w", err)
+	// Remember the channel for later updates once it resolved
+	if channel != metadata.Channel {
+		metadata.Channel = channel
+		if err := ws.WriteMetadata(metadata); err != nil {
+			return err
+		}
 	}
 
 	var mqttEnvVars []string
 	// Check if mqtt data are in the metadata
 	if metadata.MqttUsername != nil {
-		mqttEnvVars = append(mqttEnvVars, "MQTT_USERNAME="+fmt.Sprint(metadata.MqttUsername))
-		mqttEnvVars = append(mqttEnvVars, "MQTT_PASSWORD="+fmt.Sprint(metadata.MqttPassword))
-		mqttEnvVars = append(mqttEnvVars, "MQTT_BROKER="+fmt.Sprint(metadata.MqttBroker))
-		mqttEnvVars = append(mqttEnvVars, "MQTT_PORT="+fmt.Sprint(metadata.MqttPort))
-		mqttEnvVars = append(mqttEnvVars, "MQTT_TOPIC="+fmt.Sprint(metadata.MqttTopic))
+		mqttEnvVars = append(mqttEnvVars, "MQTT_USERNAME="+*metadata.MqttUsername)
+		mqttEnvVars = append(mqttEnvVars, "MQTT_PASSWORD="+deref(metadata.MqttPassword))
+		mqttEnvVars = append(mqttEnvVars, "MQTT_BROKER="+deref(metadata.MqttBroker))
+		mqttEnvVars = append(mqttEnvVars, "MQTT_PORT="+fmt.Sprint(deref(metadata.MqttPort)))
+		mqttEnvVars = append(mqttEnvVars, "MQTT_TOPIC="+deref(metadata.MqttTopic))
 	}
 
-	bitswanConfig := os.Getenv("HOME") + "/.config/bitswan/"
-	automationServerConfig := filepath.Join(bitswanConfig, "aoc", "automation_server.yaml")
 	var aocEnvVars []string
-	if _, err := os.Stat(automationServerConfig); !os.IsNotExist(err) {
-		// Read automation_server.yaml
-		yamlFile, err := os.ReadFile(automationServerConfig)
+	// Only workspaces registered with the AOC have a workspace ID
+	if _, err := host.Stat(automationServerYamlPath()); !os.IsNotExist(err) && metadata.WorkspaceId != nil {
+		automationConfig, err := readAutomationServerYaml()
 		if err != nil {
 			return fmt.Errorf("failed to read automation_server.yaml: %w", err)
 		}
 
-		var automationConfig AutomationServerYaml
-		if err := yaml.Unmarshal(yamlFile, &automationConfig); err != nil {
-			return fmt.Errorf("failed to unmarshal automation_server.yaml: %w", err)
-		}
-
 		fmt.Println("Getting automation server token...")
 
 		resp, err := sendRequest("GET", fmt.Sprintf("%s/api/automation-servers/token", automationConfig.AOCUrl), nil, automationConfig.AccessToken)
@@ -148,21 +214,88 @@ func updateGitops(workspaceName string, o *updateOptions) error {
 		aocEnvVars = append(aocEnvVars, "BITSWAN_AOC_TOKEN="+automationServerTokenResponse.Token)
 	}
 
-	// Rewrite the docker-compose file
+	// Enable or disable the editor when requested, otherwise keep the current setting
 	noIde := metadata.EditorURL == nil
-	compose, _, err := dockercompose.CreateDockerComposeFile(gitopsConfig, workspaceName, gitopsImage, bitswanEditorImage, metadata.Domain, noIde, mqttEnvVars, aocEnvVars)
+	editorToggled := o.noIde != nil && *o.noIde != noIde
+	if editorToggled {
+		noIde = *o.noIde
+		if err := toggleEditor(ws, metadata, noIde); err != nil {
+			return err
+		}
+	}
+
+	// Keep the resource limits of the workspace, unless they are changed
+	var limits dockercompose.Limits
+	if metadata.Limits != nil {
+		limits = *metadata.Limits
+	}
+	if o.setLimits != nil {
+		o.setLimits(&limits)
+		if err := limits.Validate(); err != nil {
+			return err
+		}
+		metadata.Limits = nil
+		if !limits.IsZero() {
+			metadata.Limits = &limits
+		}
+	}
+
+	env, err := envfile.Load(gitopsConfig)
 	if err != nil {
-		panic(fmt.Errorf("failed to create docker-compose file: %w", err))
+		return err
 	}
 
-	dockerComposeFilePath := filepath.Join(gitopsConfig, "deployment", "/docker-compose.yml")
-	if err := os.WriteFile(dockerComposeFilePath, []byte(compose), 0755); err != nil {
-		panic(fmt.Errorf("failed to write docker-compose file: %w", err))
+	// The gitops secret only changes with secret rotate, keep the one the services use
+	secret, err := getGitOpsSecret(workspaceName, filepath.Dir(gitopsConfig))
+	if err != nil && !errors.Is(err, errGitopsSecretNotFound) {
+		return fmt.Errorf("failed to read gitops secret: %w", err)
+	}
+
+	// Rewrite the docker-compose file
+	compose, token, err := dockercompose.CreateDockerComposeFile(gitopsConfig, workspaceName, gitopsImage, bitswanEditorImage, metadata.Domain, secret, noIde, mqttEnvVars, aocEnvVars, metadata.Labels, limits, env)
+	if err != nil {
+		return fmt.Errorf("failed to create docker-compose file: %w", err)
+	}
+
+	if err := dockercompose.RewriteWorktreeGitdir(gitopsConfig); err != nil {
+		return err
+	}
+
+	// The user's overlay has to fit the new file, docker compose merges them on up
+	if err := checkComposeOverride(ws.DeploymentDir(), []byte(compose)); err != nil {
+		return err
+	}
+
+	if err := recordInitialRevision(gitopsConfig); err != nil {
+		return err
+	}
+	written, err := writeComposeFiles(ws.DeploymentDir(), []byte(compose), workspace.WriteFile)
+	if err != nil {
+		return err
+	}
+	if err := recordRevision(gitopsConfig, written, "update"); err != nil {
+		return err
+	}
+
+	// Metadata of older versions may hold a secret the services no longer use
+	metadata.GitopsSecret = token
+	if err := ws.WriteMetadata(metadata); err != nil {
+		return err
+	}
+
+	// A stopped workspace stays down, start brings it up with the new files
+	stopped, err := readStoppedState(gitopsConfig)
+	if err != nil {
+		return err
+	}
+	if stopped != nil {
+		fmt.Println("Workspace is stopped, it runs the updated services once it is started.")
+		return nil
 	}
 
 	// 3. Restart gitops and editor services
 	fmt.Println("Restarting services...")
-	dockerComposePath := filepath.Join(gitopsConfig, "deployment")
+	dockerComposePath := ws.DeploymentDir()
 
 	projectName := workspaceName + "-site"
 	commands := [][]string{
@@ -171,8 +304,7 @@ func updateGitops(workspaceName string, o *updateOptions) error {
 	}
 
 	for _, args := range commands {
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Dir = dockerComposePath
+		cmd := host.Command(dockerComposePath, args[0], args[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
@@ -181,5 +313,117 @@ func updateGitops(workspaceName string, o *updateOptions) error {
 	}
 	fmt.Println("Services restarted!")
 
+	if editorToggled && !noIde {
+		err := withGlobalLock(func() error {
+			return caddyapi.RegisterServiceWithCaddy("editor", workspaceName, metadata.Domain, fmt.Sprintf("%s-editor:9999", workspaceName))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register Editor service with caddy: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// resolveImages returns the given images, or the latest ones of the release channel in place of empty images
+func resolveImages(channel, gitopsImage, editorImage string) (string, string, error) {
+	if gitopsImage != "" && editorImage != "" {
+		return gitopsImage, editorImage, nil
+	}
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	if gitopsImage == "" {
+		image, err := resolveImage(conf.Registry, "bitswan/gitops", channel)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get latest BitSwan GitOps version: %w", err)
+		}
+		gitopsImage = image
+	}
+
+	if editorImage == "" {
+		image, err := resolveImage(conf.Registry, "bitswan/bitswan-editor", channel)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get latest BitSwan Editor version: %w", err)
+		}
+		editorImage = image
+	}
+
+	return gitopsImage, editorImage, nil
+}
+
+// resolveImage returns the latest image of the Docker Hub repository in the channel,
+// looking it up in the configured registry mirror if there is one
+func resolveImage(reg config.Registry, repository, channel string) (string, error) {
+	resolver := dockerhub.NewResolver()
+
+	host, path := registry.Split(reg.Image(repository))
+	if host == "" {
+		return resolver.Resolve(path, channel)
+	}
+
+	password, err := reg.GetPassword()
+	if err != nil {
+		return "", err
+	}
+	resolver.Registry = registry.NewClient(host, reg.Username, password, reg.Insecure)
+	image, err := resolver.Resolve(path, channel)
+	if err != nil {
+		return "", err
+	}
+	return host + "/" + image, nil
+}
+
+// toggleEditor prepares the workspace for adding or removing the editor and stores the change in metadata
+func toggleEditor(ws *workspace.Store, metadata *config.Metadata, noIde bool) error {
+	gitopsConfig, workspaceName := ws.Dir, ws.Name
+	if noIde {
+		fmt.Println("Removing editor...")
+		err := withGlobalLock(func() error {
+			return caddyapi.UnregisterCaddyService("editor", workspaceName)
+		})
+		if err != nil {
+			return err
+		}
+		metadata.EditorURL = nil
+	} else {
+		fmt.Println("Adding editor...")
+		codeserverConfigDir := filepath.Join(gitopsConfig, "codeserver-config")
+		if err := host.MkdirAll(codeserverConfigDir, 0700); err != nil {
+			return fmt.Errorf("failed to create codeserver config directory: %w", err)
+		}
+		if metadata.EditorPassword == nil {
+			password := codeserver.GeneratePassword()
+			if err := writeEditorPassword(gitopsConfig, password); err != nil {
+				return err
+			}
+			metadata.EditorPassword = &password
+		}
+
+		if host.GOOS() == "linux" {
+			for _, dir := range []string{codeserverConfigDir, filepath.Join(gitopsConfig, "secrets"), filepath.Join(gitopsConfig, "workspace")} {
+				chownCom := host.Command("", "sudo", "chown", "-R", "1000:1000", dir)
+				if err := runCommandVerbose(chownCom, false); err != nil {
+					return fmt.Errorf("failed to change ownership of %s: %w", dir, err)
+				}
+			}
+		}
+
+		editorURL := fmt.Sprintf("https://%s-editor.%s", workspaceName, metadata.Domain)
+		metadata.EditorURL = &editorURL
+	}
+
+	return ws.WriteMetadata(metadata)
+}
+
+// deref returns the value of an optional metadata field, the zero value when it is not set
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
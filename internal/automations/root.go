@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
-	"github.com/bitswan-space/bitswan-workspaces/internal/ansi"
 	"github.com/bitswan-space/bitswan-workspaces/internal/httpReq"
 	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/output"
 )
 
 // WorkspaceMisbehavingError is a custom error type for when the workspace API returns 500 errors
@@ -25,27 +26,30 @@ func (e *WorkspaceMisbehavingError) Error() string {
 }
 
 type Automation struct {
-	ContainerID  string `json:"container_id"`
-	EndpointName string `json:"endpoint_name"`
-	CreatedAt    string `json:"created_at"`
-	Name         string `json:"name"`
-	State        string `json:"state"`
-	Status       string `json:"status"`
-	DeploymentID string `json:"deployment_id"`
-	Active       bool   `json:"active"`
-	Workspace    string `json:"workspace"`
+	ContainerID  string `json:"container_id" yaml:"container_id"`
+	EndpointName string `json:"endpoint_name" yaml:"endpoint_name"`
+	CreatedAt    string `json:"created_at" yaml:"created_at"`
+	Name         string `json:"name" yaml:"name"`
+	State        string `json:"state" yaml:"state"`
+	Status       string `json:"status" yaml:"status"`
+	DeploymentID string `json:"deployment_id" yaml:"deployment_id"`
+	Active       bool   `json:"active" yaml:"active"`
+	Workspace    string `json:"workspace" yaml:"workspace"`
 }
 
 // Remove sends a request to remove the automation associated with the Automation object
 func (a *Automation) Remove() error {
 	// Retrieve workspace metadata
-	metadata := config.GetWorkspaceMetadata(a.Workspace)
+	metadata, err := config.GetWorkspaceMetadata(a.Workspace)
+	if err != nil {
+		return err
+	}
 
 	// Construct the URL for stopping the automation
-	url := fmt.Sprintf("%s/automations/%s", metadata.GitOpsURL, a.DeploymentID)
+	url := fmt.Sprintf("%s/automations/%s", metadata.GitopsURL, a.DeploymentID)
 
 	// Send the request to stop the automation
-	resp, err := SendAutomationRequest("DELETE", url, metadata.GitOpsSecret)
+	resp, err := SendAutomationRequest("DELETE", url, metadata.GitopsSecret)
 	if err != nil {
 		return fmt.Errorf("failed to send request to remove automation: %w", err)
 	}
@@ -60,6 +64,37 @@ func (a *Automation) Remove() error {
 	return nil
 }
 
+// Stop sends a request to stop the automation associated with the Automation object
+func (a *Automation) Stop() error {
+	return a.post("stop")
+}
+
+// Start sends a request to start the automation associated with the Automation object
+func (a *Automation) Start() error {
+	return a.post("start")
+}
+
+func (a *Automation) post(action string) error {
+	metadata, err := config.GetWorkspaceMetadata(a.Workspace)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/automations/%s/%s", metadata.GitopsURL, a.DeploymentID, action)
+
+	resp, err := SendAutomationRequest("POST", url, metadata.GitopsSecret)
+	if err != nil {
+		return fmt.Errorf("failed to send request to %s automation: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to %s automation, status code: %d", action, resp.StatusCode)
+	}
+
+	return nil
+}
+
 func SendAutomationRequest(method, url string, workspaceSecret string) (*http.Response, error) {
 	// Create a new GET request
 	req, err := httpReq.NewRequest(method, url, nil)
@@ -78,14 +113,17 @@ func SendAutomationRequest(method, url string, workspaceSecret string) (*http.Re
 
 // GetAutomations fetches the list of automations for a given workspace
 func GetAutomations(workspaceName string) ([]Automation, error) {
-	metadata := config.GetWorkspaceMetadata(workspaceName)
+	metadata, err := config.GetWorkspaceMetadata(workspaceName)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("Fetching automations...")
+	fmt.Fprintln(os.Stderr, "Fetching automations...")
 
-	url := fmt.Sprintf("%s/automations", metadata.GitOpsURL)
+	url := fmt.Sprintf("%s/automations", metadata.GitopsURL)
 
 	// Send the request
-	resp, err := SendAutomationRequest("GET", url, metadata.GitOpsSecret)
+	resp, err := SendAutomationRequest("GET", url, metadata.GitopsSecret)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -130,7 +168,7 @@ func GetAutomations(workspaceName string) ([]Automation, error) {
 		automations[i].Workspace = workspaceName
 	}
 
-	fmt.Println("Automations fetched successfully.")
+	fmt.Fprintln(os.Stderr, "Automations fetched successfully.")
 	return automations, nil
 }
 
@@ -144,56 +182,30 @@ func parseTimestamp(timestamp string) string {
 	return t.Format("02 Jan 2006 15:04") // Format as "DD MMM YYYY HH:MM"
 }
 
+// Columns of the automations table
+var Columns = []output.Column[Automation]{
+	{Header: "NAME", Value: func(a Automation) string { return a.Name }},
+	{Header: "STATE", Value: func(a Automation) string { return a.State }},
+	{Header: "STATUS", Value: func(a Automation) string { return a.Status }},
+	{Header: "ACTIVE", Value: func(a Automation) string { return fmt.Sprint(a.Active) }},
+	{Header: "DEPLOYMENT ID", Value: func(a Automation) string { return a.DeploymentID }},
+	{Header: "CREATED AT", Value: func(a Automation) string { return parseTimestamp(a.CreatedAt) }},
+	{Header: "ENDPOINT", Wide: true, Value: func(a Automation) string { return a.EndpointName }},
+	{Header: "CONTAINER ID", Wide: true, Value: func(a Automation) string { return a.ContainerID }},
+}
+
+// GetListAutomations fetches the automations of the workspace and prints them as a table
 func GetListAutomations(workspaceName string) ([]Automation, error) {
 	automations, err := GetAutomations(workspaceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get automations for workspace %s: %w", workspaceName, err)
 	}
 
-	fmt.Println("Automations fetched successfully.")
 	fmt.Print("The following automations are running in this gitops:\n\n")
-	// Print table header
-	fmt.Printf("%s%-8s %-20s %-12s %-12s %-8s %-20s %-20s%s\n", ansi.Bold, "RUNNING", "NAME", "STATE", "STATUS", "ACTIVE", "DEPLOYMENT ID", "CREATED AT", ansi.Reset)
-	fmt.Println(ansi.Gray + "--------------------------------------------------------------------------------------------------------" + ansi.Reset)
-
-	if len(automations) == 0 {
-		fmt.Println(ansi.Gray + "No automations found." + ansi.Reset)
-		return nil, nil
-	}
-
-	// Print each automation
-	for _, a := range automations {
-		runningStatus := ansi.RedDot // Default to red (inactive)
-		if a.State == "running" {
-			runningStatus = ansi.GreenDot // Change to green if active
-		}
-
-		activeStatus := ansi.RedCheck // Default to red (inactive)
-		if a.Active {
-			activeStatus = ansi.GreenCheck // Change to green if active
-		}
-
-		// Format created_at properly
-		createdAtFormatted := parseTimestamp(a.CreatedAt)
-
-		name := a.Name
-		if len(name) > 20 {
-			name = name[:15] + "..."
-		}
-
-		deploymentId := a.DeploymentID
-		if len(a.DeploymentID) > 20 {
-			deploymentId = a.DeploymentID[:15] + "..."
-		}
-
-		// Print formatted row
-		fmt.Printf("%-16s %-20s %-12s %-12s %-16s %-20s %-20s\n",
-			runningStatus, name, a.State, a.Status, activeStatus, deploymentId, createdAtFormatted)
-		fmt.Println(ansi.Gray + "--------------------------------------------------------------------------------------------------------" + ansi.Reset)
+	if err := output.Write(os.Stdout, output.Table, automations, Columns); err != nil {
+		return nil, err
 	}
-
-	// Footer info
-	fmt.Println(ansi.Yellow + "✔ Running containers are marked with a green dot.\n" + ansi.Reset)
+	fmt.Println()
 
 	return automations, nil
 }
@@ -0,0 +1,320 @@
+package backup
+
+/*
+   This package reads and writes workspace backup archives. An archive is a tar
+   stream, optionally compressed, that starts with a manifest followed by the
+   workspace tree and its TLS certificates. Sensitive files can be moved into
+   a nested tar that is encrypted with a passphrase.
+*/
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestVersion = 1
+
+	ManifestName    = "manifest.json"
+	WorkspacePrefix = "workspace/"
+	CertsPrefix     = "certs/"
+	SecretsName     = "secrets.tar.enc"
+)
+
+type Manifest struct {
+	Version   int               `json:"version"`
+	Workspace string            `json:"workspace"`
+	Domain    string            `json:"domain"`
+	CreatedAt time.Time         `json:"created_at"`
+	Images    map[string]string `json:"images"`
+	// Paths on the machine the backup was taken on, used to rewrite absolute paths on restore
+	WorkspaceDir string `json:"workspace_dir"`
+	Home         string `json:"home"`
+	Encrypted    bool   `json:"encrypted"`
+}
+
+// IsSensitive reports whether a file of the workspace tree holds secrets and is
+// encrypted when the backup is protected with a passphrase
+func IsSensitive(name string) bool {
+	switch {
+	case name == WorkspacePrefix+"metadata.yaml",
+		name == WorkspacePrefix+"env.yaml",
+		name == WorkspacePrefix+"deployment/docker-compose.yml",
+		name == WorkspacePrefix+"deployment/gitops.secrets.env",
+		name == WorkspacePrefix+"deployment/editor.secrets.env",
+		// Revisions recorded before the secrets were moved to env files have them inline
+		path.Dir(name) == WorkspacePrefix+"deployment/history" && path.Ext(name) == ".yml",
+		// Older editors keep their password in plain text
+		name == WorkspacePrefix+"codeserver-config/config.yaml",
+		strings.HasPrefix(name, WorkspacePrefix+"secrets/"),
+		strings.HasPrefix(name, CertsPrefix) && path.Base(name) == "private-key.pem":
+		return true
+	}
+	return false
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+type cmdWriteCloser struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func (c *cmdWriteCloser) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *cmdWriteCloser) Close() error {
+	if err := c.stdin.Close(); err != nil {
+		return err
+	}
+	return c.cmd.Wait()
+}
+
+type cmdReadCloser struct {
+	stdout io.ReadCloser
+	cmd    *exec.Cmd
+}
+
+func (c *cmdReadCloser) Read(p []byte) (int, error) { return c.stdout.Read(p) }
+
+func (c *cmdReadCloser) Close() error {
+	c.stdout.Close()
+	return c.cmd.Wait()
+}
+
+// Compress wraps w in the compression matching the archive file name:
+// .tar.zst (through the zstd binary), .tar.gz / .tgz or plain .tar
+func Compress(w io.Writer, archivePath string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".tar.zst"):
+		cmd := exec.Command("zstd", "-q", "-c", "-")
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run zstd, is it installed? %w", err)
+		}
+		return &cmdWriteCloser{stdin: stdin, cmd: cmd}, nil
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(archivePath, ".tar"):
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format %s, use .tar.zst, .tar.gz or .tar", archivePath)
+}
+
+// Decompress is the counterpart of Compress
+func Decompress(r io.Reader, archivePath string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".tar.zst"):
+		cmd := exec.Command("zstd", "-q", "-d", "-c", "-")
+		cmd.Stdin = r
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run zstd, is it installed? %w", err)
+		}
+		return &cmdReadCloser{stdout: stdout, cmd: cmd}, nil
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(archivePath, ".tar"):
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unsupported archive format %s, use .tar.zst, .tar.gz or .tar", archivePath)
+}
+
+// WriteManifest adds the manifest to the archive, it has to be the first entry
+func WriteManifest(tw *tar.Writer, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return WriteFile(tw, ManifestName, data, 0644)
+}
+
+// ReadManifest reads the first entry of the archive, which must be the manifest
+func ReadManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if hdr.Name != ManifestName {
+		return nil, fmt.Errorf("not a workspace backup: expected %s, found %s", ManifestName, hdr.Name)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// WriteFile adds a regular file to the archive
+func WriteFile(tw *tar.Writer, name string, data []byte, mode os.FileMode) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteTree adds the directory tree at srcDir to the archive under prefix. choose
+// returns the writer every entry goes to, which allows splitting off sensitive files,
+// entries it returns nil for are left out.
+func WriteTree(srcDir, prefix string, choose func(name string) *tar.Writer) error {
+	return filepath.Walk(srcDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		// Ownership is set up again on restore
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		tw := choose(hdr.Name)
+		if tw == nil {
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+		return nil
+	})
+}
+
+// Extract writes a single archive entry to destDir, refusing entries that would
+// escape it, directly or through a symlink
+func Extract(hdr *tar.Header, r io.Reader, destDir string) error {
+	destDir = filepath.Clean(destDir)
+	rel := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+	target := filepath.Join(destDir, rel)
+	if rel == "" || !within(destDir, target) {
+		return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+	}
+
+	// Links are checked when they are extracted, this also refuses links that were
+	// already on disk
+	for dir := filepath.Dir(target); dir != destDir; dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path in archive: %s is below the symlink %s", hdr.Name, dir)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(hdr.Mode).Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode); err != nil {
+			return err
+		}
+		return os.Chmod(target, mode)
+	case tar.TypeSymlink:
+		if filepath.IsAbs(hdr.Linkname) || !within(destDir, filepath.Join(filepath.Dir(target), hdr.Linkname)) {
+			return fmt.Errorf("invalid symlink in archive: %s -> %s", hdr.Name, hdr.Linkname)
+		}
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	return fmt.Errorf("unsupported entry %s in archive", hdr.Name)
+}
+
+// within reports whether path is dir or below it, both are clean
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// ExtractAll extracts every entry of a (decrypted) nested archive, handing each
+// entry to extract
+func ExtractAll(data []byte, extract func(hdr *tar.Header, r io.Reader) error) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if err := extract(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
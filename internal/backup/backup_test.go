@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "secrets"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "metadata.yaml"), []byte("domain: demo.localhost\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "secrets", "token"), []byte("s3cret"), 0600))
+	require.NoError(t, os.Symlink("metadata.yaml", filepath.Join(src, "link")))
+
+	var archive bytes.Buffer
+	cw, err := Compress(&archive, "demo.tar.gz")
+	require.NoError(t, err)
+
+	tw := tar.NewWriter(cw)
+	require.NoError(t, WriteManifest(tw, Manifest{Version: ManifestVersion, Workspace: "demo"}))
+
+	var secrets bytes.Buffer
+	secretsTw := tar.NewWriter(&secrets)
+	require.NoError(t, WriteTree(src, WorkspacePrefix, func(name string) *tar.Writer {
+		if IsSensitive(name) {
+			return secretsTw
+		}
+		return tw
+	}))
+	require.NoError(t, secretsTw.Close())
+	require.NoError(t, tw.Close())
+	require.NoError(t, cw.Close())
+
+	r, err := Decompress(&archive, "demo.tar.gz")
+	require.NoError(t, err)
+	tr := tar.NewReader(r)
+
+	manifest, err := ReadManifest(tr)
+	require.NoError(t, err)
+	assert.Equal(t, "demo", manifest.Workspace)
+
+	dest := t.TempDir()
+	extract := func(hdr *tar.Header, r io.Reader) error {
+		entry := *hdr
+		entry.Name = strings.TrimPrefix(hdr.Name, WorkspacePrefix)
+		return Extract(&entry, r, dest)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.False(t, IsSensitive(hdr.Name), hdr.Name)
+		require.NoError(t, extract(hdr, tr))
+	}
+	require.NoError(t, ExtractAll(secrets.Bytes(), extract))
+
+	data, err := os.ReadFile(filepath.Join(dest, "secrets", "token"))
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(data))
+
+	info, err := os.Stat(filepath.Join(dest, "secrets"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dest, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "metadata.yaml", link)
+}
+
+func TestIsSensitive(t *testing.T) {
+	for _, name := range []string{
+		WorkspacePrefix + "metadata.yaml",
+		WorkspacePrefix + "deployment/gitops.secrets.env",
+		WorkspacePrefix + "deployment/history/3.yml",
+		WorkspacePrefix + "codeserver-config/config.yaml",
+		WorkspacePrefix + "secrets/token",
+		CertsPrefix + "demo.localhost/private-key.pem",
+	} {
+		assert.True(t, IsSensitive(name), name)
+	}
+	for _, name := range []string{
+		WorkspacePrefix + "deployment/history",
+		WorkspacePrefix + "workspace/history/3.yml",
+		WorkspacePrefix + "codeserver-config/settings.json",
+		CertsPrefix + "demo.localhost/full-chain.pem",
+	} {
+		assert.False(t, IsSensitive(name), name)
+	}
+}
+
+func TestExtractRejectsEscapingPaths(t *testing.T) {
+	dest := t.TempDir()
+	for _, name := range []string{"../evil", "a/../../evil", ""} {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644}
+		assert.Error(t, Extract(hdr, strings.NewReader(""), dest), name)
+	}
+}
+
+func TestExtractRejectsEscapingSymlinks(t *testing.T) {
+	dest := t.TempDir()
+	for name, link := range map[string]string{"abs": "/etc", "up": "../..", "deep": "a/../../../evil"} {
+		hdr := &tar.Header{Typeflag: tar.TypeSymlink, Name: "ws/" + name, Linkname: link}
+		assert.Error(t, Extract(hdr, nil, dest), name)
+	}
+
+	// Links within the destination are fine, but are not written through
+	require.NoError(t, Extract(&tar.Header{Typeflag: tar.TypeSymlink, Name: "ws/x", Linkname: ".."}, nil, dest))
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: "ws/x/evil", Mode: 0644}
+	assert.Error(t, Extract(hdr, strings.NewReader(""), dest))
+	_, err := os.Stat(filepath.Join(dest, "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadManifestRejectsOtherArchives(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	require.NoError(t, WriteFile(tw, "README.md", []byte("hello"), 0644))
+	require.NoError(t, tw.Close())
+
+	_, err := ReadManifest(tar.NewReader(&archive))
+	assert.Error(t, err)
+
+	_, err = Compress(io.Discard, "demo.zip")
+	assert.Error(t, err)
+}
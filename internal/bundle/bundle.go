@@ -0,0 +1,270 @@
+package bundle
+
+/*
+   This package reads and writes offline bundles for sites without internet
+   access. A bundle is a tar archive, compressed like workspace backups, that
+   holds a manifest, a snapshot of the BitSwan examples repository and the
+   `docker save` output of every image a workspace needs:
+
+     manifest.json
+     examples/...
+     images.tar
+
+   The images come last, so that the manifest and the examples can be read
+   without decompressing the whole bundle.
+*/
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/backup"
+)
+
+const (
+	ManifestVersion = 1
+
+	ManifestName   = "manifest.json"
+	ExamplesPrefix = "examples/"
+	ImagesName     = "images.tar"
+)
+
+type Manifest struct {
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	Channel     string    `json:"channel,omitempty"`
+	GitopsImage string    `json:"gitops_image"`
+	EditorImage string    `json:"editor_image"`
+	CaddyImage  string    `json:"caddy_image"`
+	// ExamplesCommit is the commit of the examples snapshot
+	ExamplesCommit string `json:"examples_commit,omitempty"`
+}
+
+// Images returns all images of the bundle
+func (m *Manifest) Images() []string {
+	return []string{m.GitopsImage, m.EditorImage, m.CaddyImage}
+}
+
+// Create writes a bundle with the examples repository at examplesDir and the images
+// of the manifest, which must be present in the local docker daemon
+func Create(output string, manifest Manifest, examplesDir string, verbose bool) error {
+	tmpDir, err := os.MkdirTemp("", "bitswan-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Println("Saving images...")
+	imagesPath := filepath.Join(tmpDir, ImagesName)
+	saveCmd := exec.Command("docker", append([]string{"save", "-o", imagesPath}, manifest.Images()...)...)
+	if err := run(saveCmd, verbose); err != nil {
+		return fmt.Errorf("failed to save images: %w", err)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	cw, err := backup.Compress(f, output)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := backup.WriteFile(tw, ManifestName, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Println("Archiving examples...")
+	if err := backup.WriteTree(examplesDir, ExamplesPrefix, func(string) *tar.Writer { return tw }); err != nil {
+		return fmt.Errorf("failed to archive examples: %w", err)
+	}
+
+	fmt.Println("Archiving images...")
+	if err := writeLargeFile(tw, ImagesName, imagesPath); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to compress bundle: %w", err)
+	}
+	return f.Close()
+}
+
+// writeLargeFile streams a file into the archive instead of reading it into memory
+func writeLargeFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     info.Size(),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+type Bundle struct {
+	Path     string
+	Manifest *Manifest
+}
+
+// Open reads the manifest of the bundle
+func Open(path string) (*Bundle, error) {
+	b := &Bundle{Path: path}
+	err := b.walk(func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Name != ManifestName {
+			return false, fmt.Errorf("not a BitSwan bundle: expected %s, found %s", ManifestName, hdr.Name)
+		}
+
+		var manifest Manifest
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			return false, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if manifest.Version != ManifestVersion {
+			return false, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+		}
+		b.Manifest = &manifest
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.Manifest == nil {
+		return nil, fmt.Errorf("not a BitSwan bundle: %s is empty", path)
+	}
+	return b, nil
+}
+
+// LoadImages loads the images of the bundle into the local docker daemon
+func (b *Bundle) LoadImages(verbose bool) error {
+	found := false
+	err := b.walk(func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Name != ImagesName {
+			return true, nil
+		}
+		found = true
+
+		loadCmd := exec.Command("docker", "load")
+		loadCmd.Stdin = r
+		if err := run(loadCmd, verbose); err != nil {
+			return false, fmt.Errorf("failed to load images: %w", err)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("bundle %s contains no images", b.Path)
+	}
+	return nil
+}
+
+// InstallExamples replaces the examples repository at targetDir with the snapshot of the bundle
+func (b *Bundle) InstallExamples(targetDir string) error {
+	stagingDir := targetDir + ".bundle"
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return fmt.Errorf("failed to create examples directory: %w", err)
+	}
+
+	err := b.walk(func(hdr *tar.Header, r io.Reader) (bool, error) {
+		switch {
+		case hdr.Name == ImagesName:
+			// Everything after the examples is images
+			return false, nil
+		case strings.HasPrefix(hdr.Name, ExamplesPrefix):
+			entry := *hdr
+			entry.Name = strings.TrimPrefix(hdr.Name, ExamplesPrefix)
+			return true, backup.Extract(&entry, r, stagingDir)
+		}
+		return true, nil
+	})
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to extract examples: %w", err)
+	}
+
+	if err := os.RemoveAll(targetDir); err != nil {
+		return fmt.Errorf("failed to remove old examples: %w", err)
+	}
+	return os.Rename(stagingDir, targetDir)
+}
+
+// walk hands the entries of the bundle to fn until it returns false
+func (b *Bundle) walk(fn func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	r, err := backup.Decompress(f, b.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		more, err := fn(hdr, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+func run(cmd *exec.Cmd, verbose bool) error {
+	if verbose {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package bundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/backup"
+)
+
+// writeBundle writes a bundle like Create does, with a fake image archive
+func writeBundle(t *testing.T, path string, manifest Manifest, examplesDir string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	cw, err := backup.Compress(f, path)
+	require.NoError(t, err)
+	tw := tar.NewWriter(cw)
+
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, backup.WriteFile(tw, ManifestName, data, 0644))
+	require.NoError(t, backup.WriteTree(examplesDir, ExamplesPrefix, func(string) *tar.Writer { return tw }))
+	require.NoError(t, backup.WriteFile(tw, ImagesName, []byte("not really images"), 0644))
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, cw.Close())
+}
+
+func TestOpenAndInstallExamples(t *testing.T) {
+	examples := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(examples, "Examples", "Kafka"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(examples, "Examples", "Kafka", "main.ipynb"), []byte("{}"), 0644))
+
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	writeBundle(t, path, Manifest{
+		Version:     ManifestVersion,
+		GitopsImage: "bitswan/gitops:2025-1-git-aaaaaaa",
+		EditorImage: "bitswan/bitswan-editor:2025-1-git-bbbbbbb",
+		CaddyImage:  "caddy:2.9",
+	}, examples)
+
+	b, err := Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bitswan/gitops:2025-1-git-aaaaaaa", "bitswan/bitswan-editor:2025-1-git-bbbbbbb", "caddy:2.9"}, b.Manifest.Images())
+
+	// Existing examples are replaced by the snapshot
+	target := filepath.Join(t.TempDir(), "bitswan-src")
+	require.NoError(t, os.MkdirAll(target, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(target, "stale"), []byte("old"), 0644))
+
+	require.NoError(t, b.InstallExamples(target))
+	data, err := os.ReadFile(filepath.Join(target, "Examples", "Kafka", "main.ipynb"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	assert.NoFileExists(t, filepath.Join(target, "stale"))
+	assert.NoDirExists(t, target+".bundle")
+}
+
+func TestOpenRejectsOtherArchives(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.tar")
+	writeBundle(t, path, Manifest{Version: ManifestVersion + 1}, t.TempDir())
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, "unsupported bundle version")
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.tar"))
+	assert.Error(t, err)
+}
@@ -50,8 +50,26 @@ type TLSFileLoad struct {
 	Tags        []string `json:"tags"`
 }
 
-func RegisterServiceWithCaddy(serviceName, workspaceName, domain, upstream string) error {
-	caddyAPIRoutesBaseUrl := "http://localhost:2019/config/apps/http/servers/srv0/routes/..."
+// AdminURL is the address of the Caddy admin API, it is published on another port
+// when the BitSwan home configures one
+var AdminURL = "http://localhost:2019"
+
+// Request is a single call to the Caddy admin API
+type Request struct {
+	Method  string
+	URL     string
+	Payload []byte
+}
+
+// Send performs the request against the Caddy admin API
+func Send(r Request) error {
+	_, err := sendRequest(r.Method, r.URL, r.Payload)
+	return err
+}
+
+// ServiceRouteRequest builds the request that adds a reverse proxy route for a workspace service
+func ServiceRouteRequest(serviceName, workspaceName, domain, upstream string) (Request, error) {
+	caddyAPIRoutesBaseUrl := AdminURL + "/config/apps/http/servers/srv0/routes/..."
 
 	// Create the route for the service
 	route := Route{
@@ -86,24 +104,37 @@ func RegisterServiceWithCaddy(serviceName, workspaceName, domain, upstream strin
 	// Marshal the route into JSON
 	jsonPayload, err := json.Marshal([]Route{route})
 	if err != nil {
-		return fmt.Errorf("failed to marshal route payload: %w", err)
+		return Request{}, fmt.Errorf("failed to marshal route payload: %w", err)
 	}
 
-	// Send the payload to the Caddy API
-	_, err = sendRequest("POST", caddyAPIRoutesBaseUrl, jsonPayload)
+	return Request{Method: "POST", URL: caddyAPIRoutesBaseUrl, Payload: jsonPayload}, nil
+}
+
+func RegisterServiceWithCaddy(serviceName, workspaceName, domain, upstream string) error {
+	req, err := ServiceRouteRequest(serviceName, workspaceName, domain, upstream)
 	if err != nil {
+		return err
+	}
+
+	// Send the payload to the Caddy API
+	if err := Send(req); err != nil {
 		return fmt.Errorf("failed to add %s route to Caddy: %w", serviceName, err)
 	}
 
 	return nil
 }
 
-func UnregisterCaddyService(serviceName, workspaceName string) error {
-	// Construct the URL for the specific service
-	url := fmt.Sprintf("http://localhost:2019/id/%s_%s", workspaceName, serviceName)
+// UnregisterRequest builds the request that deletes a workspace object by its ID
+func UnregisterRequest(serviceName, workspaceName string) Request {
+	return Request{
+		Method: "DELETE",
+		URL:    fmt.Sprintf("%s/id/%s_%s", AdminURL, workspaceName, serviceName),
+	}
+}
 
+func UnregisterCaddyService(serviceName, workspaceName string) error {
 	// Send a DELETE request to the Caddy API
-	if _, err := sendRequest("DELETE", url, nil); err != nil {
+	if err := Send(UnregisterRequest(serviceName, workspaceName)); err != nil {
 		return fmt.Errorf("failed to unregister Caddy service '%s': %w", serviceName, err)
 	}
 
@@ -111,9 +142,10 @@ func UnregisterCaddyService(serviceName, workspaceName string) error {
 	return nil
 }
 
-func InstallTLSCerts(workspaceName, domain string) error {
-	caddyAPITLSBaseUrl := "http://localhost:2019/config/apps/tls/certificates/load_files/..."
-	caddyAPITLSPoliciesBaseUrl := "http://localhost:2019/config/apps/http/servers/srv0/tls_connection_policies/..."
+// TLSCertsRequests builds the requests that load the workspace certificates and its TLS policy
+func TLSCertsRequests(workspaceName, domain string) ([]Request, error) {
+	caddyAPITLSBaseUrl := AdminURL + "/config/apps/tls/certificates/load_files/..."
+	caddyAPITLSPoliciesBaseUrl := AdminURL + "/config/apps/http/servers/srv0/tls_connection_policies/..."
 
 	// Define TLS policies and certificates
 	tlsPolicy := []TLSPolicy{
@@ -139,26 +171,33 @@ func InstallTLSCerts(workspaceName, domain string) error {
 		},
 	}
 
-	// Send TLS certificates to Caddy
-	jsonPayload, err := json.Marshal(tlsLoad)
+	certsPayload, err := json.Marshal(tlsLoad)
 	if err != nil {
-		return fmt.Errorf("failed to marshal TLS certificates payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal TLS certificates payload: %w", err)
 	}
 
-	_, err = sendRequest("POST", caddyAPITLSBaseUrl, jsonPayload)
+	policiesPayload, err := json.Marshal(tlsPolicy)
 	if err != nil {
-		return fmt.Errorf("failed to add TLS certificates to Caddy: %w", err)
+		return nil, fmt.Errorf("failed to marshal TLS policies payload: %w", err)
 	}
 
-	// Send TLS policies to Caddy
-	jsonPayload, err = json.Marshal(tlsPolicy)
+	return []Request{
+		{Method: "POST", URL: caddyAPITLSBaseUrl, Payload: certsPayload},
+		{Method: "POST", URL: caddyAPITLSPoliciesBaseUrl, Payload: policiesPayload},
+	}, nil
+}
+
+func InstallTLSCerts(workspaceName, domain string) error {
+	requests, err := TLSCertsRequests(workspaceName, domain)
 	if err != nil {
-		return fmt.Errorf("failed to marshal TLS policies payload: %w", err)
+		return err
 	}
 
-	_, err = sendRequest("POST", caddyAPITLSPoliciesBaseUrl, jsonPayload)
-	if err != nil {
-		return fmt.Errorf("failed to add TLS policies to Caddy: %w", err)
+	// Send TLS certificates and policies to Caddy
+	for _, req := range requests {
+		if err := Send(req); err != nil {
+			return fmt.Errorf("failed to add TLS certificates to Caddy: %w", err)
+		}
 	}
 
 	fmt.Println("TLS certificates and policies installed successfully!")
@@ -167,10 +206,10 @@ func InstallTLSCerts(workspaceName, domain string) error {
 
 func InitCaddy() error {
 	urls := []string{
-		"http://localhost:2019/config/apps/http/servers/srv0/routes",
-		"http://localhost:2019/config/apps/http/servers/srv0/listen",
-		"http://localhost:2019/config/apps/tls/certificates/load_files",
-		"http://localhost:2019/config/apps/http/servers/srv0/tls_connection_policies",
+		AdminURL + "/config/apps/http/servers/srv0/routes",
+		AdminURL + "/config/apps/http/servers/srv0/listen",
+		AdminURL + "/config/apps/tls/certificates/load_files",
+		AdminURL + "/config/apps/http/servers/srv0/tls_connection_policies",
 	}
 
 	for idx, url := range urls {
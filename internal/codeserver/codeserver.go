@@ -0,0 +1,84 @@
+package codeserver
+
+/*
+   This package manages the password of the editor, which is code-server. The
+   editor reads it from config.yaml in the codeserver-config directory of the
+   workspace, which is bind mounted into the container:
+
+     bind-addr: 127.0.0.1:8080
+     auth: password
+     hashed-password: 5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8
+     cert: false
+
+   Passwords set by bitswan are stored hashed, code-server treats a hash without
+   an $argon2 prefix as SHA-256. Workspaces created by older versions have the
+   plaintext password the editor generated on its first start.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/dchest/uniuri"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFile = "config.yaml"
+
+	// MinPasswordLength is the shortest password accepted from the user
+	MinPasswordLength = 8
+)
+
+// GeneratePassword generates a password of the same length code-server generates
+func GeneratePassword() string {
+	return uniuri.NewLen(24)
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("editor password must have at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+// HashPassword returns the hashed-password value code-server accepts for the password
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// Password returns the plaintext password of a config file, which is empty when
+// the password is only stored hashed
+func Password(config []byte) (string, error) {
+	var c struct {
+		Password string `yaml:"password"`
+	}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", ConfigFile, err)
+	}
+	return c.Password, nil
+}
+
+// SetPassword returns the config file with the password replaced by its hash, the
+// other settings of the existing config, which may be empty, are kept
+func SetPassword(config []byte, password string) ([]byte, error) {
+	c := map[string]interface{}{}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ConfigFile, err)
+	}
+	if c == nil {
+		c = map[string]interface{}{}
+	}
+
+	delete(c, "password")
+	c["auth"] = "password"
+	c["hashed-password"] = HashPassword(password)
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", ConfigFile, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,43 @@
+package codeserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSetPassword(t *testing.T) {
+	existing := []byte("bind-addr: 0.0.0.0:9999\nauth: password\npassword: generated\ncert: false\n")
+
+	password, err := Password(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "generated", password)
+
+	config, err := SetPassword(existing, "password")
+	require.NoError(t, err)
+
+	var c map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(config, &c))
+	assert.Equal(t, map[string]interface{}{
+		"bind-addr":       "0.0.0.0:9999",
+		"auth":            "password",
+		"hashed-password": "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+		"cert":            false,
+	}, c)
+
+	// The hash does not give the password away
+	password, err = Password(config)
+	require.NoError(t, err)
+	assert.Empty(t, password)
+
+	config, err = SetPassword(nil, "password")
+	require.NoError(t, err)
+	assert.Contains(t, string(config), "auth: password\n")
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.Error(t, ValidatePassword("short"))
+	assert.NoError(t, ValidatePassword(GeneratePassword()))
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetadataVersion is the schema version of metadata.yaml written by this version.
+// Files without schema_version were written before it was introduced and are
+// version 0.
+const MetadataVersion = 1
+
+// metadataMigrations upgrade the raw metadata, the migration at index i upgrades
+// version i to version i+1
+var metadataMigrations = []struct {
+	description string
+	apply       func(raw map[string]interface{})
+}{
+	{
+		description: "store mqtt_username as a string",
+		apply: func(raw map[string]interface{}) {
+			// The username is the workspace ID, older versions declared it a number
+			if username, ok := raw["mqtt_username"]; ok && username != nil {
+				raw["mqtt_username"] = fmt.Sprint(username)
+			}
+		},
+	},
+}
+
+// ParseMetadata parses the content of metadata.yaml and upgrades it to the current
+// schema. It returns the descriptions of the migrations that were applied.
+func ParseMetadata(data []byte) (*Metadata, []string, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal %s: %w", MetadataFile, err)
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	version := 0
+	if v, ok := raw["schema_version"]; ok {
+		if version, ok = v.(int); !ok {
+			return nil, nil, fmt.Errorf("invalid schema_version %v in %s", v, MetadataFile)
+		}
+	}
+	if version > MetadataVersion {
+		return nil, nil, fmt.Errorf("%s has schema version %d, this version of bitswan only supports up to %d, please upgrade bitswan", MetadataFile, version, MetadataVersion)
+	}
+
+	var applied []string
+	for ; version < MetadataVersion; version++ {
+		migration := metadataMigrations[version]
+		migration.apply(raw)
+		applied = append(applied, fmt.Sprintf("%d -> %d: %s", version, version+1, migration.description))
+	}
+	raw["schema_version"] = version
+
+	upgraded, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	var metadata Metadata
+	if err := yaml.Unmarshal(upgraded, &metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal %s: %w", MetadataFile, err)
+	}
+	return &metadata, applied, nil
+}
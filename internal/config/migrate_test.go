@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/secrets"
+)
+
+func TestParseMetadata(t *testing.T) {
+	// Written before schema_version, mqtt_username was a number
+	metadata, applied, err := ParseMetadata([]byte("domain: example.com\ngitops-url: https://alpha-gitops.example.com\nmqtt_username: 1234\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0 -> 1: store mqtt_username as a string"}, applied)
+	assert.Equal(t, MetadataVersion, metadata.SchemaVersion)
+	assert.Equal(t, "example.com", metadata.Domain)
+	require.NotNil(t, metadata.MqttUsername)
+	assert.Equal(t, "1234", *metadata.MqttUsername)
+
+	data, err := metadata.Marshal()
+	require.NoError(t, err)
+	metadata, applied, err = ParseMetadata(data)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, "1234", *metadata.MqttUsername)
+
+	_, _, err = ParseMetadata([]byte("schema_version: 99\ndomain: example.com\n"))
+	assert.ErrorContains(t, err, "please upgrade bitswan")
+}
+
+func TestMetadataSecrets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(secrets.BackendEnv, secrets.File)
+
+	password := "mqtt-password"
+	metadata := Metadata{Domain: "example.com", GitopsSecret: "gitops-secret", MqttPassword: &password}
+
+	encrypted, err := metadata.Encrypted()
+	require.NoError(t, err)
+	assert.True(t, secrets.IsEncrypted(encrypted.GitopsSecret))
+	assert.True(t, secrets.IsEncrypted(*encrypted.MqttPassword))
+	// The original keeps its plaintext values
+	assert.Equal(t, "gitops-secret", metadata.GitopsSecret)
+	assert.Equal(t, "mqtt-password", password)
+
+	dir := t.TempDir()
+	require.NoError(t, WriteMetadata(dir, &metadata))
+	read, err := ReadMetadata(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "gitops-secret", read.GitopsSecret)
+	assert.Equal(t, "mqtt-password", *read.MqttPassword)
+
+	sealed, err := ReadMetadataSealed(dir)
+	require.NoError(t, err)
+	assert.True(t, secrets.IsEncrypted(sealed.GitopsSecret))
+}
+
+func TestGetWorkspaceMetadataWithoutKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(secrets.BackendEnv, secrets.Passphrase)
+	t.Setenv(secrets.PassphraseEnv, "passphrase")
+
+	metadata := Metadata{Domain: "example.com", GitopsSecret: "gitops-secret"}
+	require.NoError(t, os.MkdirAll(WorkspaceDir("alpha"), 0755))
+	require.NoError(t, WriteMetadata(WorkspaceDir("alpha"), &metadata))
+
+	read, err := GetWorkspaceMetadata("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "gitops-secret", read.GitopsSecret)
+
+	// Without the passphrase the secrets cannot be decrypted
+	data, err := os.ReadFile(filepath.Join(WorkspaceDir("alpha"), "metadata.yaml"))
+	require.NoError(t, err)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(secrets.PassphraseEnv, "")
+	require.NoError(t, os.MkdirAll(WorkspaceDir("alpha"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(WorkspaceDir("alpha"), "metadata.yaml"), data, 0600))
+	_, err = GetWorkspaceMetadata("alpha")
+	assert.ErrorContains(t, err, "alpha")
+}
@@ -1,20 +1,134 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"path/filepath"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
 )
 
 type Config struct {
-	ActiveWorkspace string `toml:"active_workspace"`
+	ActiveWorkspace string   `toml:"active_workspace"`
+	Registry        Registry `toml:"registry,omitempty"`
+	Caddy           Caddy    `toml:"caddy,omitempty"`
+	// CurrentContext is the context commands run in when --context is not given
+	CurrentContext string             `toml:"current_context,omitempty"`
+	Contexts       map[string]Context `toml:"contexts,omitempty"`
+}
+
+// DefaultContext is the name of the local machine as a context
+const DefaultContext = "default"
+
+// Context is a remote host whose workspaces are managed over SSH, e.g.
+//
+//	[contexts.prod]
+//	url = "ssh://ops@vm1.example.com"
+//	home = "/srv/bitswan"
+type Context struct {
+	URL string `toml:"url"`
+	// Home is the BitSwan home on the host, the default home of the SSH user when empty
+	Home string `toml:"home,omitempty"`
+}
+
+// Caddy configures the host ports of the shared Caddy, so that the Caddies of several
+// BitSwan homes can run on one machine, e.g.
+//
+//	[caddy]
+//	http_port = 8080
+//	https_port = 8443
+//	admin_port = 2020
+type Caddy struct {
+	HTTPPort  int `toml:"http_port,omitempty"`
+	HTTPSPort int `toml:"https_port,omitempty"`
+	AdminPort int `toml:"admin_port,omitempty"`
+}
+
+// Ports returns the host ports, 80, 443 and 2019 unless configured otherwise
+func (c Caddy) Ports() dockercompose.CaddyPorts {
+	ports := dockercompose.CaddyPorts{HTTP: 80, HTTPS: 443, Admin: 2019}
+	if c.HTTPPort != 0 {
+		ports.HTTP = c.HTTPPort
+	}
+	if c.HTTPSPort != 0 {
+		ports.HTTPS = c.HTTPSPort
+	}
+	if c.AdminPort != 0 {
+		ports.Admin = c.AdminPort
+	}
+	return ports
+}
+
+// Registry configures where workspace images are pulled from, e.g.
+//
+//	[registry]
+//	prefix = "registry.example.com/dockerhub"
+//	username = "bitswan"
+//	password_file = "/etc/bitswan/registry-password"
+//
+//	[registry.mirrors]
+//	"bitswan/gitops" = "registry.example.com/bitswan/gitops"
+type Registry struct {
+	// Prefix is put in front of Docker Hub repositories, e.g. a pull-through mirror
+	Prefix string `toml:"prefix,omitempty"`
+	// Mirrors maps Docker Hub repositories to the repositories to pull them from,
+	// they take precedence over the prefix
+	Mirrors  map[string]string `toml:"mirrors,omitempty"`
+	Username string            `toml:"username,omitempty"`
+	// Password is read from PasswordFile or the BITSWAN_REGISTRY_PASSWORD environment variable when empty
+	Password     string `toml:"password,omitempty"`
+	PasswordFile string `toml:"password_file,omitempty"`
+	// Insecure talks to the registry over plain HTTP
+	Insecure bool `toml:"insecure,omitempty"`
+}
+
+// RegistryPasswordEnv holds the registry password, so that it does not have to be stored in config.toml
+const RegistryPasswordEnv = "BITSWAN_REGISTRY_PASSWORD"
+
+// Image returns where to pull a Docker Hub image such as bitswan/gitops or caddy:2.9 from
+func (r Registry) Image(image string) string {
+	repository, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, tag = image[:i], image[i:]
+	}
+
+	if mirror, ok := r.Mirrors[repository]; ok {
+		return mirror + tag
+	}
+	if r.Prefix == "" {
+		return image
+	}
+	// Official images live in the library namespace on Docker Hub
+	if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return strings.TrimSuffix(r.Prefix, "/") + "/" + repository + tag
 }
 
-// ConfigPath returns the hardcoded path to the configuration file.
+// GetPassword returns the registry password from the config, the password file or the environment
+func (r Registry) GetPassword() (string, error) {
+	if r.Password != "" {
+		return r.Password, nil
+	}
+	if r.PasswordFile != "" {
+		data, err := os.ReadFile(r.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read registry password file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return os.Getenv(RegistryPasswordEnv), nil
+}
+
+// ConfigPath returns the path to the configuration file in the BitSwan home.
 func ConfigPath() string {
-	return filepath.Join(os.Getenv("HOME"), ".config", "bitswan", "config.toml")
+	return home.Path("config.toml")
 }
 
 // GetConfig reads the configuration file and returns a Config object.
@@ -23,19 +137,18 @@ func GetConfig() (*Config, error) {
 	var config Config
 
 	// Check if the config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	if _, err := host.Stat(configPath); os.IsNotExist(err) {
 		// Return an empty Config if the file doesn't exist
 		return &Config{}, nil
 	}
 
-	// Open and decode the config file
-	file, err := os.Open(configPath)
+	// Read and decode the config file
+	data, err := host.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
-	defer file.Close()
 
-	if _, err := toml.NewDecoder(file).Decode(&config); err != nil {
+	if _, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to decode config file: %w", err)
 	}
 
@@ -47,19 +160,17 @@ func (c *Config) Save() error {
 	configPath := ConfigPath()
 
 	// Ensure the directory exists
-	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+	if err := host.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Write the configuration to the file
-	file, err := os.Create(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to open config file for writing: %w", err)
+	// Write the configuration in one go, so that concurrent commands never read a truncated file
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
 	}
-	defer file.Close()
-
-	if err := toml.NewEncoder(file).Encode(c); err != nil {
-		return fmt.Errorf("failed to write to config file: %w", err)
+	if err := host.WriteFile(configPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
 	return nil
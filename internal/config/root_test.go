@@ -0,0 +1,21 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryImage(t *testing.T) {
+	assert.Equal(t, "bitswan/gitops", Registry{}.Image("bitswan/gitops"))
+	assert.Equal(t, "caddy:2.9", Registry{}.Image("caddy:2.9"))
+
+	reg := Registry{
+		Prefix:  "registry.example.com/dockerhub/",
+		Mirrors: map[string]string{"bitswan/bitswan-editor": "registry.example.com/bitswan/editor"},
+	}
+	assert.Equal(t, "registry.example.com/dockerhub/bitswan/gitops", reg.Image("bitswan/gitops"))
+	assert.Equal(t, "registry.example.com/dockerhub/library/caddy:2.9", reg.Image("caddy:2.9"))
+	assert.Equal(t, "registry.example.com/bitswan/editor", reg.Image("bitswan/bitswan-editor"))
+	assert.Equal(t, "registry.example.com/bitswan/editor:2025-1-git-aaaaaaa", reg.Image("bitswan/bitswan-editor:2025-1-git-aaaaaaa"))
+}
@@ -1,30 +1,149 @@
 package config
 
 import (
-	"gopkg.in/yaml.v2"
-	"os"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/dockercompose"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secrets"
 )
 
+// MetadataFile is the name of the metadata file in the workspace directory
+const MetadataFile = "metadata.yaml"
+
+// Metadata is the content of metadata.yaml. Files written by older versions are
+// upgraded to MetadataVersion when they are read, see migrate.go.
 type Metadata struct {
-	Domain       string `yaml:"domain"`
-	EditorURL    string `yaml:"editor-url"`
-	GitOpsURL    string `yaml:"gitops-url"`
-	GitOpsSecret string `yaml:"gitops-secret"`
+	SchemaVersion int     `yaml:"schema_version"`
+	Domain        string  `yaml:"domain"`
+	EditorURL     *string `yaml:"editor-url,omitempty"`
+	GitopsURL     string  `yaml:"gitops-url"`
+	GitopsSecret  string  `yaml:"gitops-secret"`
+	Channel       string  `yaml:"channel,omitempty"`
+	// Labels group workspaces, e.g. by team or environment
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Limits are kept so that update regenerates the services with the same limits
+	Limits      *dockercompose.Limits `yaml:"limits,omitempty"`
+	WorkspaceId *string               `yaml:"workspace_id,omitempty"`
+	// MqttUsername is the workspace ID the AOC issued the MQTT credentials for
+	MqttUsername *string `yaml:"mqtt_username,omitempty"`
+	MqttPassword *string `yaml:"mqtt_password,omitempty"`
+	MqttBroker   *string `yaml:"mqtt_broker,omitempty"`
+	MqttPort     *int    `yaml:"mqtt_port,omitempty"`
+	MqttTopic    *string `yaml:"mqtt_topic,omitempty"`
+	// EditorPassword is kept so that the password can be shown while the editor is down
+	EditorPassword *string `yaml:"editor-password,omitempty"`
+}
+
+// WorkspaceDir returns the directory of a workspace
+func WorkspaceDir(workspaceName string) string {
+	return filepath.Join(home.WorkspacesDir(), workspaceName)
 }
 
-func GetWorkspaceMetadata(workspaceName string) Metadata {
-	metadataPath := os.Getenv("HOME") + "/.config/bitswan/" + "workspaces/" + workspaceName + "/metadata.yaml"
+// GetWorkspaceMetadata returns the metadata of a workspace
+func GetWorkspaceMetadata(workspaceName string) (Metadata, error) {
+	metadata, err := ReadMetadata(WorkspaceDir(workspaceName))
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to read metadata of workspace %s: %w", workspaceName, err)
+	}
+	return *metadata, nil
+}
 
-	data, err := os.ReadFile(metadataPath)
+// ReadMetadata reads metadata.yaml of the workspace directory, upgraded to the
+// current schema and with its secrets decrypted
+func ReadMetadata(workspaceDir string) (*Metadata, error) {
+	metadata, err := ReadMetadataSealed(workspaceDir)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	if err := metadata.Decrypt(); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
 
-	var metadata Metadata
-	err = yaml.Unmarshal(data, &metadata)
+// ReadMetadataSealed is ReadMetadata for callers that do not need the secrets, they
+// are left encrypted so that no access to the secrets key is needed
+func ReadMetadataSealed(workspaceDir string) (*Metadata, error) {
+	data, err := host.ReadFile(filepath.Join(workspaceDir, MetadataFile))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to read %s: %w", MetadataFile, err)
 	}
+	metadata, _, err := ParseMetadata(data)
+	return metadata, err
+}
 
-	return metadata
+// WriteMetadata writes metadata.yaml of the workspace directory with its secrets encrypted
+func WriteMetadata(workspaceDir string, metadata *Metadata) error {
+	encrypted, err := metadata.Encrypted()
+	if err != nil {
+		return err
+	}
+	data, err := encrypted.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := host.WriteFile(filepath.Join(workspaceDir, MetadataFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+	return nil
+}
+
+// Marshal encodes the metadata in the current schema
+func (m Metadata) Marshal() ([]byte, error) {
+	m.SchemaVersion = MetadataVersion
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return data, nil
+}
+
+// Encrypted returns a copy of the metadata with its secrets encrypted
+func (m Metadata) Encrypted() (Metadata, error) {
+	var err error
+	if m.GitopsSecret, err = secrets.Encrypt(m.GitopsSecret); err != nil {
+		return m, fmt.Errorf("failed to encrypt gitops secret: %w", err)
+	}
+	for name, value := range m.optionalSecrets() {
+		if *value == nil {
+			continue
+		}
+		encrypted, err := secrets.Encrypt(**value)
+		if err != nil {
+			return m, fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+		*value = &encrypted
+	}
+	return m, nil
+}
+
+// Decrypt decrypts the secrets of metadata read from metadata.yaml
+func (m *Metadata) Decrypt() error {
+	var err error
+	if m.GitopsSecret, err = secrets.Decrypt(m.GitopsSecret); err != nil {
+		return fmt.Errorf("failed to decrypt gitops secret: %w", err)
+	}
+	for name, value := range m.optionalSecrets() {
+		if *value == nil {
+			continue
+		}
+		decrypted, err := secrets.Decrypt(**value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		*value = &decrypted
+	}
+	return nil
+}
+
+func (m *Metadata) optionalSecrets() map[string]**string {
+	return map[string]**string{
+		"MQTT password":   &m.MqttPassword,
+		"editor password": &m.EditorPassword,
+	}
 }
@@ -5,15 +5,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 
-	"github.com/dchest/uniuri"
 	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/envfile"
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/labels"
 )
 
 type OS int
@@ -23,11 +25,49 @@ const (
 	Linux
 )
 
-func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEditorImage, domain string, noIde bool, mqttEnvVars []string, aocEnvVars []string) (string, string, error) {
-	sshDir := os.Getenv("HOME") + "/.ssh"
-	gitConfig := os.Getenv("HOME") + "/.gitconfig"
+// WorkspaceLabel is the docker label holding the workspace name on every service
+const WorkspaceLabel = "space.bitswan.workspace"
+
+// ServiceLabels returns the docker labels of the services of a workspace
+func ServiceLabels(workspaceName string, workspaceLabels map[string]string) map[string]string {
+	serviceLabels := labels.Docker(workspaceLabels)
+	serviceLabels[WorkspaceLabel] = workspaceName
+	return serviceLabels
+}
+
+// SetLabels replaces the docker labels of all services in the docker-compose file
+func SetLabels(compose []byte, workspaceName string, workspaceLabels map[string]string) ([]byte, error) {
+	var dockerCompose map[string]interface{}
+	if err := yaml.Unmarshal(compose, &dockerCompose); err != nil {
+		return nil, fmt.Errorf("failed to parse docker-compose file: %w", err)
+	}
 
-	hostOsTmp := runtime.GOOS
+	services, ok := dockerCompose["services"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("services section not found in docker-compose file")
+	}
+	for _, service := range services {
+		if service, ok := service.(map[string]interface{}); ok {
+			service["labels"] = ServiceLabels(workspaceName, workspaceLabels)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(dockerCompose); err != nil {
+		return nil, fmt.Errorf("failed to encode docker-compose data structure: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// CreateDockerComposeFile generates the docker-compose file of a workspace and returns
+// it with the gitops secret, a new one is generated when gitopsSecret is empty
+func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEditorImage, domain, gitopsSecret string, noIde bool, mqttEnvVars []string, aocEnvVars []string, workspaceLabels map[string]string, limits Limits, env envfile.Env) (string, string, error) {
+	sshDir := host.UserHomeDir() + "/.ssh"
+	gitConfig := host.UserHomeDir() + "/.gitconfig"
+
+	hostOsTmp := host.GOOS()
 
 	var hostOs OS
 	switch hostOsTmp {
@@ -40,13 +80,18 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 	}
 
 	// generate a random secret token
-	gitopsSecretToken := uniuri.NewLen(64)
+	gitopsSecretToken := gitopsSecret
+	if gitopsSecretToken == "" {
+		gitopsSecretToken = NewGitopsSecret()
+	}
+	network := home.NetworkName()
 
 	gitopsService := map[string]interface{}{
 		"image":    gitopsImage,
 		"restart":  "always",
 		"hostname": workspaceName + "-gitops",
-		"networks": []string{"bitswan_network"},
+		"networks": []string{network},
+		"labels":   ServiceLabels(workspaceName, workspaceLabels),
 		"volumes": []string{
 			gitopsPath + "/gitops:/gitops/gitops:z",
 			gitopsPath + "/secrets:/gitops/secrets:z",
@@ -72,6 +117,9 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 		gitopsService["environment"] = append(gitopsService["environment"].([]string), mqttEnvVars...)
 	}
 
+	gitopsService["environment"] = append(gitopsService["environment"].([]string), limits.Automations.automationEnv()...)
+	limits.Gitops.apply(gitopsService)
+
 	if hostOs == WindowsMac {
 		gitopsVolumes := []string{
 			gitConfig + ":/root/.gitconfig:z",
@@ -79,12 +127,6 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 		}
 
 		gitopsService["volumes"] = append(gitopsService["volumes"].([]string), gitopsVolumes...)
-
-		// Rewrite .git in worktree because it's calling git command inside the container (only for Windows and Mac)
-		gitdir := "gitdir: /workspace-repo/.git/worktrees/gitops"
-		if err := os.WriteFile(gitopsPath+"/gitops/.git", []byte(gitdir), 0644); err != nil {
-			return "", "", fmt.Errorf("failed to rewrite gitops worktree .git file: %w", err)
-		}
 	} else if hostOs == Linux {
 		gitopsService["privileged"] = true
 		gitopsService["pid"] = "host"
@@ -97,6 +139,12 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 		gitopsService["environment"] = append(gitopsService["environment"].([]string), gitopsEnvVars...)
 	}
 
+	gitopsEnvironment, err := addEnvironment(gitopsService["environment"].([]string), env.Environment(envfile.Gitops))
+	if err != nil {
+		return "", "", err
+	}
+	gitopsService["environment"] = gitopsEnvironment
+
 	// Construct the docker-compose data structure
 	dockerCompose := map[string]interface{}{
 		"version": "3.8",
@@ -104,7 +152,7 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 			"bitswan-gitops": gitopsService,
 		},
 		"networks": map[string]interface{}{
-			"bitswan_network": map[string]interface{}{
+			network: map[string]interface{}{
 				"external": true,
 			},
 		},
@@ -115,7 +163,8 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 			"image":    bitswanEditorImage,
 			"restart":  "always",
 			"hostname": workspaceName + "-editor",
-			"networks": []string{"bitswan_network"},
+			"networks": []string{network},
+			"labels":   ServiceLabels(workspaceName, workspaceLabels),
 			"environment": []string{
 				"BITSWAN_DEPLOY_URL=" + fmt.Sprintf("http://%s-gitops:8079", workspaceName),
 				"BITSWAN_DEPLOY_SECRET=" + gitopsSecretToken,
@@ -130,6 +179,14 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 			},
 		}
 
+		limits.Editor.apply(bitswanEditor)
+
+		editorEnvironment, err := addEnvironment(bitswanEditor["environment"].([]string), env.Environment(envfile.Editor))
+		if err != nil {
+			return "", "", err
+		}
+		bitswanEditor["environment"] = editorEnvironment
+
 		dockerCompose["services"].(map[string]interface{})["bitswan-editor"] = bitswanEditor
 		dockerCompose["volumes"] = map[string]interface{}{
 			"bitswan-editor-data": nil,
@@ -148,7 +205,35 @@ func CreateDockerComposeFile(gitopsPath, workspaceName, gitopsImage, bitswanEdit
 	return buf.String(), gitopsSecretToken, nil
 }
 
-func CreateCaddyDockerComposeFile(caddyPath, domain string) (string, error) {
+// RewriteWorktreeGitdir points the gitops worktree at the repository mounted
+// into the gitops container. Only needed on Windows and Mac, where git is
+// called inside the container.
+func RewriteWorktreeGitdir(gitopsPath string) error {
+	if host.GOOS() == "linux" {
+		return nil
+	}
+
+	gitdir := "gitdir: /workspace-repo/.git/worktrees/gitops"
+	if err := host.WriteFile(gitopsPath+"/gitops/.git", []byte(gitdir), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite gitops worktree .git file: %w", err)
+	}
+
+	return nil
+}
+
+// CaddyImage is the image of the shared Caddy
+const CaddyImage = "caddy:2.9"
+
+// CaddyPorts are the host ports the shared Caddy is published on
+type CaddyPorts struct {
+	HTTP  int
+	HTTPS int
+	Admin int
+}
+
+func CreateCaddyDockerComposeFile(caddyPath, domain, caddyImage string, ports CaddyPorts) (string, error) {
+	network := home.NetworkName()
+
 	caddyVolumes := []string{
 		caddyPath + "/Caddyfile:/etc/caddy/Caddyfile:z",
 		caddyPath + "/data:/data:z",
@@ -161,17 +246,21 @@ func CreateCaddyDockerComposeFile(caddyPath, domain string) (string, error) {
 		"version": "3.8",
 		"services": map[string]interface{}{
 			"caddy": map[string]interface{}{
-				"image":          "caddy:2.9",
+				"image":          caddyImage,
 				"restart":        "always",
-				"container_name": "caddy",
-				"ports":          []string{"80:80", "443:443", "2019:2019"},
-				"networks":       []string{"bitswan_network"},
-				"volumes":        caddyVolumes,
-				"entrypoint":     []string{"caddy", "run", "--resume", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"},
+				"container_name": home.CaddyContainer(),
+				"ports": []string{
+					fmt.Sprintf("%d:80", ports.HTTP),
+					fmt.Sprintf("%d:443", ports.HTTPS),
+					fmt.Sprintf("%d:2019", ports.Admin),
+				},
+				"networks":   []string{network},
+				"volumes":    caddyVolumes,
+				"entrypoint": []string{"caddy", "run", "--resume", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"},
 			},
 		},
 		"networks": map[string]interface{}{
-			"bitswan_network": map[string]interface{}{
+			network: map[string]interface{}{
 				"external": true,
 			},
 		},
@@ -0,0 +1,70 @@
+package dockercompose
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceName returns the docker-compose service of an envfile service, e.g. bitswan-gitops
+func ServiceName(service string) string {
+	return "bitswan-" + service
+}
+
+// addEnvironment appends the user defined variables to the environment of a service,
+// they may not replace the variables bitswan sets
+func addEnvironment(environment []string, vars []string) ([]string, error) {
+	generated := map[string]bool{}
+	for _, v := range environment {
+		key, _, _ := strings.Cut(v, "=")
+		generated[key] = true
+	}
+
+	for _, v := range vars {
+		key, _, _ := strings.Cut(v, "=")
+		if generated[key] {
+			return nil, fmt.Errorf("variable %s is set by bitswan and cannot be overridden", key)
+		}
+		environment = append(environment, v)
+	}
+	return environment, nil
+}
+
+// SetEnvironment replaces the user defined variables of a service in the docker-compose
+// file, previous are the variables that were set before
+func SetEnvironment(compose []byte, service string, previous, vars []string) ([]byte, error) {
+	var dockerCompose map[string]interface{}
+	if err := yaml.Unmarshal(compose, &dockerCompose); err != nil {
+		return nil, fmt.Errorf("failed to parse docker-compose file: %w", err)
+	}
+
+	services, _ := dockerCompose["services"].(map[string]interface{})
+	composeService, ok := services[ServiceName(service)].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("service %s not found in docker-compose file", ServiceName(service))
+	}
+
+	previousKeys := map[string]bool{}
+	for _, v := range previous {
+		key, _, _ := strings.Cut(v, "=")
+		previousKeys[key] = true
+	}
+
+	var environment []string
+	existing, _ := composeService["environment"].([]interface{})
+	for _, v := range existing {
+		key, _, _ := strings.Cut(fmt.Sprint(v), "=")
+		if !previousKeys[key] {
+			environment = append(environment, fmt.Sprint(v))
+		}
+	}
+
+	environment, err := addEnvironment(environment, vars)
+	if err != nil {
+		return nil, err
+	}
+	composeService["environment"] = environment
+
+	return Encode(dockerCompose)
+}
@@ -0,0 +1,47 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/envfile"
+)
+
+func serviceEnvironment(t *testing.T, compose []byte, service string) []interface{} {
+	var parsed struct {
+		Services map[string]map[string]interface{} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal(compose, &parsed))
+	environment, _ := parsed.Services[service]["environment"].([]interface{})
+	return environment
+}
+
+func TestEnvironment(t *testing.T) {
+	env := envfile.Env{}
+	env.Set(envfile.Gitops, map[string]string{"HTTP_PROXY": "http://proxy:3128"})
+	env.Set(envfile.Editor, map[string]string{"TZ": "UTC"})
+
+	compose, _, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", false, nil, nil, nil, Limits{}, env)
+	require.NoError(t, err)
+	assert.Contains(t, serviceEnvironment(t, []byte(compose), "bitswan-gitops"), "HTTP_PROXY=http://proxy:3128")
+	assert.Contains(t, serviceEnvironment(t, []byte(compose), "bitswan-editor"), "TZ=UTC")
+
+	updated, err := SetEnvironment([]byte(compose), envfile.Gitops, []string{"HTTP_PROXY=http://proxy:3128"}, []string{"NO_PROXY=localhost"})
+	require.NoError(t, err)
+	gitopsEnvironment := serviceEnvironment(t, updated, "bitswan-gitops")
+	assert.NotContains(t, gitopsEnvironment, "HTTP_PROXY=http://proxy:3128")
+	assert.Contains(t, gitopsEnvironment, "NO_PROXY=localhost")
+	assert.Contains(t, gitopsEnvironment, "BITSWAN_WORKSPACE_NAME=alpha")
+	assert.Contains(t, serviceEnvironment(t, updated, "bitswan-editor"), "TZ=UTC")
+
+	_, err = SetEnvironment([]byte(compose), envfile.Gitops, nil, []string{"BITSWAN_GITOPS_DOMAIN=other"})
+	assert.ErrorContains(t, err, "set by bitswan")
+
+	noEditor, _, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "", "example.com", "", true, nil, nil, nil, Limits{}, env)
+	require.NoError(t, err)
+	_, err = SetEnvironment([]byte(noEditor), envfile.Editor, nil, []string{"TZ=UTC"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package dockercompose
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+// OverrideFile is the user owned overlay next to the generated docker-compose.yml.
+// docker compose picks it up on its own when it is run in the deployment directory,
+// the generated file is rewritten by update but the overlay is never touched.
+const OverrideFile = "docker-compose.override.yml"
+
+// Options of the generated services that the overlay may not change, the Caddy
+// routes depend on them
+var protectedOptions = []string{"hostname", "container_name"}
+
+// ReadOverride returns the overlay of the deployment directory, nil when there is none
+func ReadOverride(deploymentDir string) ([]byte, error) {
+	data, err := host.ReadFile(filepath.Join(deploymentDir, OverrideFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", OverrideFile, err)
+	}
+	return data, nil
+}
+
+// MergeOverride validates the overlay against the generated docker-compose file and
+// returns the merged file. docker compose does the merge, so the result is what up
+// runs, only the options bitswan manages are checked here.
+func MergeOverride(deploymentDir string, compose, override []byte) ([]byte, error) {
+	if err := CheckOverride(compose, override); err != nil {
+		return nil, err
+	}
+	merged, err := Config(deploymentDir, compose, override)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", OverrideFile, err)
+	}
+	return merged, nil
+}
+
+// CheckOverride checks that the overlay leaves the options of the generated services
+// alone that the Caddy routes depend on
+func CheckOverride(compose, override []byte) error {
+	var base struct {
+		Services map[string]interface{} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(compose, &base); err != nil {
+		return fmt.Errorf("failed to parse docker-compose file: %w", err)
+	}
+
+	// Nodes keep the !reset and !override tags docker compose understands
+	var overlay struct {
+		Services map[string]yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(override, &overlay); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", OverrideFile, err)
+	}
+
+	for name, service := range overlay.Services {
+		if _, generated := base.Services[name]; !generated || service.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(service.Content); i += 2 {
+			for _, option := range protectedOptions {
+				if service.Content[i].Value == option {
+					return fmt.Errorf("invalid %s: %s of service %s is managed by bitswan", OverrideFile, option, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Config returns the docker-compose files merged and normalized by docker compose
+// config. The files are written to the deployment directory while it runs, so that
+// their relative paths resolve the same as on up. Variables and env files are left
+// unresolved, the output does not show the secrets.
+func Config(deploymentDir string, files ...[]byte) ([]byte, error) {
+	args := []string{"compose"}
+	for i, data := range files {
+		name := fmt.Sprintf(".docker-compose.config-%d-%d.yml", os.Getpid(), i)
+		path := filepath.Join(deploymentDir, name)
+		if err := host.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		defer host.Remove(path)
+		args = append(args, "-f", name)
+	}
+	args = append(args, "config", "--no-interpolate", "--no-env-resolution")
+
+	cmd := host.Command(deploymentDir, "docker", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker compose config failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Encode serializes a docker-compose data structure the same way the generated files are
+func Encode(dockerCompose map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(dockerCompose); err != nil {
+		return nil, fmt.Errorf("failed to encode docker-compose data structure: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+package dockercompose
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOverride(t *testing.T) {
+	compose, _, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", true, nil, nil, nil, Limits{}, nil)
+	require.NoError(t, err)
+
+	testCases := map[string]string{
+		"not yaml":           "services: [",
+		"protected option":   "services:\n  bitswan-gitops:\n    hostname: other",
+		"reset container":    "services:\n  bitswan-gitops:\n    container_name: !reset null",
+		"services not a map": "services: nope",
+	}
+	for name, override := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, CheckOverride([]byte(compose), []byte(override)))
+		})
+	}
+
+	// Everything else is left to docker compose
+	for _, override := range []string{
+		"x-notes: kept for humans\n",
+		"services:\n  sidecar:\n    image: busybox\n    hostname: sidecar\n",
+		"services:\n  bitswan-gitops:\n    volumes: !reset []\n    environment:\n      HTTP_PROXY: http://proxy:3128\n",
+	} {
+		assert.NoError(t, CheckOverride([]byte(compose), []byte(override)), override)
+	}
+}
+
+func TestMergeOverride(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("docker is faked on Linux only")
+	}
+	compose, _, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", true, nil, nil, nil, Limits{}, nil)
+	require.NoError(t, err)
+
+	// The fake docker prints its arguments and the files it was given
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\"\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = -f ]; then cat \"$2\"; fi\n  shift\ndone\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	deploymentDir := t.TempDir()
+	override := "services:\n  sidecar:\n    image: busybox\n"
+	merged, err := MergeOverride(deploymentDir, []byte(compose), []byte(override))
+	require.NoError(t, err)
+	assert.Contains(t, string(merged), "config --no-interpolate --no-env-resolution\n")
+	assert.Contains(t, string(merged), compose)
+	assert.Contains(t, string(merged), override)
+
+	// The files docker compose was given are cleaned up
+	entries, err := os.ReadDir(deploymentDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = MergeOverride(deploymentDir, []byte(compose), []byte("services:\n  bitswan-gitops:\n    hostname: other\n"))
+	assert.ErrorContains(t, err, "managed by bitswan")
+
+	// Errors of docker compose are passed on
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho 'services.sidecar must have an image' >&2\nexit 15\n"), 0755))
+	_, err = MergeOverride(deploymentDir, []byte(compose), []byte(override))
+	assert.ErrorContains(t, err, "services.sidecar must have an image")
+}
@@ -0,0 +1,113 @@
+package dockercompose
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Resources constrains a service, empty fields leave the docker defaults
+type Resources struct {
+	// CPUs is the number of CPUs the service may use, e.g. 1.5
+	CPUs string `yaml:"cpus,omitempty"`
+	// Memory is the memory limit, e.g. 512m or 2g
+	Memory    string `yaml:"memory,omitempty"`
+	PidsLimit int    `yaml:"pids_limit,omitempty"`
+	// Restart overrides the restart policy, which is always by default
+	Restart string `yaml:"restart,omitempty"`
+}
+
+// Limits are the resource limits of a workspace
+type Limits struct {
+	Gitops Resources `yaml:"gitops,omitempty"`
+	Editor Resources `yaml:"editor,omitempty"`
+	// Automations are the defaults gitops applies to the automation containers it launches
+	Automations Resources `yaml:"automations,omitempty"`
+}
+
+// Environment variables that tell gitops the default limits of automation containers
+const (
+	AutomationCPUsEnv      = "BITSWAN_AUTOMATION_CPUS"
+	AutomationMemoryEnv    = "BITSWAN_AUTOMATION_MEMORY"
+	AutomationPidsLimitEnv = "BITSWAN_AUTOMATION_PIDS_LIMIT"
+)
+
+var (
+	memoryRe  = regexp.MustCompile(`^(?i)[0-9]+(\.[0-9]+)?[bkmg]?b?$`)
+	restartRe = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:[0-9]+)?)$`)
+)
+
+func (r Resources) IsZero() bool {
+	return r == Resources{}
+}
+
+func (l Limits) IsZero() bool {
+	return l.Gitops.IsZero() && l.Editor.IsZero() && l.Automations.IsZero()
+}
+
+// Validate checks the values before they end up in the docker-compose file
+func (r Resources) Validate() error {
+	if r.CPUs != "" {
+		cpus, err := strconv.ParseFloat(r.CPUs, 64)
+		if err != nil || cpus <= 0 {
+			return fmt.Errorf("invalid cpus %q, expected a positive number such as 1.5", r.CPUs)
+		}
+	}
+	if r.Memory != "" && !memoryRe.MatchString(r.Memory) {
+		return fmt.Errorf("invalid memory %q, expected a size such as 512m or 2g", r.Memory)
+	}
+	if r.PidsLimit < -1 {
+		return fmt.Errorf("invalid pids limit %d, expected a positive number or -1 for unlimited", r.PidsLimit)
+	}
+	if r.Restart != "" && !restartRe.MatchString(r.Restart) {
+		return fmt.Errorf("invalid restart policy %q, expected no, always, unless-stopped or on-failure[:max-retries]", r.Restart)
+	}
+	return nil
+}
+
+func (l Limits) Validate() error {
+	if err := l.Gitops.Validate(); err != nil {
+		return fmt.Errorf("gitops: %w", err)
+	}
+	if err := l.Editor.Validate(); err != nil {
+		return fmt.Errorf("editor: %w", err)
+	}
+	if err := l.Automations.Validate(); err != nil {
+		return fmt.Errorf("automations: %w", err)
+	}
+	if l.Automations.Restart != "" {
+		return fmt.Errorf("automations: the restart policy of automations is managed by gitops")
+	}
+	return nil
+}
+
+// apply sets the limits on a service of the docker-compose file
+func (r Resources) apply(service map[string]interface{}) {
+	if r.CPUs != "" {
+		service["cpus"] = r.CPUs
+	}
+	if r.Memory != "" {
+		service["mem_limit"] = r.Memory
+	}
+	if r.PidsLimit != 0 {
+		service["pids_limit"] = r.PidsLimit
+	}
+	if r.Restart != "" {
+		service["restart"] = r.Restart
+	}
+}
+
+// automationEnv returns the environment variables for the automation defaults
+func (r Resources) automationEnv() []string {
+	var env []string
+	if r.CPUs != "" {
+		env = append(env, AutomationCPUsEnv+"="+r.CPUs)
+	}
+	if r.Memory != "" {
+		env = append(env, AutomationMemoryEnv+"="+r.Memory)
+	}
+	if r.PidsLimit != 0 {
+		env = append(env, AutomationPidsLimitEnv+"="+strconv.Itoa(r.PidsLimit))
+	}
+	return env
+}
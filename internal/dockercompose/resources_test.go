@@ -0,0 +1,63 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestResourcesValidate(t *testing.T) {
+	valid := []Resources{
+		{},
+		{CPUs: "1.5", Memory: "512m", PidsLimit: 200, Restart: "unless-stopped"},
+		{CPUs: "2", Memory: "2G", PidsLimit: -1, Restart: "on-failure:3"},
+	}
+	for _, r := range valid {
+		assert.NoError(t, r.Validate(), "%+v", r)
+	}
+
+	invalid := []Resources{
+		{CPUs: "0"},
+		{CPUs: "two"},
+		{Memory: "lots"},
+		{PidsLimit: -2},
+		{Restart: "sometimes"},
+	}
+	for _, r := range invalid {
+		assert.Error(t, r.Validate(), "%+v", r)
+	}
+
+	err := Limits{Automations: Resources{Restart: "always"}}.Validate()
+	assert.ErrorContains(t, err, "automations")
+}
+
+func TestCreateDockerComposeFileLimits(t *testing.T) {
+	limits := Limits{
+		Gitops:      Resources{CPUs: "1", Memory: "1g", Restart: "unless-stopped"},
+		Editor:      Resources{Memory: "4g", PidsLimit: 500},
+		Automations: Resources{CPUs: "0.5", Memory: "256m"},
+	}
+	compose, _, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", false, nil, nil, nil, limits, nil)
+	require.NoError(t, err)
+
+	var parsed struct {
+		Services map[string]map[string]interface{} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(compose), &parsed))
+
+	gitops := parsed.Services["bitswan-gitops"]
+	assert.Equal(t, "1", gitops["cpus"])
+	assert.Equal(t, "1g", gitops["mem_limit"])
+	assert.Equal(t, "unless-stopped", gitops["restart"])
+	assert.Contains(t, gitops["environment"], AutomationCPUsEnv+"=0.5")
+	assert.Contains(t, gitops["environment"], AutomationMemoryEnv+"=256m")
+	assert.NotContains(t, gitops, "pids_limit")
+
+	editor := parsed.Services["bitswan-editor"]
+	assert.Equal(t, "4g", editor["mem_limit"])
+	assert.Equal(t, 500, editor["pids_limit"])
+	assert.Equal(t, "always", editor["restart"])
+	assert.NotContains(t, editor, "cpus")
+}
@@ -0,0 +1,109 @@
+package dockercompose
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dchest/uniuri"
+	"gopkg.in/yaml.v3"
+)
+
+// Env files next to the docker-compose file that pass the secrets to the services, so
+// that they are neither in the docker-compose file nor in its revision history
+const (
+	GitopsSecretsFile = "gitops.secrets.env"
+	EditorSecretsFile = "editor.secrets.env"
+)
+
+// SecretVariables are the variables that hold secrets
+var SecretVariables = map[string]bool{
+	"BITSWAN_GITOPS_SECRET": true,
+	"BITSWAN_DEPLOY_SECRET": true,
+	"BITSWAN_AOC_TOKEN":     true,
+	"MQTT_PASSWORD":         true,
+}
+
+// GitopsSecretVariables hold the gitops secret, the editor deploys with it as well
+var GitopsSecretVariables = []string{"BITSWAN_GITOPS_SECRET", "BITSWAN_DEPLOY_SECRET"}
+
+var secretsFiles = map[string]string{
+	"bitswan-gitops": GitopsSecretsFile,
+	"bitswan-editor": EditorSecretsFile,
+}
+
+// ExternalizeSecrets moves the secret variables of the services out of the
+// docker-compose file and lets the services load them from env files instead. It
+// returns the new docker-compose file and the content of the env files, which is
+// empty when the file had no secrets in it.
+func ExternalizeSecrets(compose []byte) ([]byte, map[string][]byte, error) {
+	var dockerCompose map[string]interface{}
+	if err := yaml.Unmarshal(compose, &dockerCompose); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse docker-compose file: %w", err)
+	}
+
+	services, _ := dockerCompose["services"].(map[string]interface{})
+	envFiles := map[string][]byte{}
+	for name, file := range secretsFiles {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var environment []string
+		var secretVars strings.Builder
+		existing, _ := service["environment"].([]interface{})
+		for _, v := range existing {
+			key, _, _ := strings.Cut(fmt.Sprint(v), "=")
+			if SecretVariables[key] {
+				secretVars.WriteString(fmt.Sprint(v) + "\n")
+				continue
+			}
+			environment = append(environment, fmt.Sprint(v))
+		}
+		if secretVars.Len() == 0 {
+			continue
+		}
+
+		service["environment"] = environment
+		service["env_file"] = []string{file}
+		envFiles[file] = []byte(secretVars.String())
+	}
+
+	out, err := Encode(dockerCompose)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, envFiles, nil
+}
+
+// ParseEnvFile parses the KEY=VALUE lines of an env file
+func ParseEnvFile(data []byte) map[string]string {
+	vars := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		vars[key] = value
+	}
+	return vars
+}
+
+// NewGitopsSecret generates the secret the gitops service authenticates requests with
+func NewGitopsSecret() string {
+	return uniuri.NewLen(64)
+}
+
+// SetEnvFileValues replaces the values of variables in the content of an env file,
+// variables that are not in the file are not added
+func SetEnvFileValues(data []byte, values map[string]string) []byte {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		key, _, found := strings.Cut(strings.TrimSpace(line), "=")
+		if value, ok := values[key]; found && ok {
+			lines[i] = key + "=" + value
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
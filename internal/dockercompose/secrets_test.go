@@ -0,0 +1,52 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExternalizeSecrets(t *testing.T) {
+	compose, token, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "", false, nil, nil, nil, Limits{}, nil)
+	require.NoError(t, err)
+
+	out, envFiles, err := ExternalizeSecrets([]byte(compose))
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), token)
+	assert.Contains(t, serviceEnvironment(t, out, "bitswan-gitops"), "BITSWAN_WORKSPACE_NAME=alpha")
+	assert.Equal(t, token, ParseEnvFile(envFiles[GitopsSecretsFile])["BITSWAN_GITOPS_SECRET"])
+
+	var parsed struct {
+		Services map[string]map[string]interface{} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal(out, &parsed))
+	assert.Equal(t, []interface{}{GitopsSecretsFile}, parsed.Services["bitswan-gitops"]["env_file"])
+
+	// Moving the secrets out again finds nothing to move
+	again, envFiles, err := ExternalizeSecrets(out)
+	require.NoError(t, err)
+	assert.Empty(t, envFiles)
+	assert.Equal(t, string(out), string(again))
+}
+
+func TestCreateKeepsGitopsSecret(t *testing.T) {
+	compose, token, err := CreateDockerComposeFile("/tmp/alpha", "alpha", "bitswan/gitops:1", "bitswan/editor:1", "example.com", "kept", false, nil, nil, nil, Limits{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "kept", token)
+	assert.Contains(t, serviceEnvironment(t, []byte(compose), "bitswan-gitops"), "BITSWAN_GITOPS_SECRET=kept")
+	assert.Contains(t, serviceEnvironment(t, []byte(compose), "bitswan-editor"), "BITSWAN_DEPLOY_SECRET=kept")
+}
+
+func TestParseEnvFile(t *testing.T) {
+	vars := ParseEnvFile([]byte("# comment\nA=1\n\nB=x=y\n"))
+	assert.Equal(t, map[string]string{"A": "1", "B": "x=y"}, vars)
+}
+
+func TestSetEnvFileValues(t *testing.T) {
+	data := []byte("BITSWAN_GITOPS_SECRET=old\nBITSWAN_AOC_TOKEN=token\n")
+	values := map[string]string{"BITSWAN_GITOPS_SECRET": "new", "BITSWAN_DEPLOY_SECRET": "new"}
+	assert.Equal(t, "BITSWAN_GITOPS_SECRET=new\nBITSWAN_AOC_TOKEN=token\n", string(SetEnvFileValues(data, values)))
+	assert.Len(t, NewGitopsSecret(), 64)
+}
@@ -1,39 +1,272 @@
 package dockerhub
 
+/*
+   This package resolves BitSwan image tags on Docker Hub. Release tags look
+   like 2025-123-git-abcdef0 (year, build number, commit) and are ordered by
+   year and build number. A channel selects which tags are considered:
+
+     stable    release tags only
+     beta      release tags and pre-release tags such as 2025-124-git-abcdef0-beta
+     <prefix>  release tags pinned to a prefix, e.g. 2025 or 2025-123
+*/
+
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"io"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/registry"
 )
 
-func GetLatestDockerHubVersion(url string) (string, error) {
-	// Get the latest version of the bitswan-gitops image by looking it up on dockerhub
-	resp, err := http.Get(url) //nolint:gosec
+const (
+	DefaultBaseURL  = "https://hub.docker.com"
+	DefaultCacheTTL = 10 * time.Minute
+
+	// BaseURLEnv overrides the registry base URL, e.g. for a stand-in registry
+	BaseURLEnv = "BITSWAN_DOCKERHUB_URL"
+
+	Stable = "stable"
+	Beta   = "beta"
+)
+
+var tagRe = regexp.MustCompile(`^(\d{4})-(\d+)-git-([a-fA-F0-9]+)(?:-([a-zA-Z0-9.]+))?$`)
+
+type Version struct {
+	Tag    string
+	Year   int
+	Build  int
+	Commit string
+	// Prerelease is the suffix of pre-release tags, empty for releases
+	Prerelease string
+}
+
+// ParseVersion parses a BitSwan image tag
+func ParseVersion(tag string) (Version, bool) {
+	m := tagRe.FindStringSubmatch(tag)
+	if m == nil {
+		return Version{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	build, err := strconv.Atoi(m[2])
 	if err != nil {
-		return "latest", err
+		return Version{}, false
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	return Version{Tag: tag, Year: year, Build: build, Commit: m[3], Prerelease: m[4]}, true
+}
+
+// Less orders versions by year and build number, releases sort after pre-releases of the same build
+func (v Version) Less(other Version) bool {
+	if v.Year != other.Year {
+		return v.Year < other.Year
+	}
+	if v.Build != other.Build {
+		return v.Build < other.Build
+	}
+	return v.Prerelease != "" && other.Prerelease == ""
+}
+
+// Matches reports whether the version belongs to the channel
+func (v Version) Matches(channel string) bool {
+	switch channel {
+	case "", Stable:
+		return v.Prerelease == ""
+	case Beta:
+		return true
+	}
+	return v.Prerelease == "" && (v.Tag == channel || strings.HasPrefix(v.Tag, channel+"-"))
+}
+
+// Latest returns the newest tag of the channel
+func Latest(tags []string, channel string) (string, error) {
+	var versions []Version
+	for _, tag := range tags {
+		if v, ok := ParseVersion(tag); ok && v.Matches(channel) {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no version found in channel %q", channel)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Less(versions[j]) })
+	return versions[len(versions)-1].Tag, nil
+}
+
+type Resolver struct {
+	BaseURL string
+	Client  *http.Client
+	// Registry lists tags through the OCI distribution API instead of the Docker Hub API
+	Registry *registry.Client
+	// CacheDir holds the fetched tag lists, caching is disabled when empty
+	CacheDir string
+	CacheTTL time.Duration
+}
+
+// NewResolver returns a resolver for Docker Hub, or for the registry set in BITSWAN_DOCKERHUB_URL
+func NewResolver() *Resolver {
+	baseURL := os.Getenv(BaseURLEnv)
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Resolver{
+		BaseURL:  baseURL,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		CacheDir: cacheDir(),
+		CacheTTL: DefaultCacheTTL,
+	}
+}
+
+// cacheDir returns the tag cache of the BitSwan home in the user's cache directory
+// (XDG_CACHE_HOME, ~/Library/Caches on macOS), every home has its own
+func cacheDir() string {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(userCache, "bitswan", "dockerhub")
+	if instance := home.Instance(); instance != "" {
+		dir += "-" + instance
+	}
+	return dir
+}
+
+// Resolve returns the newest image of the repository in the channel, e.g. bitswan/gitops:2025-123-git-abcdef0
+func (r *Resolver) Resolve(repository, channel string) (string, error) {
+	tags, err := r.Tags(repository)
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := Latest(tags, channel)
 	if err != nil {
-		return "latest", err
+		return "", fmt.Errorf("failed to resolve %s: %w", repository, err)
+	}
+	return repository + ":" + tag, nil
+}
+
+type cacheEntry struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Tags      []string  `json:"tags"`
+}
+
+// Tags returns all tags of the repository, following pagination
+func (r *Resolver) Tags(repository string) ([]string, error) {
+	cachePath := r.cachePath(repository)
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var entry cacheEntry
+			if json.Unmarshal(data, &entry) == nil && time.Since(entry.FetchedAt) < r.CacheTTL {
+				return entry.Tags, nil
+			}
+		}
+	}
+
+	var tags []string
+	var err error
+	if r.Registry != nil {
+		tags, err = r.Registry.Tags(repository)
+	} else {
+		tags, err = r.fetchTags(repository)
 	}
-	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return "latest", err
+		return nil, err
 	}
-	results := data["results"].([]interface{})
-	pattern := `^\d{4}-\d+-git-[a-fA-F0-9]+$`
-	// Compile the regex pattern once, before the loop
-	re := regexp.MustCompile(pattern)
 
-	for _, result := range results {
-		tag := result.(map[string]interface{})["name"].(string)
-		if re.MatchString(tag) {
-			return tag, nil
+	// The cache is only an optimisation, failing to write it is not an error
+	if cachePath != "" {
+		if data, err := json.Marshal(cacheEntry{FetchedAt: time.Now(), Tags: tags}); err == nil {
+			if os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+				os.WriteFile(cachePath, data, 0644)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+type tagsPage struct {
+	Next    *string `json:"next"`
+	Results []struct {
+		Name string `json:"name"`
+	} `json:"results"`
+}
+
+func (r *Resolver) fetchTags(repository string) ([]string, error) {
+	next := fmt.Sprintf("%s/v2/repositories/%s/tags/?page_size=100", strings.TrimSuffix(r.BaseURL, "/"), repository)
+
+	var tags []string
+	for next != "" {
+		page, err := r.fetchPage(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repository, err)
+		}
+
+		for _, result := range page.Results {
+			tags = append(tags, result.Name)
+		}
+
+		next = ""
+		if page.Next != nil && *page.Next != "" {
+			if next, err = resolveNext(r.BaseURL, *page.Next); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return "latest", errors.New("No valid version found")
+
+	return tags, nil
+}
+
+func (r *Resolver) fetchPage(pageURL string) (*tagsPage, error) {
+	resp, err := r.Client.Get(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", pageURL, resp.Status)
+	}
+
+	var page tagsPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+	return &page, nil
+}
+
+// resolveNext resolves the next page link, which may be relative
+func resolveNext(baseURL, next string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %s: %w", baseURL, err)
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page link %s: %w", next, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (r *Resolver) cachePath(repository string) string {
+	if r.CacheDir == "" || r.CacheTTL <= 0 {
+		return ""
+	}
+	baseURL := r.BaseURL
+	if r.Registry != nil {
+		baseURL = r.Registry.BaseURL
+	}
+	sum := sha256.Sum256([]byte(baseURL + "/" + repository))
+	return filepath.Join(r.CacheDir, hex.EncodeToString(sum[:8])+".json")
 }
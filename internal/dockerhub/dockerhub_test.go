@@ -0,0 +1,139 @@
+package dockerhub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+)
+
+// newRegistry serves the tags in pages of two, like Docker Hub does with page_size
+func newRegistry(t *testing.T, tags []string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, "/v2/repositories/bitswan/gitops/tags/", r.URL.Path)
+
+		page := 0
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+
+		end := min(page*2+2, len(tags))
+		results := []map[string]string{}
+		for _, tag := range tags[page*2 : end] {
+			results = append(results, map[string]string{"name": tag})
+		}
+
+		var next *string
+		if end < len(tags) {
+			link := fmt.Sprintf("/v2/repositories/bitswan/gitops/tags/?page=%d", page+1)
+			next = &link
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"next": next, "results": results})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestLatest(t *testing.T) {
+	tags := []string{
+		"latest",
+		"2025-9-git-aaaaaaa",
+		"2024-300-git-bbbbbbb",
+		"2025-10-git-ccccccc",
+		"2025-11-git-ddddddd-beta",
+		"2025-100-git-eeeeeee-rc1",
+		"2025-100-git-fffffff",
+	}
+
+	testCases := []struct {
+		channel  string
+		expected string
+	}{
+		{channel: "", expected: "2025-100-git-fffffff"},
+		{channel: Stable, expected: "2025-100-git-fffffff"},
+		{channel: Beta, expected: "2025-100-git-fffffff"},
+		{channel: "2024", expected: "2024-300-git-bbbbbbb"},
+		{channel: "2025-10", expected: "2025-10-git-ccccccc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.channel, func(t *testing.T) {
+			tag, err := Latest(tags, tc.channel)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tag)
+		})
+	}
+
+	tag, err := Latest(tags[:5], Beta)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-11-git-ddddddd-beta", tag)
+
+	_, err = Latest(tags, "2023")
+	assert.Error(t, err)
+}
+
+func TestResolverPaginates(t *testing.T) {
+	server, requests := newRegistry(t, []string{"latest", "2025-2-git-aaaaaaa", "2025-10-git-bbbbbbb", "2025-9-git-ccccccc", "2024-99-git-ddddddd"})
+
+	r := &Resolver{BaseURL: server.URL, Client: server.Client()}
+	image, err := r.Resolve("bitswan/gitops", Stable)
+	require.NoError(t, err)
+	assert.Equal(t, "bitswan/gitops:2025-10-git-bbbbbbb", image)
+	assert.Equal(t, 3, *requests)
+}
+
+func TestResolverCache(t *testing.T) {
+	server, requests := newRegistry(t, []string{"2025-1-git-aaaaaaa"})
+
+	r := &Resolver{BaseURL: server.URL, Client: server.Client(), CacheDir: t.TempDir(), CacheTTL: time.Minute}
+	for i := 0; i < 3; i++ {
+		_, err := r.Resolve("bitswan/gitops", Stable)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, *requests)
+
+	r.CacheTTL = 0
+	_, err := r.Resolve("bitswan/gitops", Stable)
+	require.NoError(t, err)
+	assert.Equal(t, 2, *requests)
+}
+
+func TestResolverErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	r := &Resolver{BaseURL: server.URL, Client: server.Client()}
+	_, err := r.Resolve("bitswan/gitops", Stable)
+	assert.ErrorContains(t, err, "429")
+
+	empty, _ := newRegistry(t, []string{"latest"})
+	r = &Resolver{BaseURL: empty.URL, Client: empty.Client()}
+	_, err = r.Resolve("bitswan/gitops", Stable)
+	assert.ErrorContains(t, err, "no version found")
+}
+
+func TestCacheDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CACHE_HOME is used on Linux only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", "/var/cache/ops")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv(home.EnvVar, "")
+
+	assert.Equal(t, "/var/cache/ops/bitswan/dockerhub", cacheDir())
+
+	// Another BitSwan home does not share the tags cached for the default one
+	t.Setenv(home.EnvVar, "/srv/bitswan")
+	assert.Equal(t, "/var/cache/ops/bitswan/dockerhub-"+home.Instance(), cacheDir())
+}
@@ -0,0 +1,194 @@
+package envfile
+
+/*
+   This package stores the user defined environment variables of the gitops and
+   editor services of a workspace in env.yaml next to metadata.yaml:
+
+     gitops:
+       HTTP_PROXY: http://proxy.internal:3128
+     editor:
+       TZ: Europe/Prague
+
+   The variables are added to the services whenever the docker-compose file is
+   generated, so they survive updates.
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+const (
+	FileName = "env.yaml"
+
+	Gitops = "gitops"
+	Editor = "editor"
+
+	// ReservedPrefix is used by the variables bitswan sets itself
+	ReservedPrefix = "BITSWAN_"
+
+	mask = "********"
+)
+
+// Services are the services variables can be set on
+var Services = []string{Gitops, Editor}
+
+var keyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Words in variable names that mark the value as secret
+var secretWords = []string{"SECRET", "PASSWORD", "PASSWD", "PASS", "TOKEN", "KEY", "CREDENTIAL", "CREDENTIALS", "AUTH", "PRIVATE"}
+
+// Env maps the service to its variables
+type Env map[string]map[string]string
+
+type Variable struct {
+	Service string `json:"service" yaml:"service"`
+	Key     string `json:"key" yaml:"key"`
+	Value   string `json:"value" yaml:"value"`
+	Secret  bool   `json:"secret" yaml:"secret"`
+}
+
+// Load reads the env file of the workspace directory, a missing file is an empty env
+func Load(workspaceDir string) (Env, error) {
+	env := Env{}
+	data, err := host.ReadFile(filepath.Join(workspaceDir, FileName))
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+	if err := yaml.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", FileName, err)
+	}
+	if env == nil {
+		env = Env{}
+	}
+	return env, nil
+}
+
+// Save writes the env file, it is only readable by the user as it may hold secrets
+func (env Env) Save(workspaceDir string) error {
+	data, err := yaml.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", FileName, err)
+	}
+	if err := host.WriteFile(filepath.Join(workspaceDir, FileName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", FileName, err)
+	}
+	return nil
+}
+
+func ValidateService(service string) error {
+	for _, s := range Services {
+		if service == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid service %q, expected %s", service, strings.Join(Services, " or "))
+}
+
+func ValidateKey(key string) error {
+	if !keyRe.MatchString(key) {
+		return fmt.Errorf("invalid variable name %q", key)
+	}
+	if strings.HasPrefix(key, ReservedPrefix) {
+		return fmt.Errorf("variable %s is reserved, %s variables are managed by bitswan", key, ReservedPrefix)
+	}
+	return nil
+}
+
+// Parse parses KEY=VALUE arguments
+func Parse(args []string) (map[string]string, error) {
+	vars := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid variable %q, expected KEY=VALUE", arg)
+		}
+		if err := ValidateKey(key); err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// Set sets variables of a service
+func (env Env) Set(service string, vars map[string]string) {
+	if env[service] == nil {
+		env[service] = map[string]string{}
+	}
+	for key, value := range vars {
+		env[service][key] = value
+	}
+}
+
+// Unset removes variables of a service, it returns the keys that were not set
+func (env Env) Unset(service string, keys []string) []string {
+	var missing []string
+	for _, key := range keys {
+		if _, ok := env[service][key]; !ok {
+			missing = append(missing, key)
+			continue
+		}
+		delete(env[service], key)
+	}
+	if len(env[service]) == 0 {
+		delete(env, service)
+	}
+	return missing
+}
+
+// List returns the variables sorted by service and key, secret values are masked unless reveal is set
+func (env Env) List(service string, reveal bool) []Variable {
+	vars := []Variable{}
+	for _, s := range Services {
+		if service != "" && s != service {
+			continue
+		}
+		keys := make([]string, 0, len(env[s]))
+		for key := range env[s] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			v := Variable{Service: s, Key: key, Value: env[s][key], Secret: IsSecret(key)}
+			if v.Secret && !reveal {
+				v.Value = mask
+			}
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// Environment returns the KEY=VALUE list of a service, sorted by key
+func (env Env) Environment(service string) []string {
+	var vars []string
+	for _, v := range env.List(service, true) {
+		vars = append(vars, v.Key+"="+v.Value)
+	}
+	return vars
+}
+
+// IsSecret guesses from the name of a variable whether its value is secret
+func IsSecret(key string) bool {
+	for _, word := range strings.FieldsFunc(strings.ToUpper(key), func(r rune) bool { return r == '_' }) {
+		for _, secretWord := range secretWords {
+			if word == secretWord {
+				return true
+			}
+		}
+	}
+	return false
+}
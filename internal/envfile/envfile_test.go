@@ -0,0 +1,64 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	vars, err := Parse([]string{"HTTP_PROXY=http://proxy:3128", "EMPTY=", "URL=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"HTTP_PROXY": "http://proxy:3128", "EMPTY": "", "URL": "a=b"}, vars)
+
+	for _, arg := range []string{"NOVALUE", "1ABC=x", "WITH-DASH=x", "BITSWAN_GITOPS_SECRET=x"} {
+		_, err := Parse([]string{arg})
+		assert.Error(t, err, arg)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	env, err := Load(dir)
+	require.NoError(t, err)
+	assert.Empty(t, env)
+
+	env.Set(Gitops, map[string]string{"B": "2", "A": "1"})
+	env.Set(Editor, map[string]string{"TZ": "UTC"})
+	require.NoError(t, env.Save(dir))
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A=1", "B=2"}, loaded.Environment(Gitops))
+	assert.Equal(t, []string{"TZ=UTC"}, loaded.Environment(Editor))
+
+	assert.Equal(t, []string{"C"}, loaded.Unset(Gitops, []string{"A", "C"}))
+	assert.Equal(t, []string{"B=2"}, loaded.Environment(Gitops))
+	loaded.Unset(Editor, []string{"TZ"})
+	assert.NotContains(t, loaded, Editor)
+}
+
+func TestListMasksSecrets(t *testing.T) {
+	env := Env{}
+	env.Set(Gitops, map[string]string{"DB_PASSWORD": "hunter2", "API_TOKEN": "abc", "KEYBOARD": "us", "TZ": "UTC"})
+	env.Set(Editor, map[string]string{"AWS_SECRET_ACCESS_KEY": "xyz"})
+
+	vars := env.List("", false)
+	require.Len(t, vars, 5)
+	assert.Equal(t, Variable{Service: Gitops, Key: "API_TOKEN", Value: "********", Secret: true}, vars[0])
+	assert.Equal(t, Variable{Service: Gitops, Key: "DB_PASSWORD", Value: "********", Secret: true}, vars[1])
+	assert.Equal(t, Variable{Service: Gitops, Key: "KEYBOARD", Value: "us"}, vars[2])
+	assert.Equal(t, Variable{Service: Gitops, Key: "TZ", Value: "UTC"}, vars[3])
+	assert.Equal(t, Variable{Service: Editor, Key: "AWS_SECRET_ACCESS_KEY", Value: "********", Secret: true}, vars[4])
+
+	revealed := env.List(Editor, true)
+	assert.Equal(t, []Variable{{Service: Editor, Key: "AWS_SECRET_ACCESS_KEY", Value: "xyz", Secret: true}}, revealed)
+}
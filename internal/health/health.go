@@ -0,0 +1,239 @@
+package health
+
+/*
+   This package contains the checks behind `bitswan workspace status` and
+   `bitswan doctor`. Every check inspects one layer of a workspace or of the
+   host (containers, Caddy, certificates, DNS, ...) and reports its findings
+   as a Check.
+*/
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/caddyapi"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+type Status string
+
+const (
+	OK      Status = "ok"
+	Warning Status = "warning"
+	Error   Status = "error"
+)
+
+// CertExpiryWarning is how long before expiry a certificate is reported
+const CertExpiryWarning = 14 * 24 * time.Hour
+
+type Check struct {
+	Name   string `json:"name" yaml:"name"`
+	Status Status `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+	// Hint tells the user how to fix a failing check
+	Hint string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+type Report struct {
+	Workspace string  `json:"workspace" yaml:"workspace"`
+	Healthy   bool    `json:"healthy" yaml:"healthy"`
+	Checks    []Check `json:"checks" yaml:"checks"`
+}
+
+func NewReport(workspace string, checks ...Check) Report {
+	report := Report{Workspace: workspace, Healthy: true, Checks: checks}
+	for _, check := range checks {
+		if check.Status == Error {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+type ComposeContainer struct {
+	Name    string `json:"Name"`
+	Service string `json:"Service"`
+	State   string `json:"State"`
+	Health  string `json:"Health"`
+	Status  string `json:"Status"`
+}
+
+// ParseComposePs parses `docker compose ps --format json`, which prints a JSON array
+// in older compose versions and one JSON object per line in newer ones
+func ParseComposePs(output []byte) ([]ComposeContainer, error) {
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	var containers []ComposeContainer
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &containers); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %w", err)
+		}
+		return containers, nil
+	}
+
+	for _, line := range strings.Split(trimmed, "\n") {
+		var container ComposeContainer
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %w", err)
+		}
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// ContainerStates returns the state of every service of a compose project
+func ContainerStates(projectName string) (map[string]ComposeContainer, error) {
+	output, err := exec.Command("docker", "compose", "-p", projectName, "ps", "-a", "--format", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running docker command: %w", err)
+	}
+
+	containers, err := ParseComposePs(output)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]ComposeContainer{}
+	for _, container := range containers {
+		states[container.Service] = container
+	}
+	return states, nil
+}
+
+// CheckContainers verifies that all expected services of the compose project are running
+func CheckContainers(projectName string, services []string) Check {
+	check := Check{Name: "containers", Status: OK}
+
+	states, err := ContainerStates(projectName)
+	if err != nil {
+		check.Status = Error
+		check.Detail = err.Error()
+		return check
+	}
+
+	var details []string
+	for _, service := range services {
+		container, ok := states[service]
+		switch {
+		case !ok:
+			check.Status = Error
+			details = append(details, service+": missing")
+		case container.State != "running":
+			check.Status = Error
+			details = append(details, service+": "+container.State)
+		case container.Health != "" && container.Health != "healthy":
+			if check.Status == OK {
+				check.Status = Warning
+			}
+			details = append(details, service+": "+container.Health)
+		default:
+			details = append(details, service+": running")
+		}
+	}
+
+	check.Detail = strings.Join(details, ", ")
+	return check
+}
+
+// CheckCaddyObjects verifies that objects with the given @id exist in the Caddy config
+func CheckCaddyObjects(name string, ids []string) Check {
+	check := Check{Name: name, Status: OK}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	var missing []string
+	for _, id := range ids {
+		resp, err := client.Get(caddyapi.AdminURL + "/id/" + id)
+		if err != nil {
+			check.Status = Error
+			check.Detail = fmt.Sprintf("Caddy admin API not reachable: %v", err)
+			return check
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		check.Status = Error
+		check.Detail = "missing " + strings.Join(missing, ", ")
+	} else {
+		check.Detail = strings.Join(ids, ", ")
+	}
+	return check
+}
+
+// CheckCertificate reports when the first certificate in a PEM file expires
+func CheckCertificate(certPath string, now time.Time) Check {
+	check := Check{Name: "certificate", Status: OK}
+
+	data, err := host.ReadFile(certPath)
+	if err != nil {
+		check.Status = Error
+		check.Detail = fmt.Sprintf("failed to read certificate: %v", err)
+		return check
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		check.Status = Error
+		check.Detail = "no certificate found in " + certPath
+		return check
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		check.Status = Error
+		check.Detail = fmt.Sprintf("failed to parse certificate: %v", err)
+		return check
+	}
+
+	expiresIn := cert.NotAfter.Sub(now)
+	switch {
+	case expiresIn <= 0:
+		check.Status = Error
+		check.Detail = "expired on " + cert.NotAfter.Format("2006-01-02")
+	case expiresIn < CertExpiryWarning:
+		check.Status = Warning
+		check.Detail = fmt.Sprintf("expires on %s (in %d days)", cert.NotAfter.Format("2006-01-02"), int(expiresIn.Hours()/24))
+	default:
+		check.Detail = "valid until " + cert.NotAfter.Format("2006-01-02")
+	}
+	return check
+}
+
+// CheckDNS verifies that all hosts resolve. *.localhost hosts always resolve to the loopback.
+func CheckDNS(hosts []string) Check {
+	check := Check{Name: "dns", Status: OK}
+
+	var details []string
+	for _, host := range hosts {
+		if strings.HasSuffix(host, ".localhost") {
+			details = append(details, host+" -> 127.0.0.1")
+			continue
+		}
+
+		addrs, err := net.LookupHost(host)
+		if err != nil || len(addrs) == 0 {
+			check.Status = Error
+			details = append(details, host+" does not resolve")
+			continue
+		}
+		details = append(details, host+" -> "+strings.Join(addrs, " "))
+	}
+
+	check.Detail = strings.Join(details, ", ")
+	return check
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCert(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "*.demo.localhost"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(t.TempDir(), "full-chain.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return certPath
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		notAfter time.Time
+		expected Status
+	}{
+		{name: "valid", notAfter: now.Add(60 * 24 * time.Hour), expected: OK},
+		{name: "expiring soon", notAfter: now.Add(3 * 24 * time.Hour), expected: Warning},
+		{name: "expired", notAfter: now.Add(-24 * time.Hour), expected: Error},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check := CheckCertificate(writeTestCert(t, tc.notAfter), now)
+			assert.Equal(t, tc.expected, check.Status, check.Detail)
+		})
+	}
+}
+
+func TestCheckCertificateMissing(t *testing.T) {
+	check := CheckCertificate(filepath.Join(t.TempDir(), "missing.pem"), time.Now())
+	assert.Equal(t, Error, check.Status)
+}
+
+func TestParseComposePs(t *testing.T) {
+	lines := `{"Name":"demo-site-bitswan-gitops-1","Service":"bitswan-gitops","State":"running"}
+{"Name":"demo-site-bitswan-editor-1","Service":"bitswan-editor","State":"exited"}`
+	containers, err := ParseComposePs([]byte(lines))
+	require.NoError(t, err)
+	require.Len(t, containers, 2)
+	assert.Equal(t, "exited", containers[1].State)
+
+	array := `[{"Name":"demo-site-bitswan-gitops-1","Service":"bitswan-gitops","State":"running"}]`
+	containers, err = ParseComposePs([]byte(array))
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "bitswan-gitops", containers[0].Service)
+
+	containers, err = ParseComposePs([]byte("\n"))
+	require.NoError(t, err)
+	assert.Empty(t, containers)
+}
+
+func TestNewReport(t *testing.T) {
+	report := NewReport("demo", Check{Name: "a", Status: OK}, Check{Name: "b", Status: Warning})
+	assert.True(t, report.Healthy)
+
+	report = NewReport("demo", Check{Name: "a", Status: OK}, Check{Name: "b", Status: Error})
+	assert.False(t, report.Healthy)
+}
@@ -0,0 +1,173 @@
+package history
+
+/*
+   This package keeps a revision history of the docker-compose file of a
+   workspace. Every deployed compose file is stored as a numbered revision
+   together with the image tags it resolved to, so that a broken update can
+   be rolled back.
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+const (
+	// Dir is the history directory inside the deployment directory
+	Dir       = "history"
+	indexFile = "revisions.yaml"
+
+	// MaxRevisions is how many revisions are kept, older ones are pruned
+	MaxRevisions = 20
+)
+
+type Revision struct {
+	Number    int               `json:"revision" yaml:"revision"`
+	CreatedAt time.Time         `json:"created_at" yaml:"created_at"`
+	Reason    string            `json:"reason" yaml:"reason"`
+	Images    map[string]string `json:"images" yaml:"images"`
+}
+
+type History struct {
+	dir       string
+	Revisions []Revision `yaml:"revisions"`
+}
+
+// Load reads the history of the deployment directory, a missing history is empty
+func Load(deploymentDir string) (*History, error) {
+	h := &History{dir: filepath.Join(deploymentDir, Dir)}
+
+	data, err := host.ReadFile(filepath.Join(h.dir, indexFile))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revision history: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revision history: %w", err)
+	}
+	return h, nil
+}
+
+// Current returns the latest revision, or nil when there is none
+func (h *History) Current() *Revision {
+	if len(h.Revisions) == 0 {
+		return nil
+	}
+	return &h.Revisions[len(h.Revisions)-1]
+}
+
+// Previous returns the revision before the latest one, or nil when there is none
+func (h *History) Previous() *Revision {
+	if len(h.Revisions) < 2 {
+		return nil
+	}
+	return &h.Revisions[len(h.Revisions)-2]
+}
+
+// Get returns the revision with the given number
+func (h *History) Get(number int) (*Revision, error) {
+	for i := range h.Revisions {
+		if h.Revisions[i].Number == number {
+			return &h.Revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d not found", number)
+}
+
+// Compose returns the docker-compose file of a revision
+func (h *History) Compose(number int) ([]byte, error) {
+	data, err := host.ReadFile(h.composePath(number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revision %d: %w", number, err)
+	}
+	return data, nil
+}
+
+// Files returns the paths of the stored docker-compose files
+func (h *History) Files() []string {
+	var files []string
+	for _, revision := range h.Revisions {
+		files = append(files, h.composePath(revision.Number))
+	}
+	return files
+}
+
+// Record stores the docker-compose file as a new revision and prunes old revisions
+func (h *History) Record(compose []byte, reason string) (*Revision, error) {
+	images, err := ComposeImages(compose)
+	if err != nil {
+		return nil, err
+	}
+
+	number := 1
+	if current := h.Current(); current != nil {
+		number = current.Number + 1
+	}
+
+	if err := host.MkdirAll(h.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := host.WriteFile(h.composePath(number), compose, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write revision %d: %w", number, err)
+	}
+
+	h.Revisions = append(h.Revisions, Revision{
+		Number:    number,
+		CreatedAt: time.Now().UTC(),
+		Reason:    reason,
+		Images:    images,
+	})
+
+	for len(h.Revisions) > MaxRevisions {
+		host.Remove(h.composePath(h.Revisions[0].Number))
+		h.Revisions = h.Revisions[1:]
+	}
+
+	if err := h.save(); err != nil {
+		return nil, err
+	}
+	return h.Current(), nil
+}
+
+func (h *History) save() error {
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision history: %w", err)
+	}
+	if err := host.WriteFile(filepath.Join(h.dir, indexFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write revision history: %w", err)
+	}
+	return nil
+}
+
+func (h *History) composePath(number int) string {
+	return filepath.Join(h.dir, strconv.Itoa(number)+".yml")
+}
+
+// ComposeImages returns the image of every service in a docker-compose file
+func ComposeImages(compose []byte) (map[string]string, error) {
+	var parsed struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(compose, &parsed); err != nil {
+		return nil, fmt.Errorf("error unmarshalling docker-compose file: %w", err)
+	}
+
+	images := map[string]string{}
+	for name, service := range parsed.Services {
+		images[name] = service.Image
+	}
+	return images, nil
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compose(tag string) []byte {
+	return []byte(fmt.Sprintf("services:\n  bitswan-gitops:\n    image: bitswan/gitops:%s\n", tag))
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := Load(dir)
+	require.NoError(t, err)
+	assert.Nil(t, h.Current())
+	assert.Nil(t, h.Previous())
+
+	_, err = h.Record(compose("1"), "init")
+	require.NoError(t, err)
+	revision, err := h.Record(compose("2"), "update")
+	require.NoError(t, err)
+	assert.Equal(t, 2, revision.Number)
+	assert.Equal(t, "bitswan/gitops:2", revision.Images["bitswan-gitops"])
+
+	h, err = Load(dir)
+	require.NoError(t, err)
+	require.Len(t, h.Revisions, 2)
+	assert.Equal(t, 2, h.Current().Number)
+	assert.Equal(t, 1, h.Previous().Number)
+
+	data, err := h.Compose(1)
+	require.NoError(t, err)
+	assert.Equal(t, compose("1"), data)
+
+	_, err = h.Get(3)
+	assert.Error(t, err)
+}
+
+func TestRecordPrunesOldRevisions(t *testing.T) {
+	dir := t.TempDir()
+	h, err := Load(dir)
+	require.NoError(t, err)
+
+	for i := 0; i < MaxRevisions+5; i++ {
+		_, err := h.Record(compose(fmt.Sprint(i)), "update")
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, h.Revisions, MaxRevisions)
+	assert.Equal(t, 6, h.Revisions[0].Number)
+	assert.Len(t, h.Files(), MaxRevisions)
+
+	_, err = os.Stat(h.composePath(5))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,125 @@
+package home
+
+/*
+   This package resolves the BitSwan home, the directory holding config.toml, the
+   workspaces, Caddy's configuration and the locks. It is, in order of precedence:
+
+     --home           set with Set
+     BITSWAN_HOME
+     $XDG_CONFIG_HOME/bitswan, unless only ~/.config/bitswan exists
+     ~/.config/bitswan
+
+   In a remote context the home is resolved on the remote host, from its
+   environment and file system, with the home of the context in place of --home.
+
+   Several homes can be used on one machine. All but the default one get an
+   instance ID, derived from the path of the home, which is appended to the names
+   of the Docker network and the Caddy container they create, so that they do not
+   clash.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+// EnvVar selects the BitSwan home
+const EnvVar = "BITSWAN_HOME"
+
+// override is the home set with --home
+var override string
+
+// Set overrides the home, as the --home flag does. An empty dir removes the override.
+func Set(dir string) {
+	override = dir
+}
+
+// Dir returns the BitSwan home
+func Dir() string {
+	if dir := explicit(); dir != "" {
+		return dir
+	}
+	return implicit()
+}
+
+// Path returns the path of a file relative to the BitSwan home
+func Path(name ...string) string {
+	return filepath.Join(append([]string{Dir()}, name...)...)
+}
+
+// WorkspacesDir returns the directory of the workspaces
+func WorkspacesDir() string {
+	return Path("workspaces")
+}
+
+// Instance returns the ID of the home, empty for the default home. It is the same
+// every time the same home is used.
+func Instance() string {
+	dir := explicit()
+	if dir == "" || dir == implicit() {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:4])
+}
+
+// NetworkName returns the Docker network the workspaces and Caddy of the home are attached to
+func NetworkName() string {
+	return withInstance("bitswan_network", "_")
+}
+
+// CaddyProject returns the docker compose project of the Caddy of the home
+func CaddyProject() string {
+	return withInstance("bitswan-caddy", "-")
+}
+
+// CaddyContainer returns the container name of the Caddy of the home
+func CaddyContainer() string {
+	return withInstance("caddy", "-")
+}
+
+func withInstance(name, separator string) string {
+	if instance := Instance(); instance != "" {
+		return name + separator + instance
+	}
+	return name
+}
+
+// explicit returns the home set with --home or BITSWAN_HOME, empty when none is
+func explicit() string {
+	dir := override
+	if dir == "" {
+		dir = host.Getenv(EnvVar)
+	}
+	if dir == "" {
+		return ""
+	}
+	// The working directory is on this machine, the homes of remote hosts are absolute
+	if host.Remote() == nil {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+	}
+	return filepath.Clean(dir)
+}
+
+// implicit returns the home used when none is set. ~/.config/bitswan is kept when
+// it exists and the XDG one does not, so that existing installs are still found.
+func implicit() string {
+	legacy := filepath.Join(host.UserHomeDir(), ".config", "bitswan")
+	xdgConfig := host.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" || !filepath.IsAbs(xdgConfig) {
+		return legacy
+	}
+	xdg := filepath.Join(xdgConfig, "bitswan")
+	if _, err := host.Stat(xdg); os.IsNotExist(err) {
+		if _, err := host.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return xdg
+}
@@ -0,0 +1,68 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv(EnvVar, "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Cleanup(func() { Set("") })
+	return dir
+}
+
+func TestDir(t *testing.T) {
+	userHome := setup(t)
+	legacy := filepath.Join(userHome, ".config", "bitswan")
+	xdgConfig := filepath.Join(userHome, "xdg")
+
+	assert.Equal(t, legacy, Dir())
+	assert.Equal(t, filepath.Join(legacy, "workspaces", "alpha"), Path("workspaces", "alpha"))
+
+	t.Setenv("XDG_CONFIG_HOME", xdgConfig)
+	assert.Equal(t, filepath.Join(xdgConfig, "bitswan"), Dir())
+
+	// An existing install in ~/.config/bitswan is kept until the XDG home exists
+	require.NoError(t, os.MkdirAll(legacy, 0755))
+	assert.Equal(t, legacy, Dir())
+	require.NoError(t, os.MkdirAll(filepath.Join(xdgConfig, "bitswan"), 0755))
+	assert.Equal(t, filepath.Join(xdgConfig, "bitswan"), Dir())
+
+	t.Setenv(EnvVar, "/srv/bitswan")
+	assert.Equal(t, "/srv/bitswan", Dir())
+
+	Set("/data/bitswan/")
+	assert.Equal(t, "/data/bitswan", Dir())
+}
+
+func TestInstance(t *testing.T) {
+	userHome := setup(t)
+
+	assert.Empty(t, Instance())
+	assert.Equal(t, "bitswan_network", NetworkName())
+	assert.Equal(t, "bitswan-caddy", CaddyProject())
+	assert.Equal(t, "caddy", CaddyContainer())
+
+	// Naming the default home explicitly does not make it another instance
+	t.Setenv(EnvVar, filepath.Join(userHome, ".config", "bitswan"))
+	assert.Empty(t, Instance())
+
+	t.Setenv(EnvVar, "/srv/bitswan")
+	instance := Instance()
+	assert.Len(t, instance, 8)
+	assert.Equal(t, "bitswan_network_"+instance, NetworkName())
+	assert.Equal(t, "bitswan-caddy-"+instance, CaddyProject())
+	assert.Equal(t, "caddy-"+instance, CaddyContainer())
+
+	Set("/ci/run-1")
+	assert.NotEqual(t, instance, Instance())
+	Set("/srv/bitswan")
+	assert.Equal(t, instance, Instance())
+}
@@ -0,0 +1,146 @@
+package host
+
+/*
+   This package is the machine the BitSwan home is on. It is this machine, unless
+   the command runs in a remote context (see bitswan context). Then the files of
+   the home are read and written over SFTP, commands such as git and docker compose
+   run on the remote host, and its ports are forwarded to this machine, all over
+   one SSH connection. Code that touches the home goes through this package
+   rather than the os package, so that it works the same for both.
+*/
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/atomicfile"
+	"github.com/bitswan-space/bitswan-workspaces/internal/remote"
+)
+
+// conn is the connection to the remote host, nil for this machine
+var conn *remote.Conn
+
+// Use makes the remote host the host of the BitSwan home, nil goes back to this machine
+func Use(c *remote.Conn) {
+	conn = c
+}
+
+// Remote returns the connection to the remote host, nil when the host is this machine
+func Remote() *remote.Conn {
+	return conn
+}
+
+// ReadFile reads a file, as os.ReadFile does
+func ReadFile(name string) ([]byte, error) {
+	if conn != nil {
+		return conn.ReadFile(name)
+	}
+	return os.ReadFile(name)
+}
+
+// WriteFile replaces a file atomically, as atomicfile.WriteFile does
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	if conn != nil {
+		return conn.WriteFile(name, data, perm)
+	}
+	return atomicfile.WriteFile(name, data, perm)
+}
+
+// WriteFileExclusive creates a file, failing with an error satisfying os.IsExist
+// when it already exists
+func WriteFileExclusive(name string, data []byte, perm os.FileMode) error {
+	if conn != nil {
+		return conn.WriteFileExclusive(name, data, perm)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Stat returns the file info of a file, as os.Stat does
+func Stat(name string) (fs.FileInfo, error) {
+	if conn != nil {
+		return conn.Stat(name)
+	}
+	return os.Stat(name)
+}
+
+// ReadDir returns the entries of a directory, as os.ReadDir does
+func ReadDir(name string) ([]fs.DirEntry, error) {
+	if conn != nil {
+		return conn.ReadDir(name)
+	}
+	return os.ReadDir(name)
+}
+
+// MkdirAll creates a directory with its parents, as os.MkdirAll does
+func MkdirAll(name string, perm os.FileMode) error {
+	if conn != nil {
+		return conn.MkdirAll(name, perm)
+	}
+	return os.MkdirAll(name, perm)
+}
+
+// Remove removes a file, as os.Remove does
+func Remove(name string) error {
+	if conn != nil {
+		return conn.Remove(name)
+	}
+	return os.Remove(name)
+}
+
+// Command returns a command that runs name with args on the host, in dir unless it is empty
+func Command(dir, name string, args ...string) *exec.Cmd {
+	return CommandContext(context.Background(), dir, name, args...)
+}
+
+// CommandContext is Command with a context that kills the command when it is done
+func CommandContext(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	if conn != nil {
+		return conn.CommandContext(ctx, dir, name, args...)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// Forward returns the address this machine reaches port on the loopback
+// interface of the host at, e.g. the admin API of Caddy
+func Forward(port int) (string, error) {
+	if conn != nil {
+		return conn.Forward(port)
+	}
+	return "localhost:" + strconv.Itoa(port), nil
+}
+
+// Getenv returns a variable of the environment bitswan runs in on the host, only
+// HOME, BITSWAN_HOME and XDG_CONFIG_HOME are known for a remote host
+func Getenv(key string) string {
+	if conn != nil {
+		return conn.Getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+// GOOS returns the operating system of the host, e.g. linux
+func GOOS() string {
+	if conn != nil {
+		return conn.OS
+	}
+	return runtime.GOOS
+}
+
+// UserHomeDir returns the home directory of the user on the host
+func UserHomeDir() string {
+	return Getenv("HOME")
+}
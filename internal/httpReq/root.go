@@ -12,10 +12,12 @@ import (
     "net"
     "net/http"
     "os"
-    "os/exec"
     "path/filepath"
+    "strconv"
     "strings"
     "time"
+
+    "github.com/bitswan-space/bitswan-workspaces/internal/host"
 )
 
 // NewRequestWithLocalhostResolution creates an HTTP request that automatically
@@ -34,7 +36,7 @@ func NewRequest(method, url string, body io.Reader) (*http.Request, error) {
 // loadMkcertCA loads the mkcert CA certificate if available
 func loadMkcertCA() (*x509.CertPool, error) {
     // Try to get mkcert CA root using mkcert -CAROOT command
-    cmd := exec.Command("mkcert", "-CAROOT")
+    cmd := host.Command("", "mkcert", "-CAROOT")
     output, err := cmd.Output()
     if err != nil {
         // mkcert is not installed or not available
@@ -50,12 +52,12 @@ func loadMkcertCA() (*x509.CertPool, error) {
     caCertPath := filepath.Join(caRootPath, "rootCA.pem")
     
     // Check if mkcert CA exists
-    if _, err := os.Stat(caCertPath); os.IsNotExist(err) {
+    if _, err := host.Stat(caCertPath); os.IsNotExist(err) {
         return nil, fmt.Errorf("mkcert CA not found at %s", caCertPath)
     }
     
     // Read the CA certificate
-    caCert, err := os.ReadFile(caCertPath)
+    caCert, err := host.ReadFile(caCertPath)
     if err != nil {
         return nil, fmt.Errorf("failed to read mkcert CA certificate: %w", err)
     }
@@ -75,22 +77,34 @@ func ExecuteRequestWithLocalhostResolution(req *http.Request) (*http.Response, e
     var caCertPool *x509.CertPool
     if mkcertCA, mkcertErr := loadMkcertCA(); mkcertErr == nil {
         caCertPool = mkcertCA
-        fmt.Printf("Using mkcert CA for .localhost domains\n")
+        fmt.Fprintf(os.Stderr, "Using mkcert CA for .localhost domains\n")
     } else {
-        fmt.Printf("mkcert CA not available, using system certs: %v\n", mkcertErr)
+        fmt.Fprintf(os.Stderr, "mkcert CA not available, using system certs: %v\n", mkcertErr)
     }
 
     // Create a transport with custom dialing for .localhost domains
     transport := &http.Transport{
         DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-            host, port, err := net.SplitHostPort(addr)
+            hostname, port, err := net.SplitHostPort(addr)
             if err != nil {
                 return nil, err
             }
-            fmt.Printf("Resolving host %s\n", host)
+            fmt.Fprintf(os.Stderr, "Resolving host %s\n", hostname)
 
-            if strings.HasSuffix(host, ".localhost") {
-                fmt.Printf("Using localhost resolution for %s\n", host)
+            if strings.HasSuffix(hostname, ".localhost") {
+                fmt.Fprintf(os.Stderr, "Using localhost resolution for %s\n", hostname)
+                // In a remote context localhost is the remote host, reached over a forwarded port
+                if host.Remote() != nil {
+                    portNumber, err := strconv.Atoi(port)
+                    if err != nil {
+                        return nil, err
+                    }
+                    forwarded, err := host.Forward(portNumber)
+                    if err != nil {
+                        return nil, err
+                    }
+                    return net.Dial(network, forwarded)
+                }
                 // Force localhost resolution for .localhost domains
                 return net.Dial(network, net.JoinHostPort("127.0.0.1", port))
             }
@@ -109,11 +123,11 @@ func ExecuteRequestWithLocalhostResolution(req *http.Request) (*http.Response, e
         transport.TLSClientConfig = &tls.Config{
             RootCAs: caCertPool,
         }
-        fmt.Printf("Using mkcert CA for TLS verification of %s\n", req.URL.Hostname())
+        fmt.Fprintf(os.Stderr, "Using mkcert CA for TLS verification of %s\n", req.URL.Hostname())
     } else {
         // For other domains or when mkcert CA is not available, use system default TLS config
         transport.TLSClientConfig = &tls.Config{}
-        fmt.Printf("Using system default TLS verification for %s\n", req.URL.Hostname())
+        fmt.Fprintf(os.Stderr, "Using system default TLS verification for %s\n", req.URL.Hostname())
     }
 
     // Create a client with our custom transport
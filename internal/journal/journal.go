@@ -0,0 +1,59 @@
+package journal
+
+/*
+   This package keeps track of the side effects performed by multi-step
+   operations (like workspace init) so that they can be undone in reverse
+   order when a later step fails.
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Step is a completed side effect together with the action that reverts it
+type Step struct {
+	Description string
+	Undo        func() error
+}
+
+// Journal records completed steps in the order they were performed
+type Journal struct {
+	steps []Step
+}
+
+func New() *Journal {
+	return &Journal{}
+}
+
+// Record adds a completed step. A nil undo marks a step that has nothing to revert.
+func (j *Journal) Record(description string, undo func() error) {
+	j.steps = append(j.steps, Step{Description: description, Undo: undo})
+}
+
+// Steps returns the recorded steps in the order they were performed
+func (j *Journal) Steps() []Step {
+	return j.steps
+}
+
+// Rollback undoes all recorded steps in reverse order. A failing undo does not
+// stop the rollback, all errors are collected and returned together.
+func (j *Journal) Rollback() error {
+	var errs []error
+
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		step := j.steps[i]
+		if step.Undo == nil {
+			continue
+		}
+
+		fmt.Printf("Undoing: %s\n", step.Description)
+		if err := step.Undo(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to undo %q: %w", step.Description, err))
+		}
+	}
+
+	j.steps = nil
+
+	return errors.Join(errs...)
+}
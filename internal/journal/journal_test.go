@@ -0,0 +1,46 @@
+package journal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackRunsInReverseOrder(t *testing.T) {
+	j := New()
+	var undone []string
+
+	j.Record("first", func() error {
+		undone = append(undone, "first")
+		return nil
+	})
+	j.Record("no undo", nil)
+	j.Record("second", func() error {
+		undone = append(undone, "second")
+		return nil
+	})
+
+	require.NoError(t, j.Rollback())
+	assert.Equal(t, []string{"second", "first"}, undone)
+	assert.Empty(t, j.Steps())
+}
+
+func TestRollbackContinuesOnError(t *testing.T) {
+	j := New()
+	firstUndone := false
+
+	j.Record("first", func() error {
+		firstUndone = true
+		return nil
+	})
+	j.Record("broken", func() error {
+		return errors.New("boom")
+	})
+
+	err := j.Rollback()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+	assert.True(t, firstUndone)
+}
@@ -0,0 +1,172 @@
+package labels
+
+/*
+   This package handles the key=value labels that group workspaces, e.g. by team,
+   environment or customer, and the selectors that pick workspaces by them.
+
+   A selector is a comma separated list of requirements that all have to match:
+
+     env=prod      the label has the value, which may be a shell pattern like prod-*
+     env!=prod     the label is missing or has another value
+     env           the label is set
+     !env          the label is not set
+*/
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DockerPrefix namespaces workspace labels on the docker compose services
+const DockerPrefix = "space.bitswan.label."
+
+var (
+	keyRe   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]*[a-zA-Z0-9])?$`)
+	valueRe = regexp.MustCompile(`^[a-zA-Z0-9._-]*$`)
+)
+
+// Validate checks that the label can be stored in metadata and used as a docker label
+func Validate(key, value string) error {
+	if !keyRe.MatchString(key) || len(key) > 63 {
+		return fmt.Errorf("invalid label key %q: use up to 63 letters, digits, '.', '_', '-' and '/'", key)
+	}
+	if !valueRe.MatchString(value) || len(value) > 63 {
+		return fmt.Errorf("invalid label value %q: use up to 63 letters, digits, '.', '_' and '-'", value)
+	}
+	return nil
+}
+
+// Parse parses key=value assignments such as the values of --label
+func Parse(assignments []string) (map[string]string, error) {
+	set, removed, err := ParseChanges(assignments)
+	if err != nil {
+		return nil, err
+	}
+	if len(removed) > 0 {
+		return nil, fmt.Errorf("invalid label %q, expected key=value", removed[0]+"-")
+	}
+	return set, nil
+}
+
+// ParseChanges parses key=value assignments and key- removals
+func ParseChanges(changes []string) (map[string]string, []string, error) {
+	set := map[string]string{}
+	var removed []string
+	for _, change := range changes {
+		key, value, found := strings.Cut(change, "=")
+		if !found {
+			if key, ok := strings.CutSuffix(change, "-"); ok {
+				if err := Validate(key, ""); err != nil {
+					return nil, nil, err
+				}
+				removed = append(removed, key)
+				continue
+			}
+			return nil, nil, fmt.Errorf("invalid label %q, expected key=value or key- to remove it", change)
+		}
+		if err := Validate(key, value); err != nil {
+			return nil, nil, err
+		}
+		set[key] = value
+	}
+	return set, removed, nil
+}
+
+type operator int
+
+const (
+	equals operator = iota
+	notEquals
+	exists
+	notExists
+)
+
+type requirement struct {
+	key   string
+	op    operator
+	value string
+}
+
+// Selector picks workspaces by their labels
+type Selector []requirement
+
+// ParseSelector parses a selector such as env=prod,team!=data
+func ParseSelector(selector string) (Selector, error) {
+	var s Selector
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var r requirement
+		switch {
+		case strings.Contains(term, "!="):
+			r.key, r.value, _ = strings.Cut(term, "!=")
+			r.op = notEquals
+		case strings.Contains(term, "="):
+			r.key, r.value, _ = strings.Cut(term, "=")
+			r.value = strings.TrimPrefix(r.value, "=")
+			r.op = equals
+		case strings.HasPrefix(term, "!"):
+			r.key = strings.TrimPrefix(term, "!")
+			r.op = notExists
+		default:
+			r.key = term
+			r.op = exists
+		}
+
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if !keyRe.MatchString(r.key) {
+			return nil, fmt.Errorf("invalid selector %q: bad label key %q", selector, r.key)
+		}
+		if _, err := path.Match(r.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		s = append(s, r)
+	}
+	return s, nil
+}
+
+// Matches reports whether the labels satisfy every requirement of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.key]
+		switch r.op {
+		case equals:
+			if !ok || !match(r.value, value) {
+				return false
+			}
+		case notEquals:
+			if ok && match(r.value, value) {
+				return false
+			}
+		case exists:
+			if !ok {
+				return false
+			}
+		case notExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func match(pattern, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// Docker returns the labels namespaced for docker compose services
+func Docker(labels map[string]string) map[string]string {
+	docker := make(map[string]string, len(labels))
+	for key, value := range labels {
+		docker[DockerPrefix+key] = value
+	}
+	return docker
+}
@@ -0,0 +1,60 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChanges(t *testing.T) {
+	set, removed, err := ParseChanges([]string{"env=prod", "team=data-eng", "customer-", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "data-eng", "empty": ""}, set)
+	assert.Equal(t, []string{"customer"}, removed)
+
+	_, _, err = ParseChanges([]string{"env"})
+	assert.Error(t, err)
+	_, _, err = ParseChanges([]string{"env=a b"})
+	assert.ErrorContains(t, err, "invalid label value")
+	_, _, err = ParseChanges([]string{"-env=prod"})
+	assert.ErrorContains(t, err, "invalid label key")
+
+	_, err = Parse([]string{"env-"})
+	assert.Error(t, err)
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"name": "team-a", "env": "prod", "team": "data"}
+
+	testCases := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env==prod", true},
+		{"env=staging", false},
+		{"env!=staging", true},
+		{"env!=prod", false},
+		{"customer!=acme", true},
+		{"team", true},
+		{"customer", false},
+		{"!customer", true},
+		{"!team", false},
+		{"name=team-*", true},
+		{"env=prod, team=data", true},
+		{"env=prod,team=ops", false},
+	}
+
+	for _, tc := range testCases {
+		s, err := ParseSelector(tc.selector)
+		require.NoError(t, err, tc.selector)
+		assert.Equal(t, tc.matches, s.Matches(labels), tc.selector)
+	}
+
+	_, err := ParseSelector("env=[")
+	assert.Error(t, err)
+	_, err = ParseSelector("=prod")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package output
+
+/*
+   This package renders the results of listing and inspect commands in the format
+   chosen with --output:
+
+     table                 aligned columns for humans (default)
+     wide                  the table with additional columns
+     json, yaml            the full objects, for scripts
+     template=<template>   a Go template, executed for every item of a list
+
+   Commands only write their result to stdout, progress messages go to stderr so
+   that the output stays parseable.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Table = "table"
+	Wide  = "wide"
+	JSON  = "json"
+	YAML  = "yaml"
+
+	// Usage describes the formats for the help of --output
+	Usage = "Output format: table, wide, json, yaml or template=<go-template>"
+)
+
+// Column of a table, wide columns are only shown with the wide format
+type Column[T any] struct {
+	Header string
+	Wide   bool
+	Value  func(item T) string
+}
+
+// AddFlag adds the --output/-o flag to the command
+func AddFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", Table, Usage)
+}
+
+// Validate checks the format, so that commands can fail before doing any work
+func Validate(format string) error {
+	_, err := parse(format)
+	return err
+}
+
+// parse returns the template of template formats
+func parse(format string) (*template.Template, error) {
+	switch format {
+	case Table, Wide, JSON, YAML:
+		return nil, nil
+	}
+
+	for _, prefix := range []string{"template=", "go-template="} {
+		if text, ok := strings.CutPrefix(format, prefix); ok {
+			tmpl, err := template.New("output").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid output template: %w", err)
+			}
+			return tmpl, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported output format %q, use table, wide, json, yaml or template=<go-template>", format)
+}
+
+// Write writes a list of items in the format, tables are built from the columns
+func Write[T any](w io.Writer, format string, items []T, columns []Column[T]) error {
+	if items == nil {
+		// Marshal as an empty list rather than null
+		items = []T{}
+	}
+
+	tmpl, err := parse(format)
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		for _, item := range items {
+			if err := tmpl.Execute(w, item); err != nil {
+				return fmt.Errorf("failed to execute output template: %w", err)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+
+	if format == Table || format == Wide {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		var headers []string
+		for _, column := range columns {
+			if !column.Wide || format == Wide {
+				headers = append(headers, column.Header)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+		for _, item := range items {
+			var values []string
+			for _, column := range columns {
+				if !column.Wide || format == Wide {
+					values = append(values, column.Value(item))
+				}
+			}
+			fmt.Fprintln(tw, strings.Join(values, "\t"))
+		}
+		return tw.Flush()
+	}
+
+	return marshal(w, format, items)
+}
+
+// WriteObject writes a single object in the format, writeTable renders it for the table formats
+func WriteObject(w io.Writer, format string, v interface{}, writeTable func(w io.Writer, wide bool) error) error {
+	tmpl, err := parse(format)
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		if err := tmpl.Execute(w, v); err != nil {
+			return fmt.Errorf("failed to execute output template: %w", err)
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+
+	if format == Table || format == Wide {
+		return writeTable(w, format == Wide)
+	}
+	return marshal(w, format, v)
+}
+
+func marshal(w io.Writer, format string, v interface{}) error {
+	if format == JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
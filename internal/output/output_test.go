@@ -0,0 +1,69 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Name  string `json:"name" yaml:"name"`
+	State string `json:"state" yaml:"state"`
+}
+
+var columns = []Column[item]{
+	{Header: "NAME", Value: func(i item) string { return i.Name }},
+	{Header: "STATE", Wide: true, Value: func(i item) string { return i.State }},
+}
+
+func TestWrite(t *testing.T) {
+	items := []item{{Name: "alpha", State: "running"}, {Name: "a-much-longer-name", State: "stopped"}}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{format: Table, expected: "NAME\nalpha\na-much-longer-name\n"},
+		{format: Wide, expected: "NAME                STATE\nalpha               running\na-much-longer-name  stopped\n"},
+		{format: JSON, expected: "[\n  {\n    \"name\": \"alpha\",\n    \"state\": \"running\"\n  },\n  {\n    \"name\": \"a-much-longer-name\",\n    \"state\": \"stopped\"\n  }\n]\n"},
+		{format: YAML, expected: "- name: alpha\n  state: running\n- name: a-much-longer-name\n  state: stopped\n"},
+		{format: "template={{.Name}}={{.State}}", expected: "alpha=running\na-much-longer-name=stopped\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var b bytes.Buffer
+			require.NoError(t, Write(&b, tc.format, items, columns))
+			assert.Equal(t, tc.expected, b.String())
+		})
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, Write[item](&b, JSON, nil, columns))
+	assert.Equal(t, "[]\n", b.String())
+}
+
+func TestWriteObject(t *testing.T) {
+	table := func(w io.Writer, wide bool) error {
+		_, err := io.WriteString(w, "custom table\n")
+		return err
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteObject(&b, Table, item{Name: "alpha"}, table))
+	assert.Equal(t, "custom table\n", b.String())
+
+	b.Reset()
+	require.NoError(t, WriteObject(&b, "go-template={{.Name}}", item{Name: "alpha"}, table))
+	assert.Equal(t, "alpha\n", b.String())
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Wide))
+	assert.NoError(t, Validate("template={{.Name}}"))
+	assert.ErrorContains(t, Validate("xml"), "unsupported output format")
+	assert.ErrorContains(t, Validate("template={{.Name"), "invalid output template")
+}
@@ -0,0 +1,185 @@
+package plan
+
+/*
+   This package collects the side effects a command would perform so they can
+   be reviewed (e.g. `workspace init --dry-run`) before anything is touched.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Kinds of recorded actions
+const (
+	Mkdir = "mkdir"
+	Write = "write"
+	Copy  = "copy"
+	Exec  = "exec"
+	Hosts = "hosts"
+	Caddy = "caddy"
+	HTTP  = "http"
+)
+
+// Redacted replaces secret values in the written plan
+const Redacted = "<redacted>"
+
+type Action struct {
+	Kind        string          `json:"kind"`
+	Description string          `json:"description"`
+	Path        string          `json:"path,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	Command     []string        `json:"command,omitempty"`
+	Dir         string          `json:"dir,omitempty"`
+	Method      string          `json:"method,omitempty"`
+	URL         string          `json:"url,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Content     string          `json:"content,omitempty"`
+}
+
+type Plan struct {
+	Workspace string            `json:"workspace"`
+	Images    map[string]string `json:"images,omitempty"`
+	Actions   []Action          `json:"actions"`
+
+	secrets []string
+}
+
+func New(workspace string) *Plan {
+	return &Plan{
+		Workspace: workspace,
+		Images:    map[string]string{},
+		Actions:   []Action{},
+	}
+}
+
+func (p *Plan) Add(action Action) {
+	p.Actions = append(p.Actions, action)
+}
+
+// Redact hides the given secrets, e.g. the gitops secret or a password, wherever
+// they appear in the written plan
+func (p *Plan) Redact(secrets ...string) {
+	for _, secret := range secrets {
+		if secret != "" {
+			p.secrets = append(p.secrets, secret)
+		}
+	}
+}
+
+// redacted returns the actions with the secrets replaced
+func (p *Plan) redacted() []Action {
+	if len(p.secrets) == 0 {
+		return p.Actions
+	}
+
+	replacements := make([]string, 0, 2*len(p.secrets))
+	for _, secret := range p.secrets {
+		replacements = append(replacements, secret, Redacted)
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	actions := make([]Action, len(p.Actions))
+	for i, action := range p.Actions {
+		action.Path = replacer.Replace(action.Path)
+		action.URL = replacer.Replace(action.URL)
+		action.Content = replacer.Replace(action.Content)
+		if len(action.Command) > 0 {
+			command := make([]string, len(action.Command))
+			for j, arg := range action.Command {
+				command[j] = replacer.Replace(arg)
+			}
+			action.Command = command
+		}
+		if len(action.Payload) > 0 {
+			action.Payload = json.RawMessage(replacer.Replace(string(action.Payload)))
+		}
+		actions[i] = action
+	}
+	return actions
+}
+
+// SetImage records the resolved image of a service
+func (p *Plan) SetImage(service, image string) {
+	p.Images[service] = image
+}
+
+// Write renders the plan in the given format ("text" or "json")
+func (p *Plan) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return p.WriteJSON(w)
+	case "text", "":
+		p.WriteText(w)
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+func (p *Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&Plan{Workspace: p.Workspace, Images: p.Images, Actions: p.redacted()})
+}
+
+func (p *Plan) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Execution plan for workspace %s\n", p.Workspace)
+
+	if len(p.Images) > 0 {
+		fmt.Fprintln(w, "\nImages:")
+		services := make([]string, 0, len(p.Images))
+		for service := range p.Images {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+		for _, service := range services {
+			fmt.Fprintf(w, "  %-8s %s\n", service, p.Images[service])
+		}
+	}
+
+	fmt.Fprintln(w, "\nActions:")
+	for i, action := range p.redacted() {
+		fmt.Fprintf(w, "%3d. [%s] %s\n", i+1, action.Kind, action.Description)
+
+		if action.Source != "" {
+			fmt.Fprintf(w, "       from: %s\n", action.Source)
+		}
+		if action.Path != "" {
+			fmt.Fprintf(w, "       path: %s\n", action.Path)
+		}
+		if len(action.Command) > 0 {
+			fmt.Fprintf(w, "       $ %s\n", strings.Join(action.Command, " "))
+			if action.Dir != "" {
+				fmt.Fprintf(w, "       (in %s)\n", action.Dir)
+			}
+		}
+		if action.URL != "" {
+			fmt.Fprintf(w, "       %s %s\n", action.Method, action.URL)
+		}
+		if len(action.Payload) > 0 {
+			var indented strings.Builder
+			var payload interface{}
+			if err := json.Unmarshal(action.Payload, &payload); err == nil {
+				encoder := json.NewEncoder(&indented)
+				encoder.SetIndent("", "  ")
+				_ = encoder.Encode(payload)
+			} else {
+				indented.Write(action.Payload)
+			}
+			writeIndented(w, strings.TrimRight(indented.String(), "\n"))
+		}
+		if action.Content != "" {
+			writeIndented(w, strings.TrimRight(action.Content, "\n"))
+		}
+	}
+}
+
+func writeIndented(w io.Writer, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "         %s\n", line)
+	}
+}
@@ -0,0 +1,70 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPlan() *Plan {
+	p := New("demo")
+	p.SetImage("gitops", "bitswan/gitops:2025-1-git-abc123")
+	p.Add(Action{Kind: Mkdir, Description: "Create workspace directory", Path: "/tmp/demo"})
+	p.Add(Action{Kind: Exec, Description: "Add GitOps worktree", Command: []string{"git", "worktree", "add"}, Dir: "/tmp/demo/workspace"})
+	p.Add(Action{Kind: Caddy, Description: "Register GitOps route", Method: "POST", URL: "http://localhost:2019/config", Payload: []byte(`[{"@id":"demo_gitops"}]`)})
+	return p
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testPlan().Write(&buf, "text"))
+
+	out := buf.String()
+	assert.Contains(t, out, "Execution plan for workspace demo")
+	assert.Contains(t, out, "bitswan/gitops:2025-1-git-abc123")
+	assert.Contains(t, out, "  1. [mkdir] Create workspace directory")
+	assert.Contains(t, out, "$ git worktree add")
+	assert.Contains(t, out, "POST http://localhost:2019/config")
+	assert.Contains(t, out, `"@id": "demo_gitops"`)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testPlan().Write(&buf, "json"))
+
+	var decoded Plan
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "demo", decoded.Workspace)
+	assert.Len(t, decoded.Actions, 3)
+	assert.Equal(t, Caddy, decoded.Actions[2].Kind)
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, testPlan().Write(&buf, "xml"))
+}
+
+func TestRedact(t *testing.T) {
+	p := testPlan()
+	p.Add(Action{Kind: Write, Description: "Write gitops.secrets.env", Path: "/tmp/demo/gitops.secrets.env", Content: "BITSWAN_GITOPS_SECRET=s3cr3t\n"})
+	p.Add(Action{Kind: HTTP, Description: "Register workspace", Method: "POST", URL: "https://aoc/api?token=s3cr3t", Payload: []byte(`{"password":"hunter2"}`)})
+	p.Redact("s3cr3t", "hunter2", "")
+
+	for _, format := range []string{"text", "json"} {
+		var buf bytes.Buffer
+		require.NoError(t, p.Write(&buf, format))
+		out := buf.String()
+		assert.NotContains(t, out, "s3cr3t", format)
+		assert.NotContains(t, out, "hunter2", format)
+	}
+
+	var buf bytes.Buffer
+	p.WriteText(&buf)
+	assert.Contains(t, buf.String(), "BITSWAN_GITOPS_SECRET="+Redacted)
+
+	// The recorded actions are left as they are
+	assert.Equal(t, "BITSWAN_GITOPS_SECRET=s3cr3t\n", p.Actions[3].Content)
+}
@@ -0,0 +1,254 @@
+package registry
+
+/*
+   This package talks to container registries through the OCI distribution API,
+   so that tags can be listed on private registries and mirrors, not only on
+   Docker Hub. Registries that answer with a Bearer challenge are handled by
+   fetching a pull token from the announced realm, as Docker Hub, Harbor and
+   most others do.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+// Split splits an image reference into its registry host and repository,
+// the host is empty for Docker Hub images such as bitswan/gitops
+func Split(image string) (string, string) {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+	return "", image
+}
+
+type Client struct {
+	// BaseURL of the registry, e.g. https://registry.example.com
+	BaseURL  string
+	Username string
+	Password string
+	HTTP     *http.Client
+}
+
+func NewClient(host, username, password string, insecure bool) *Client {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return &Client{
+		BaseURL:  scheme + "://" + host,
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type tagsList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// Tags lists the tags of the repository with /v2/<name>/tags/list, following the Link header
+func (c *Client) Tags(repository string) ([]string, error) {
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=100", strings.TrimSuffix(c.BaseURL, "/"), repository)
+
+	var token string
+	var tags []string
+	for next != "" {
+		resp, err := c.get(next, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repository, err)
+		}
+
+		// Authenticate on the first challenge and retry
+		if resp.StatusCode == http.StatusUnauthorized && token == "" {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if token, err = c.token(challenge, repository); err != nil {
+				return nil, fmt.Errorf("failed to authenticate to %s: %w", c.BaseURL, err)
+			}
+			continue
+		}
+
+		var page tagsList
+		err = decode(resp, &page)
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repository, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if link != "" {
+			if next, err = nextLink(c.BaseURL, link); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+func (c *Client) get(target, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case token == basicToken:
+		req.SetBasicAuth(c.Username, c.Password)
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.HTTP.Do(req)
+}
+
+func decode(resp *http.Response, v interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", resp.Request.URL, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding JSON: %w", err)
+	}
+	return nil
+}
+
+// basicToken marks that requests authenticate with basic auth instead of a bearer token
+const basicToken = "\x00basic"
+
+var challengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token answers an authentication challenge and returns the token for further requests
+func (c *Client) token(challenge, repository string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.Username == "" {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		return basicToken, nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	values := map[string]string{}
+	for _, m := range challengeParamRe.FindAllStringSubmatch(params, -1) {
+		values[m[1]] = m[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("invalid realm in challenge %q", challenge)
+	}
+
+	query := realm.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := decode(resp, &body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token in response of %s", realm.Host)
+}
+
+var linkRe = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// nextLink returns the next page of a Link header such as </v2/x/tags/list?last=a>; rel="next"
+func nextLink(baseURL, link string) (string, error) {
+	m := linkRe.FindStringSubmatch(link)
+	if m == nil {
+		return "", nil
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %s: %w", baseURL, err)
+	}
+	ref, err := url.Parse(m[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid next page link %s: %w", m[1], err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// LoginAll logs docker in to every registry the configuration pulls from, so that
+// compose can pull the images. Nothing is done without a configured username.
+func LoginAll(reg config.Registry) error {
+	if reg.Username == "" {
+		return nil
+	}
+	password, err := reg.GetPassword()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	targets := []string{reg.Prefix}
+	for _, mirror := range reg.Mirrors {
+		targets = append(targets, mirror)
+	}
+	for _, target := range targets {
+		// The prefix may be a bare host
+		host, _ := Split(target + "/")
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+
+		fmt.Printf("Logging in to %s...\n", host)
+		if err := Login(host, reg.Username, password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Login logs docker on the host in to the registry
+func Login(server, username, password string) error {
+	cmd := host.Command("", "docker", "login", server, "--username", username, "--password-stdin")
+	cmd.Stdin = strings.NewReader(password)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker login to %s failed: %w: %s", server, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		image, host, repository string
+	}{
+		{"bitswan/gitops", "", "bitswan/gitops"},
+		{"caddy", "", "caddy"},
+		{"registry.example.com/bitswan/gitops", "registry.example.com", "bitswan/gitops"},
+		{"localhost:5000/gitops", "localhost:5000", "gitops"},
+		{"localhost/gitops", "localhost", "gitops"},
+	}
+
+	for _, tc := range testCases {
+		host, repository := Split(tc.image)
+		assert.Equal(t, tc.host, host, tc.image)
+		assert.Equal(t, tc.repository, repository, tc.image)
+	}
+}
+
+// newRegistry serves the tags in pages of two behind token authentication
+func newRegistry(t *testing.T, tags []string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "bitswan" || pass != "s3cret" {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, "repository:mirror/gitops:pull", r.URL.Query().Get("scope"))
+			json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+			return
+		}
+
+		require.Equal(t, "/v2/mirror/gitops/tags/list", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:mirror/gitops:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		start := 0
+		if last := r.URL.Query().Get("last"); last != "" {
+			for i, tag := range tags {
+				if tag == last {
+					start = i + 1
+				}
+			}
+		}
+		end := min(start+2, len(tags))
+		if end < len(tags) {
+			w.Header().Set("Link", `</v2/mirror/gitops/tags/list?n=2&last=`+tags[end-1]+`>; rel="next"`)
+		}
+		json.NewEncoder(w).Encode(tagsList{Name: "mirror/gitops", Tags: tags[start:end]})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTags(t *testing.T) {
+	tags := []string{"2025-1-git-aaaaaaa", "2025-2-git-bbbbbbb", "2025-3-git-ccccccc", "latest", "2025-4-git-ddddddd"}
+	server := newRegistry(t, tags)
+
+	c := &Client{BaseURL: server.URL, Username: "bitswan", Password: "s3cret", HTTP: server.Client()}
+	listed, err := c.Tags("mirror/gitops")
+	require.NoError(t, err)
+	assert.Equal(t, tags, listed)
+
+	c.Password = "wrong"
+	_, err = c.Tags("mirror/gitops")
+	assert.ErrorContains(t, err, "failed to authenticate")
+}
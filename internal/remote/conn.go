@@ -0,0 +1,217 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// controlPersist is how long the connection outlives its last use, so that one
+// left behind by a killed bitswan goes away on its own
+const controlPersist = "5m"
+
+// lockedExitCode is the exit code of flock(1) on the host when the lock is held
+const lockedExitCode = 75
+
+// probedEnv are the variables of the host's environment that Getenv returns
+var probedEnv = []string{"HOME", "BITSWAN_HOME", "XDG_CONFIG_HOME"}
+
+// ErrLocked is returned by Lock when the lock is still held after the timeout
+var ErrLocked = errors.New("locked by another process")
+
+// Conn is an SSH connection to a host
+type Conn struct {
+	Target *Target
+	// OS is the operating system of the host as GOOS, e.g. linux
+	OS string
+
+	// dir holds the control socket and the files passed to sftp, only the user can read it
+	dir    string
+	socket string
+	env    map[string]string
+
+	mu       sync.Mutex
+	forwards map[int]string
+}
+
+// Dial connects to the target. Prompts, e.g. for the passphrase of a key or to
+// accept the host key, are shown on the terminal.
+func Dial(t *Target) (*Conn, error) {
+	dir, err := os.MkdirTemp("", "bitswan-ssh-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for the SSH connection: %w", err)
+	}
+	c := &Conn{
+		Target:   t,
+		dir:      dir,
+		socket:   filepath.Join(dir, "control"),
+		env:      map[string]string{},
+		forwards: map[int]string{},
+	}
+
+	// The first session starts the control master, and reports what bitswan needs to know about the host
+	probe := []string{"uname -s"}
+	for _, name := range probedEnv {
+		probe = append(probe, fmt.Sprintf(`printf '%%s\n' "${%s-}"`, name))
+	}
+	cmd := exec.Command("ssh", append(c.ssh("-o", "ControlMaster=yes", "-o", "ControlPersist="+controlPersist, "-T"), "--", strings.Join(probe, "; "))...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to connect to %s over SSH: %w", t.Host, err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != len(probedEnv)+1 {
+		c.Close()
+		return nil, fmt.Errorf("unexpected output of the shell on %s, check that the login scripts print nothing", t.Host)
+	}
+	switch lines[0] {
+	case "Linux":
+		c.OS = "linux"
+	case "Darwin":
+		c.OS = "darwin"
+	default:
+		c.Close()
+		return nil, fmt.Errorf("unsupported operating system %q on %s", lines[0], t.Host)
+	}
+	for i, name := range probedEnv {
+		c.env[name] = lines[i+1]
+	}
+	return c, nil
+}
+
+// Close closes the connection, stopping the forwarded ports
+func (c *Conn) Close() error {
+	cmd := exec.Command("ssh", c.ssh("-O", "exit")...)
+	err := cmd.Run()
+	os.RemoveAll(c.dir)
+	return err
+}
+
+// Getenv returns a variable of the environment of SSH sessions on the host, only
+// HOME, BITSWAN_HOME and XDG_CONFIG_HOME are known
+func (c *Conn) Getenv(key string) string {
+	return c.env[key]
+}
+
+// DockerHost returns the DOCKER_HOST that reaches the Docker daemon of the host
+func (c *Conn) DockerHost() string {
+	return c.Target.String()
+}
+
+// Command returns a command that runs name with args on the host, in dir unless it is empty
+func (c *Conn) Command(dir, name string, args ...string) *exec.Cmd {
+	return c.CommandContext(context.Background(), dir, name, args...)
+}
+
+// CommandContext is Command with a context that kills the local ssh when it is done
+func (c *Conn) CommandContext(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ssh", append(c.ssh("-o", "ControlMaster=no", "-T"), "--", shellCommand(dir, name, args))...)
+}
+
+// Forward forwards a port on this machine to port on the loopback interface of
+// the host and returns its address, e.g. 127.0.0.1:41234. Every port is
+// forwarded once, until the connection is closed.
+func (c *Conn) Forward(port int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if addr, ok := c.forwards[port]; ok {
+		return addr, nil
+	}
+
+	// Let the kernel pick a free port, ssh binds it right after
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cmd := exec.Command("ssh", c.ssh("-O", "forward", "-L", fmt.Sprintf("%s:localhost:%d", addr, port))...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to forward port %d of %s: %w: %s", port, c.Target.Host, err, strings.TrimSpace(string(out)))
+	}
+	c.forwards[port] = addr
+	return addr, nil
+}
+
+// Lock takes the flock of the file at path on the host and writes holder to it.
+// It waits up to timeout for the lock, then fails with ErrLocked. The lock is
+// held until unlock is called or the connection is lost.
+func (c *Conn) Lock(path string, holder []byte, timeout time.Duration) (unlock func() error, err error) {
+	script := fmt.Sprintf(
+		"mkdir -p %[1]s && exec 9>>%[2]s && flock -E %[3]d -w %[4]s 9 || exit; printf '%%s' %[5]s >%[2]s; echo locked; cat >/dev/null; : >%[2]s",
+		Quote(filepath.Dir(path)), Quote(path), lockedExitCode, strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64), Quote(string(holder)),
+	)
+	cmd := exec.Command("ssh", append(c.ssh("-o", "ControlMaster=no", "-T"), "--", script)...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run ssh: %w", err)
+	}
+
+	// The lock is held while the session waits for the end of its input
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	if line != "locked\n" {
+		stdin.Close()
+		err := cmd.Wait()
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == lockedExitCode:
+			return nil, ErrLocked
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 127:
+			return nil, fmt.Errorf("flock(1) is not installed on %s", c.Target.Host)
+		}
+		return nil, fmt.Errorf("failed to lock %s on %s: %v: %s", path, c.Target.Host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return func() error {
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("failed to unlock %s on %s: %w", path, c.Target.Host, err)
+		}
+		return nil
+	}, nil
+}
+
+// ssh returns the arguments of ssh for the connection with the given options
+func (c *Conn) ssh(options ...string) []string {
+	args := append([]string{"-S", c.socket}, options...)
+	if c.Target.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(c.Target.Port))
+	}
+	return append(args, c.Target.Destination())
+}
+
+// shellCommand returns the command line the shell of the host runs for Command
+func shellCommand(dir, name string, args []string) string {
+	words := []string{"exec", Quote(name)}
+	for _, arg := range args {
+		words = append(words, Quote(arg))
+	}
+	command := strings.Join(words, " ")
+	if dir != "" {
+		command = "cd " + Quote(dir) + " && " + command
+	}
+	return command
+}
@@ -0,0 +1,92 @@
+package remote
+
+/*
+   This package manages the BitSwan home of a remote host over SSH. A context names
+   a host, e.g. ssh://ops@vm1.example.com, and commands run in it are run by the
+   local bitswan against the host, which only needs Docker, flock and an SSH server. One
+   SSH connection, an OpenSSH control master, is shared by everything done on the
+   host:
+
+     files     of the BitSwan home are read and written over SFTP
+     commands  such as docker compose and git run on the host, in its environment
+     ports     such as Caddy's admin API are forwarded to this machine
+     locks     are taken with flock(1) on the host, so bitswan there waits for them
+
+   Docker commands run against the host's daemon with DOCKER_HOST set to the URL
+   of the context. The system ssh and sftp are used, so ~/.ssh/config, the SSH
+   agent and known_hosts apply as they do for ssh itself.
+*/
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Target is the SSH destination of a context
+type Target struct {
+	User string
+	Host string
+	// Port is 0 for the port configured for the host in ~/.ssh/config, 22 by default
+	Port int
+}
+
+// ParseURL parses an ssh://[user@]host[:port] URL
+func ParseURL(raw string) (*Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context URL %q: %w", raw, err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("invalid context URL %q: only ssh://[user@]host[:port] is supported", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid context URL %q: missing host", raw)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid context URL %q: unexpected path, set the BitSwan home of the host with --remote-home", raw)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("invalid context URL %q: passwords are not stored, use an SSH key or agent", raw)
+	}
+
+	target := &Target{User: u.User.Username(), Host: u.Hostname()}
+	if port := u.Port(); port != "" {
+		target.Port, err = strconv.Atoi(port)
+		if err != nil || target.Port < 1 || target.Port > 65535 {
+			return nil, fmt.Errorf("invalid context URL %q: invalid port", raw)
+		}
+	}
+	return target, nil
+}
+
+// Destination returns the destination argument of ssh, e.g. ops@vm1.example.com
+func (t *Target) Destination() string {
+	if t.User == "" {
+		return t.Host
+	}
+	return t.User + "@" + t.Host
+}
+
+func (t *Target) String() string {
+	host := t.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if t.Port != 0 {
+		host += ":" + strconv.Itoa(t.Port)
+	}
+	if t.User != "" {
+		host = t.User + "@" + host
+	}
+	return "ssh://" + host
+}
+
+// Quote quotes an argument for a POSIX shell
+func Quote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
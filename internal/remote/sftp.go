@@ -0,0 +1,343 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+// ReadFile reads a file on the host
+func (c *Conn) ReadFile(name string) ([]byte, error) {
+	local, err := c.tempFile(nil, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(local)
+
+	if _, err := c.sftp("get " + sftpQuote(name) + " " + sftpQuote(local)); err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return os.ReadFile(local)
+}
+
+// WriteFile replaces a file on the host in a single rename, like atomicfile.WriteFile
+func (c *Conn) WriteFile(name string, data []byte, perm os.FileMode) error {
+	local, err := c.tempFile(data, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(local)
+
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp-"+uniuri.NewLen(8))
+	_, err = c.sftp(
+		"put "+sftpQuote(local)+" "+sftpQuote(tmp),
+		fmt.Sprintf("chmod %o %s", perm.Perm(), sftpQuote(tmp)),
+		"rename "+sftpQuote(tmp)+" "+sftpQuote(name),
+	)
+	if err != nil {
+		c.sftp("-rm " + sftpQuote(tmp))
+		return pathError("write", name, err)
+	}
+	return nil
+}
+
+// WriteFileExclusive creates a file on the host, failing with an error satisfying
+// os.IsExist when it already exists
+func (c *Conn) WriteFileExclusive(name string, data []byte, perm os.FileMode) error {
+	local, err := c.tempFile(data, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(local)
+
+	// A hard link is only created when the file does not exist, unlike a rename
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp-"+uniuri.NewLen(8))
+	_, err = c.sftp(
+		"put "+sftpQuote(local)+" "+sftpQuote(tmp),
+		fmt.Sprintf("chmod %o %s", perm.Perm(), sftpQuote(tmp)),
+		"ln "+sftpQuote(tmp)+" "+sftpQuote(name),
+		"rm "+sftpQuote(tmp),
+	)
+	if err != nil {
+		c.sftp("-rm " + sftpQuote(tmp))
+		if _, statErr := c.Stat(name); statErr == nil {
+			return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+		}
+		return pathError("create", name, err)
+	}
+	return nil
+}
+
+// Stat returns the file info of a file on the host, symlinks are not followed
+func (c *Conn) Stat(name string) (fs.FileInfo, error) {
+	name = path.Clean(name)
+	entries, err := c.list(path.Dir(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == path.Base(name) {
+			return entry, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the entries of a directory on the host sorted by name
+func (c *Conn) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := c.list(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		if info.Name() != "." && info.Name() != ".." {
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	return entries, nil
+}
+
+// MkdirAll creates a directory on the host with its parents. perm applies to
+// the directory, the parents get the default permissions of the host.
+func (c *Conn) MkdirAll(name string, perm os.FileMode) error {
+	name = path.Clean(name)
+	if info, err := c.Stat(name); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("not a directory")}
+		}
+		return nil
+	}
+
+	// Failing mkdirs are ignored, the parents usually exist
+	var batch []string
+	for dir := name; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		batch = append([]string{"-mkdir " + sftpQuote(dir)}, batch...)
+	}
+	batch = append(batch, fmt.Sprintf("chmod %o %s", perm.Perm(), sftpQuote(name)))
+	if _, err := c.sftp(batch...); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// Remove removes a file on the host
+func (c *Conn) Remove(name string) error {
+	if _, err := c.sftp("rm " + sftpQuote(name)); err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// list returns the long listing of a directory, including . and ..
+func (c *Conn) list(dir string) ([]*fileInfo, error) {
+	out, err := c.sftp("ls -lan " + sftpQuote(dir))
+	if err != nil {
+		return nil, err
+	}
+	return parseListing(out, time.Now())
+}
+
+// sftpError is a failed sftp batch, with what sftp reported
+type sftpError struct {
+	err    error
+	stderr string
+}
+
+func (e *sftpError) Error() string {
+	if e.stderr == "" {
+		return "sftp: " + e.err.Error()
+	}
+	return "sftp: " + e.stderr
+}
+
+// sftp runs a batch of sftp commands and returns their output. The batch stops
+// at the first failing command, unless it is prefixed with -.
+func (c *Conn) sftp(batch ...string) (string, error) {
+	args := []string{"-q", "-b", "-", "-o", "ControlPath=" + c.socket, "-o", "ControlMaster=no"}
+	if c.Target.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(c.Target.Port))
+	}
+	destination := c.Target.Destination()
+	if strings.Contains(c.Target.Host, ":") {
+		// sftp takes IPv6 addresses in brackets, unlike ssh
+		destination = strings.TrimSuffix(destination, c.Target.Host) + "[" + c.Target.Host + "]"
+	}
+	args = append(args, destination)
+
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(strings.Join(batch, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", &sftpError{err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+
+	// Batch mode echoes the commands
+	var out []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if !strings.HasPrefix(line, "sftp> ") {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// tempFile creates a file in the directory of the connection, which only the user can read
+func (c *Conn) tempFile(data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(c.dir, "file-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer f.Close()
+	if err := f.Chmod(perm); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// pathError turns a failed sftp batch into the error the os package returns
+func pathError(op, name string, err error) error {
+	if e, ok := err.(*sftpError); ok {
+		switch {
+		case strings.Contains(e.stderr, "not found"), strings.Contains(e.stderr, "No such file"):
+			return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		case strings.Contains(e.stderr, "ermission denied"):
+			return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// sftpQuote quotes a path for an sftp batch, which also expands globs
+func sftpQuote(name string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range name {
+		if strings.ContainsRune(`"\*?[]`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// fileInfo is a file in the output of ls -lan
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) Mode() fs.FileMode  { return f.mode }
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+func (f *fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *fileInfo) Sys() interface{}   { return nil }
+
+// parseListing parses the output of ls -lan in sftp, e.g.
+//
+//	drwxr-xr-x    3 1000     1000         4096 Mar  4 12:01 /srv/bitswan/workspaces/alpha
+//
+// Dates without a year are in the year before now.
+func parseListing(out string, now time.Time) ([]*fileInfo, error) {
+	var infos []*fileInfo
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields, name := splitFields(line, 8)
+		if len(fields) != 8 || name == "" {
+			return nil, fmt.Errorf("unexpected sftp listing: %q", line)
+		}
+
+		mode, err := parseMode(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected size in sftp listing: %q", line)
+		}
+		if mode&fs.ModeSymlink != 0 {
+			name, _, _ = strings.Cut(name, " -> ")
+		}
+
+		info := &fileInfo{name: path.Base(name), size: size, mode: mode}
+		date := strings.Join(fields[5:8], " ")
+		if t, err := time.ParseInLocation("Jan 2 15:04", date, time.Local); err == nil {
+			info.modTime = t.AddDate(now.Year(), 0, 0)
+			if info.modTime.After(now.AddDate(0, 0, 1)) {
+				info.modTime = info.modTime.AddDate(-1, 0, 0)
+			}
+		} else if t, err := time.ParseInLocation("Jan 2 2006", date, time.Local); err == nil {
+			info.modTime = t
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// splitFields splits the first n whitespace separated fields off line and returns them with the rest
+func splitFields(line string, n int) ([]string, string) {
+	var fields []string
+	rest := line
+	for len(fields) < n {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			if rest != "" {
+				fields = append(fields, rest)
+			}
+			return fields, ""
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimLeft(rest, " \t")
+}
+
+// parseMode parses the mode of ls -l, e.g. drwxr-xr-x
+func parseMode(s string) (fs.FileMode, error) {
+	if len(s) < 10 {
+		return 0, fmt.Errorf("unexpected mode in sftp listing: %q", s)
+	}
+	var mode fs.FileMode
+	switch s[0] {
+	case 'd':
+		mode |= fs.ModeDir
+	case 'l':
+		mode |= fs.ModeSymlink
+	case 'p':
+		mode |= fs.ModeNamedPipe
+	case 's':
+		mode |= fs.ModeSocket
+	case 'c':
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case 'b':
+		mode |= fs.ModeDevice
+	}
+	for i, c := range s[1:10] {
+		if c != '-' {
+			mode |= 1 << uint(8-i)
+		}
+	}
+	return mode, nil
+}
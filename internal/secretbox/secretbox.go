@@ -0,0 +1,156 @@
+package secretbox
+
+/*
+   This package encrypts small blobs (workspace secrets, backup archives) with
+   AES-256-GCM. Keys are either provided directly or derived from a passphrase
+   with PBKDF2-HMAC-SHA256.
+*/
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	KeySize  = 32
+	saltSize = 16
+
+	// Iterations of PBKDF2 used for passphrase derived keys
+	Iterations = 600000
+)
+
+var (
+	passphraseMagic = []byte("BSWPASS1")
+	keyMagic        = []byte("BSWKEY1")
+
+	ErrDecrypt = errors.New("failed to decrypt: wrong key or passphrase, or corrupted data")
+)
+
+// DeriveKey derives a key from a passphrase with PBKDF2-HMAC-SHA256 (RFC 8018)
+func DeriveKey(passphrase string, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, []byte(passphrase))
+	key := make([]byte, 0, KeySize)
+
+	for block := uint32(1); len(key) < KeySize; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:KeySize]
+}
+
+// SealWithKey encrypts plaintext with a 32 byte key
+func SealWithKey(plaintext, key []byte) ([]byte, error) {
+	sealed, err := seal(plaintext, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, keyMagic...), sealed...), nil
+}
+
+// OpenWithKey decrypts data produced by SealWithKey
+func OpenWithKey(data, key []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, keyMagic) {
+		return nil, fmt.Errorf("data was not encrypted with a key")
+	}
+	return open(data[len(keyMagic):], key)
+}
+
+// Seal encrypts plaintext with a key derived from the passphrase. The random salt
+// is stored with the ciphertext.
+func Seal(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	sealed, err := seal(plaintext, DeriveKey(passphrase, salt, Iterations))
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, passphraseMagic...)
+	out = append(out, salt...)
+	return append(out, sealed...), nil
+}
+
+// Open decrypts data produced by Seal
+func Open(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, passphraseMagic) || len(data) < len(passphraseMagic)+saltSize {
+		return nil, fmt.Errorf("data was not encrypted with a passphrase")
+	}
+
+	data = data[len(passphraseMagic):]
+	salt, sealed := data[:saltSize], data[saltSize:]
+	return open(sealed, DeriveKey(passphrase, salt, Iterations))
+}
+
+// IsEncrypted reports whether data was produced by Seal or SealWithKey
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, passphraseMagic) || bytes.HasPrefix(data, keyMagic)
+}
+
+func seal(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(data, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d", len(key), KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,51 @@
+package secretbox
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors
+	key := DeriveKey("password", []byte("salt"), 1)
+	assert.Equal(t, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b", hex.EncodeToString(key))
+
+	key = DeriveKey("password", []byte("salt"), 4096)
+	assert.Equal(t, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a", hex.EncodeToString(key))
+}
+
+func TestSealOpen(t *testing.T) {
+	sealed, err := Seal([]byte("top secret"), "correct horse")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+
+	plaintext, err := Open(sealed, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "top secret", string(plaintext))
+
+	_, err = Open(sealed, "wrong horse")
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestSealOpenWithKey(t *testing.T) {
+	key := make([]byte, KeySize)
+	key[0] = 1
+
+	sealed, err := SealWithKey([]byte("top secret"), key)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+
+	plaintext, err := OpenWithKey(sealed, key)
+	require.NoError(t, err)
+	assert.Equal(t, "top secret", string(plaintext))
+
+	key[0] = 2
+	_, err = OpenWithKey(sealed, key)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = SealWithKey([]byte("x"), []byte("short"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+// The key is stored under this service and account in the OS keyring
+const keyringService = "bitswan"
+
+// keyringAccount returns the account of the key, every BitSwan home has its own key
+func keyringAccount() string {
+	if instance := home.Instance(); instance != "" {
+		return "workspace-secrets-" + instance
+	}
+	return "workspace-secrets"
+}
+
+// keyringProbeTimeout bounds the probe, a locked keyring may wait for a prompt nobody answers
+const keyringProbeTimeout = 5 * time.Second
+
+// keyringAvailable reports whether the OS keyring can be used. The tool being
+// installed is not enough, e.g. secret-tool fails without a D-Bus session or
+// an unlocked collection, so a value is stored, read back and removed.
+func keyringAvailable() bool {
+	var tool string
+	switch host.GOOS() {
+	case "linux":
+		tool = "secret-tool"
+	case "darwin":
+		tool = "security"
+	default:
+		return false
+	}
+	// On a remote host a missing tool fails the probe
+	if _, err := exec.LookPath(tool); err != nil && host.Remote() == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyringProbeTimeout)
+	defer cancel()
+
+	account := keyringAccount() + "-probe"
+	probe := base64.StdEncoding.EncodeToString([]byte(time.Now().String()))
+	defer keyringDelete(ctx, account)
+	if err := keyringSet(ctx, account, probe); err != nil {
+		return false
+	}
+	value, err := keyringGet(ctx, account)
+	return err == nil && value == probe
+}
+
+func keyringSet(ctx context.Context, account, value string) error {
+	var cmd *exec.Cmd
+	switch host.GOOS() {
+	case "linux":
+		cmd = host.CommandContext(ctx, "", "secret-tool", "store", "--label=BitSwan workspace secrets", "service", keyringService, "account", account)
+		cmd.Stdin = strings.NewReader(value)
+	case "darwin":
+		// With -w on its command line the key would show in ps, security -i reads the command from stdin
+		cmd = host.CommandContext(ctx, "", "security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", keyringService, account, value))
+		if err := runKeyring(cmd); err != nil {
+			return err
+		}
+		// security -i does not fail when the command it read does
+		if stored, err := keyringGet(ctx, account); err != nil || stored != value {
+			return fmt.Errorf("security failed to store the key in the keychain")
+		}
+		return nil
+	default:
+		return fmt.Errorf("no OS keyring on %s", host.GOOS())
+	}
+	return runKeyring(cmd)
+}
+
+func keyringGet(ctx context.Context, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch host.GOOS() {
+	case "linux":
+		cmd = host.CommandContext(ctx, "", "secret-tool", "lookup", "service", keyringService, "account", account)
+	case "darwin":
+		cmd = host.CommandContext(ctx, "", "security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	default:
+		return "", fmt.Errorf("no OS keyring on %s", host.GOOS())
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runKeyring(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func keyringDelete(ctx context.Context, account string) error {
+	var cmd *exec.Cmd
+	switch host.GOOS() {
+	case "linux":
+		cmd = host.CommandContext(ctx, "", "secret-tool", "clear", "service", keyringService, "account", account)
+	case "darwin":
+		cmd = host.CommandContext(ctx, "", "security", "delete-generic-password", "-s", keyringService, "-a", account)
+	default:
+		return fmt.Errorf("no OS keyring on %s", host.GOOS())
+	}
+	return runKeyring(cmd)
+}
+
+func runKeyring(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package secrets
+
+/*
+   This package encrypts the secrets bitswan keeps on disk, such as the gitops
+   secret in metadata.yaml and the AOC access token. Values are encrypted one by
+   one and stored in place as enc:v1:<base64>, so the files stay readable YAML.
+
+   All values are encrypted with one key, which is kept in one of three backends
+   recorded in secrets-key.yaml in the BitSwan home:
+
+     keyring     the OS keyring (secret-tool on Linux, the keychain on macOS)
+     passphrase  the key file, encrypted with BITSWAN_SECRETS_PASSPHRASE
+     file        the key file itself, readable only by the user
+
+   The backend is chosen when the key is created: BITSWAN_SECRETS_BACKEND when set,
+   otherwise passphrase when BITSWAN_SECRETS_PASSPHRASE is set, and the keyring when
+   a value can be stored in it and read back. The file backend keeps the key next
+   to the values it encrypts, so it is only used when it is set explicitly.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/secretbox"
+)
+
+const (
+	Keyring    = "keyring"
+	Passphrase = "passphrase"
+	File       = "file"
+
+	BackendEnv    = "BITSWAN_SECRETS_BACKEND"
+	PassphraseEnv = "BITSWAN_SECRETS_PASSPHRASE"
+
+	// Prefix marks encrypted values
+	Prefix = "enc:v1:"
+
+	keyFileName = "secrets-key.yaml"
+)
+
+type keyFile struct {
+	Backend string `yaml:"backend"`
+	// Key is the base64 key of the file backend
+	Key string `yaml:"key,omitempty"`
+	// SealedKey is the base64 key of the passphrase backend, encrypted with the passphrase
+	SealedKey string `yaml:"sealed-key,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	cachedKey []byte
+	cachedFor string
+)
+
+// KeyPath returns the path of the file that records where the key is kept
+func KeyPath() string {
+	return home.Path(keyFileName)
+}
+
+// IsEncrypted reports whether the value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt encrypts a value, empty and already encrypted values are returned as is
+func Encrypt(value string) (string, error) {
+	if value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+
+	key, err := Key()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := secretbox.SealWithKey([]byte(value), key)
+	if err != nil {
+		return "", err
+	}
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt, plaintext values of workspaces that
+// were not migrated yet are returned as is
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	key, err := Key()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := secretbox.OpenWithKey(sealed, key)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Key returns the encryption key, creating it on first use
+func Key() ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path := KeyPath()
+	if cachedKey != nil && cachedFor == path {
+		return cachedKey, nil
+	}
+
+	data, err := host.ReadFile(path)
+	var key []byte
+	switch {
+	case os.IsNotExist(err):
+		key, err = createKey(path)
+	case err != nil:
+		err = fmt.Errorf("failed to read %s: %w", keyFileName, err)
+	default:
+		key, err = loadKey(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cachedKey, cachedFor = key, path
+	return key, nil
+}
+
+// Backend returns the backend the key is kept in, empty when there is no key yet
+func Backend() (string, error) {
+	data, err := host.ReadFile(KeyPath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", keyFileName, err)
+	}
+
+	var kf keyFile
+	if err := yaml.Unmarshal(data, &kf); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", keyFileName, err)
+	}
+	return kf.Backend, nil
+}
+
+func loadKey(data []byte) ([]byte, error) {
+	var kf keyFile
+	if err := yaml.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", keyFileName, err)
+	}
+
+	var encoded string
+	switch kf.Backend {
+	case Keyring:
+		var err error
+		if encoded, err = keyringGet(context.Background(), keyringAccount()); err != nil {
+			return nil, fmt.Errorf("failed to read the secrets key from the OS keyring: %w", err)
+		}
+	case Passphrase:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("the secrets key is protected with a passphrase, set %s", PassphraseEnv)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(kf.SealedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sealed key in %s: %w", keyFileName, err)
+		}
+		key, err := secretbox.Open(sealed, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unlock the secrets key: %w", err)
+		}
+		return key, nil
+	case File:
+		encoded = kf.Key
+		warnFileBackend()
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q in %s", kf.Backend, keyFileName)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != secretbox.KeySize {
+		return nil, fmt.Errorf("invalid secrets key")
+	}
+	return key, nil
+}
+
+func createKey(path string) ([]byte, error) {
+	key := make([]byte, secretbox.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	backend := os.Getenv(BackendEnv)
+	if backend == "" {
+		switch {
+		case os.Getenv(PassphraseEnv) != "":
+			backend = Passphrase
+		case keyringAvailable():
+			backend = Keyring
+		default:
+			return nil, fmt.Errorf("no OS keyring is available to keep the secrets key in, set %s to protect it with a passphrase (or %s=%s to keep it unprotected in %s)", PassphraseEnv, BackendEnv, File, keyFileName)
+		}
+	}
+
+	kf := keyFile{Backend: backend}
+	switch backend {
+	case Keyring:
+		if err := keyringSet(context.Background(), keyringAccount(), encoded); err != nil {
+			return nil, fmt.Errorf("failed to store the secrets key in the OS keyring: %w", err)
+		}
+	case Passphrase:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("set %s to protect the secrets key with a passphrase", PassphraseEnv)
+		}
+		sealed, err := secretbox.Seal(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		kf.SealedKey = base64.StdEncoding.EncodeToString(sealed)
+	case File:
+		kf.Key = encoded
+		warnFileBackend()
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q, expected %s, %s or %s", backend, Keyring, Passphrase, File)
+	}
+
+	data, err := yaml.Marshal(kf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", keyFileName, err)
+	}
+	if err := host.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	// Exclusive creation keeps a concurrent process from replacing a key that is already in use
+	err = host.WriteFileExclusive(path, data, 0600)
+	if os.IsExist(err) {
+		data, err := host.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", keyFileName, err)
+		}
+		return loadKey(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", keyFileName, err)
+	}
+
+	return key, nil
+}
+
+// warnFileBackend warns that the secrets can be decrypted by anyone who can read the home
+func warnFileBackend() {
+	fmt.Fprintf(os.Stderr, "\033[33mWarning: the secrets key is stored unprotected in %s, anyone who can read it can decrypt the secrets. Set %s to protect it with a passphrase.\033[0m\n", KeyPath(), PassphraseEnv)
+}
@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecryptFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(BackendEnv, File)
+
+	encrypted, err := Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "s3cret")
+
+	// Encrypting twice keeps the value
+	again, err := Encrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, again)
+
+	decrypted, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", decrypted)
+
+	// Plaintext of workspaces that were not migrated yet passes through
+	plain, err := Decrypt("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", plain)
+
+	empty, err := Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	info, err := os.Stat(KeyPath())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	backend, err := Backend()
+	require.NoError(t, err)
+	assert.Equal(t, File, backend)
+}
+
+func TestPassphraseBackend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(BackendEnv, "")
+	t.Setenv(PassphraseEnv, "correct horse")
+
+	encrypted, err := Encrypt("s3cret")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(KeyPath())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "backend: passphrase")
+
+	// A new process has to unlock the key again
+	cachedKey = nil
+	t.Setenv(PassphraseEnv, "")
+	_, err = Decrypt(encrypted)
+	assert.ErrorContains(t, err, PassphraseEnv)
+
+	t.Setenv(PassphraseEnv, "wrong")
+	_, err = Decrypt(encrypted)
+	assert.Error(t, err)
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	decrypted, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", decrypted)
+}
+
+func TestDecryptWithOtherKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(BackendEnv, File)
+	encrypted, err := Encrypt("s3cret")
+	require.NoError(t, err)
+
+	t.Setenv("HOME", t.TempDir())
+	_, err = Decrypt(encrypted)
+	assert.Error(t, err)
+}
+
+func TestUnusableKeyringRequiresPassphrase(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the keyring tool is faked on Linux only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(BackendEnv, "")
+	t.Setenv(PassphraseEnv, "")
+	cachedKey = nil
+	t.Cleanup(func() { cachedKey = nil })
+
+	// secret-tool is installed, but there is no keyring to talk to
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "secret-tool"), []byte("#!/bin/sh\necho 'Cannot autolaunch D-Bus' >&2\nexit 1\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := Encrypt("s3cret")
+	assert.ErrorContains(t, err, PassphraseEnv)
+
+	// The key is only kept in the clear when asked for
+	_, err = os.Stat(KeyPath())
+	assert.True(t, os.IsNotExist(err))
+}
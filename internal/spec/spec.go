@@ -0,0 +1,153 @@
+package spec
+
+/*
+   This package defines the declarative workspace specification used by
+   `bitswan workspace apply -f workspace.yaml`.
+*/
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	APIVersion = "bitswan.space/v1"
+	Kind       = "Workspace"
+)
+
+var workspaceNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+type Workspace struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
+	Spec       Spec     `yaml:"spec"`
+}
+
+type Metadata struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	// Domain defaults to bs-<name>.localhost for local workspaces
+	Domain   string `yaml:"domain,omitempty"`
+	Remote   string `yaml:"remote,omitempty"`
+	Local    bool   `yaml:"local,omitempty"`
+	SetHosts bool   `yaml:"setHosts,omitempty"`
+	Certs    Certs  `yaml:"certs,omitempty"`
+	Images   Images `yaml:"images,omitempty"`
+	Editor   Editor `yaml:"editor,omitempty"`
+	// Resources limits the services, limits missing from the spec are removed on apply
+	Resources Resources `yaml:"resources,omitempty"`
+}
+
+type Certs struct {
+	Dir    string `yaml:"dir,omitempty"`
+	Mkcert bool   `yaml:"mkcert,omitempty"`
+}
+
+// Images pins the service images, empty images track the latest release of the channel
+type Images struct {
+	Gitops  string `yaml:"gitops,omitempty"`
+	Editor  string `yaml:"editor,omitempty"`
+	Channel string `yaml:"channel,omitempty"`
+}
+
+type Editor struct {
+	// Enabled defaults to true
+	Enabled *bool `yaml:"enabled,omitempty"`
+}
+
+type Resources struct {
+	Gitops Limits `yaml:"gitops,omitempty"`
+	Editor Limits `yaml:"editor,omitempty"`
+	// Automations are the defaults of the automation containers started by gitops
+	Automations Limits `yaml:"automations,omitempty"`
+}
+
+type Limits struct {
+	CPUs      string `yaml:"cpus,omitempty"`
+	Memory    string `yaml:"memory,omitempty"`
+	PidsLimit int    `yaml:"pidsLimit,omitempty"`
+	Restart   string `yaml:"restart,omitempty"`
+}
+
+func (s Spec) EditorEnabled() bool {
+	return s.Editor.Enabled == nil || *s.Editor.Enabled
+}
+
+// Parse decodes and validates a workspace spec
+func Parse(data []byte) (*Workspace, error) {
+	var ws Workspace
+	if err := yaml.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("failed to parse workspace spec: %w", err)
+	}
+
+	if err := ws.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &ws, nil
+}
+
+// Load reads a workspace spec from a file, "-" reads from stdin
+func Load(path string) (*Workspace, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace spec: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// ValidateName checks that a workspace name can be used in paths, hostnames and git branches
+func ValidateName(name string) error {
+	if !workspaceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q", name)
+	}
+	return nil
+}
+
+func (ws *Workspace) Validate() error {
+	if ws.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, expected %q", ws.APIVersion, APIVersion)
+	}
+	if ws.Kind != Kind {
+		return fmt.Errorf("unsupported kind %q, expected %q", ws.Kind, Kind)
+	}
+	if err := ValidateName(ws.Metadata.Name); err != nil {
+		return err
+	}
+	if ws.Spec.Local && (ws.Spec.SetHosts || ws.Spec.Certs.Mkcert) {
+		return fmt.Errorf("local cannot be combined with setHosts or certs.mkcert")
+	}
+	if ws.Spec.Certs.Dir != "" && ws.Spec.Certs.Mkcert {
+		return fmt.Errorf("certs.dir cannot be combined with certs.mkcert")
+	}
+	if ws.Spec.Domain == "" && !ws.Spec.Local {
+		return fmt.Errorf("domain is required unless the workspace is local")
+	}
+	if !ws.Spec.EditorEnabled() && ws.Spec.Images.Editor != "" {
+		return fmt.Errorf("images.editor is set but the editor is disabled")
+	}
+
+	return nil
+}
+
+// Domain returns the domain of the workspace including the local default
+func (ws *Workspace) Domain() string {
+	if ws.Spec.Domain == "" && ws.Spec.Local {
+		return fmt.Sprintf("bs-%s.localhost", ws.Metadata.Name)
+	}
+	return ws.Spec.Domain
+}
@@ -0,0 +1,107 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	ws, err := Parse([]byte(`
+apiVersion: bitswan.space/v1
+kind: Workspace
+metadata:
+  name: demo
+spec:
+  domain: demo.example.com
+  certs:
+    dir: /etc/certs/demo
+  images:
+    gitops: bitswan/gitops:2025-1-git-abc123
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "demo", ws.Metadata.Name)
+	assert.Equal(t, "demo.example.com", ws.Domain())
+	assert.Equal(t, "/etc/certs/demo", ws.Spec.Certs.Dir)
+	assert.True(t, ws.Spec.EditorEnabled())
+}
+
+func TestParseLocalDefaultsDomain(t *testing.T) {
+	ws, err := Parse([]byte(`
+apiVersion: bitswan.space/v1
+kind: Workspace
+metadata:
+  name: demo
+spec:
+  local: true
+  editor:
+    enabled: false
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "bs-demo.localhost", ws.Domain())
+	assert.False(t, ws.Spec.EditorEnabled())
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec string
+	}{
+		{
+			name: "wrong api version",
+			spec: "apiVersion: v0\nkind: Workspace\nmetadata: {name: demo}\nspec: {domain: a.b}",
+		},
+		{
+			name: "wrong kind",
+			spec: "apiVersion: bitswan.space/v1\nkind: Caddy\nmetadata: {name: demo}\nspec: {domain: a.b}",
+		},
+		{
+			name: "invalid name",
+			spec: "apiVersion: bitswan.space/v1\nkind: Workspace\nmetadata: {name: ../demo}\nspec: {domain: a.b}",
+		},
+		{
+			name: "missing domain",
+			spec: "apiVersion: bitswan.space/v1\nkind: Workspace\nmetadata: {name: demo}\nspec: {}",
+		},
+		{
+			name: "local with mkcert",
+			spec: "apiVersion: bitswan.space/v1\nkind: Workspace\nmetadata: {name: demo}\nspec: {local: true, certs: {mkcert: true}}",
+		},
+		{
+			name: "editor image without editor",
+			spec: "apiVersion: bitswan.space/v1\nkind: Workspace\nmetadata: {name: demo}\nspec: {domain: a.b, editor: {enabled: false}, images: {editor: x}}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.spec))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	ws, err := Parse([]byte(`
+apiVersion: bitswan.space/v1
+kind: Workspace
+metadata:
+  name: demo
+spec:
+  local: true
+  resources:
+    gitops:
+      cpus: "1.5"
+      memory: 1g
+    automations:
+      pidsLimit: 100
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Limits{CPUs: "1.5", Memory: "1g"}, ws.Spec.Resources.Gitops)
+	assert.Equal(t, Limits{PidsLimit: 100}, ws.Spec.Resources.Automations)
+	assert.Equal(t, Limits{}, ws.Spec.Resources.Editor)
+}
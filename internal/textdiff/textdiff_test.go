@@ -0,0 +1,58 @@
+package textdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedEqual(t *testing.T) {
+	assert.Empty(t, Unified("a", "b", "x\ny\n", "x\ny\n"))
+}
+
+func TestUnified(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	to := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++16
+`
+	assert.Equal(t, expected, Unified("a", "b", from, to))
+}
+
+func TestUnifiedMergesCloseChanges(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\n"
+	to := "A\nb\nc\nd\ne\nf\nG\n"
+
+	expected := `--- x
++++ y
+@@ -1,7 +1,7 @@
+-a
++A
+ b
+ c
+ d
+ e
+ f
+-g
++G
+`
+	assert.Equal(t, expected, Unified("x", "y", from, to))
+}
+
+func TestUnifiedFromEmpty(t *testing.T) {
+	assert.Equal(t, "--- x\n+++ y\n@@ -0,0 +1,2 @@\n+a\n+b\n", Unified("x", "y", "", "a\nb\n"))
+}
@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/home"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+	"github.com/bitswan-space/bitswan-workspaces/internal/remote"
+)
+
+// DefaultLockTimeout is how long to wait for a lock held by another process
+const DefaultLockTimeout = 30 * time.Second
+
+// globalLockName is the lock of what workspaces share, the Caddy configuration and
+// the Docker network
+const globalLockName = "global"
+
+// lockPollInterval is how often a held lock is retried
+const lockPollInterval = 100 * time.Millisecond
+
+// Lock is an advisory lock held by this process. The lock files are kept outside
+// the workspace directories, which init creates, rename moves and remove deletes.
+type Lock struct {
+	file *os.File
+	// release releases the lock held on a remote host
+	release func() error
+}
+
+// Holder is the process holding a lock, as recorded in the lock file
+type Holder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// LockedError is returned when a lock is still held by another process after the timeout
+type LockedError struct {
+	// What is locked, e.g. "workspace alpha"
+	What   string
+	Holder *Holder
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s is locked by another bitswan process", e.What)
+	}
+	return fmt.Sprintf("%s is locked by pid %d running `%s` since %s", e.What, e.Holder.PID, e.Holder.Command, e.Holder.Since.Format(time.RFC3339))
+}
+
+// LocksDir returns the directory of the lock files
+func LocksDir() string {
+	return home.Path("locks")
+}
+
+// LockGlobal takes the lock of the Caddy configuration and the Docker network,
+// which all workspaces share. It is held only while they are changed. command
+// is recorded for other processes waiting for the lock, e.g. "bitswan workspace init".
+func LockGlobal(command string, timeout time.Duration) (*Lock, error) {
+	return acquire(globalLockName, "the Caddy and Docker network configuration", command, timeout)
+}
+
+// LockWorkspace takes the lock of a workspace, the workspace does not have to exist
+func LockWorkspace(workspaceName, command string, timeout time.Duration) (*Lock, error) {
+	if workspaceName == "" || workspaceName != filepath.Base(workspaceName) || strings.HasPrefix(workspaceName, ".") {
+		return nil, fmt.Errorf("invalid workspace name %q", workspaceName)
+	}
+	return acquire("workspace-"+workspaceName, "workspace "+workspaceName, command, timeout)
+}
+
+func acquire(name, what, command string, timeout time.Duration) (*Lock, error) {
+	holder, err := json.Marshal(Holder{PID: os.Getpid(), Command: command, Since: time.Now().UTC().Truncate(time.Second)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lock holder: %w", err)
+	}
+	if conn := host.Remote(); conn != nil {
+		return acquireRemote(conn, name, what, holder, timeout)
+	}
+
+	if err := os.MkdirAll(LocksDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create locks directory: %w", err)
+	}
+	path := filepath.Join(LocksDir(), name+".lock")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", what, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, &LockedError{What: what, Holder: readHolder(path)}
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// The holder is informational, the lock itself is the file lock
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt(holder, 0)
+	}
+	return &Lock{file: file}, nil
+}
+
+// acquireRemote takes the lock on the remote host, with the flock of the same
+// file, so that it also excludes the bitswan commands run on the host
+func acquireRemote(conn *remote.Conn, name, what string, holder []byte, timeout time.Duration) (*Lock, error) {
+	path := filepath.Join(LocksDir(), name+".lock")
+	release, err := conn.Lock(path, holder, timeout)
+	if errors.Is(err, remote.ErrLocked) {
+		return nil, &LockedError{What: what, Holder: readHolder(path)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", what, err)
+	}
+	return &Lock{release: release}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if l.release != nil {
+		return l.release()
+	}
+	l.file.Truncate(0)
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock: %w", err)
+	}
+	return l.file.Close()
+}
+
+// readHolder returns the holder recorded in a lock file, nil when it is not known
+func readHolder(path string) *Holder {
+	data, err := host.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var holder Holder
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return nil
+	}
+	return &holder
+}
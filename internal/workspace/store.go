@@ -0,0 +1,92 @@
+package workspace
+
+/*
+   This package is the store of the workspaces on disk. Commands read and write
+   the metadata, docker-compose and other files of a workspace through a Store,
+   which replaces files atomically, and take the lock of the workspace before
+   changing it so that concurrent bitswan processes do not interleave.
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+	"github.com/bitswan-space/bitswan-workspaces/internal/host"
+)
+
+// ComposeFile is the name of the generated docker-compose file in the deployment directory
+const ComposeFile = "docker-compose.yml"
+
+// Store reads and writes the files of a workspace
+type Store struct {
+	Name string
+	// Dir is the workspace directory, e.g. ~/.config/bitswan/workspaces/<name>
+	// in the default BitSwan home
+	Dir string
+}
+
+// New returns the store of a workspace that may not exist yet
+func New(workspaceName string) *Store {
+	return &Store{Name: workspaceName, Dir: config.WorkspaceDir(workspaceName)}
+}
+
+// Open returns the store of an existing workspace
+func Open(workspaceName string) (*Store, error) {
+	s := New(workspaceName)
+	if _, err := host.Stat(s.Dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("workspace %s does not exist", workspaceName)
+	}
+	return s, nil
+}
+
+// DeploymentDir returns the directory of the docker-compose files
+func (s *Store) DeploymentDir() string {
+	return filepath.Join(s.Dir, "deployment")
+}
+
+// Path returns the path of a file relative to the workspace directory
+func (s *Store) Path(name ...string) string {
+	return filepath.Join(append([]string{s.Dir}, name...)...)
+}
+
+// ReadMetadata reads the metadata with its secrets decrypted
+func (s *Store) ReadMetadata() (*config.Metadata, error) {
+	return config.ReadMetadata(s.Dir)
+}
+
+// ReadMetadataSealed reads the metadata with its secrets left encrypted
+func (s *Store) ReadMetadataSealed() (*config.Metadata, error) {
+	return config.ReadMetadataSealed(s.Dir)
+}
+
+// WriteMetadata replaces the metadata, encrypting its secrets
+func (s *Store) WriteMetadata(metadata *config.Metadata) error {
+	return config.WriteMetadata(s.Dir, metadata)
+}
+
+// ReadCompose reads the generated docker-compose file
+func (s *Store) ReadCompose() ([]byte, error) {
+	data, err := host.ReadFile(filepath.Join(s.DeploymentDir(), ComposeFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker-compose file: %w", err)
+	}
+	return data, nil
+}
+
+// WriteFile atomically replaces a file, name is relative to the workspace directory
+func (s *Store) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return WriteFile(s.Path(name), data, perm)
+}
+
+// Lock takes the lock of the workspace
+func (s *Store) Lock(command string, timeout time.Duration) (*Lock, error) {
+	return LockWorkspace(s.Name, command, timeout)
+}
+
+// WriteFile atomically replaces the file at path, it has the signature of os.WriteFile
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return host.WriteFile(path, data, perm)
+}
@@ -0,0 +1,74 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bitswan-space/bitswan-workspaces/internal/config"
+)
+
+func TestLockWorkspace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	lock, err := LockWorkspace("alpha", "bitswan workspace update", time.Second)
+	require.NoError(t, err)
+
+	// Other workspaces and the global lock are independent
+	other, err := LockWorkspace("beta", "bitswan workspace update", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, other.Unlock())
+	global, err := LockGlobal("bitswan workspace init", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, global.Unlock())
+
+	_, err = LockWorkspace("alpha", "bitswan workspace remove", 200*time.Millisecond)
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	require.NotNil(t, locked.Holder)
+	assert.Equal(t, os.Getpid(), locked.Holder.PID)
+	assert.Equal(t, "bitswan workspace update", locked.Holder.Command)
+	assert.Contains(t, err.Error(), "workspace alpha is locked by pid")
+	assert.Contains(t, err.Error(), "running `bitswan workspace update`")
+
+	// A waiting process gets the lock once it is released
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock.Unlock()
+	}()
+	lock, err = LockWorkspace("alpha", "bitswan workspace remove", 5*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestLockWorkspaceInvalidName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	_, err := LockWorkspace("../alpha", "bitswan workspace restore", time.Second)
+	assert.EqualError(t, err, `invalid workspace name "../alpha"`)
+}
+
+func TestStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := Open("alpha")
+	assert.EqualError(t, err, "workspace alpha does not exist")
+
+	s := New("alpha")
+	require.NoError(t, os.MkdirAll(s.DeploymentDir(), 0755))
+	s, err = Open("alpha")
+	require.NoError(t, err)
+
+	require.NoError(t, s.WriteFile(filepath.Join("deployment", ComposeFile), []byte("services: {}\n"), 0644))
+	compose, err := s.ReadCompose()
+	require.NoError(t, err)
+	assert.Equal(t, "services: {}\n", string(compose))
+
+	require.NoError(t, s.WriteMetadata(&config.Metadata{Domain: "example.com"}))
+	metadata, err := s.ReadMetadataSealed()
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", metadata.Domain)
+}